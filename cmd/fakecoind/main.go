@@ -0,0 +1,210 @@
+// fakecoind pretends to be a masternode coin daemon (ex: `pivxd`) so that gomn
+// can be exercised end-to-end without a real node.  Install it in place of the
+// coin's daemon binary and it will read the coin's conf file, serve JSON-RPC
+// on `rpcport` and play out the scripted behavior specified by its flags.
+package main
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/sabhiram/gomn/coin"
+	"github.com/sabhiram/gomn/coin/cointest"
+	"github.com/sabhiram/gomn/zmq"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+var (
+	opts = struct {
+		dataDir    string
+		confFile   string
+		pidFile    string
+		rpcPort    int
+		blocks     int64
+		forkAt     int64
+		blockTime  time.Duration
+		warmup     time.Duration
+		syncFor    time.Duration
+		mnStatus   int
+		mnStartIn  time.Duration
+		crashAfter time.Duration
+		importTime time.Duration
+	}{}
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+func main() {
+	confPath := opts.confFile
+	if !filepath.IsAbs(confPath) {
+		confPath = filepath.Join(opts.dataDir, confPath)
+	}
+	conf, err := coin.LoadConfFile(confPath)
+	if err != nil {
+		log.Fatalf("Unable to load conf file %s: %s\n", confPath, err.Error())
+	}
+
+	port := opts.rpcPort
+	if port == 0 {
+		port, _ = strconv.Atoi(conf["rpcport"])
+	}
+	if port == 0 {
+		log.Fatalf("No rpcport specified in %s or via --rpcport\n", confPath)
+	}
+
+	d, err := cointest.NewDaemon(fmt.Sprintf("127.0.0.1:%d", port), conf["rpcuser"], conf["rpcpassword"])
+	if err != nil {
+		log.Fatalf("Unable to start daemon: %s\n", err.Error())
+	}
+
+	// Publish zmq notifications if the conf asks for them.
+	for _, topic := range []string{"hashblock", "rawtx"} {
+		ep := conf["zmqpub"+topic]
+		if len(ep) == 0 {
+			continue
+		}
+		addr, err := zmq.ParseEndpoint(ep)
+		if err != nil {
+			log.Fatalf("Invalid zmqpub%s: %s\n", topic, err.Error())
+		}
+		if _, err := d.ListenZMQ(topic, addr); err != nil {
+			log.Fatalf("Unable to publish %s on %s: %s\n", topic, ep, err.Error())
+		}
+	}
+
+	pidFile := opts.pidFile
+	if len(pidFile) == 0 {
+		pidFile = filepath.Base(os.Args[0]) + ".pid"
+	}
+	if !filepath.IsAbs(pidFile) {
+		pidFile = filepath.Join(opts.dataDir, pidFile)
+	}
+	if err := d.WritePidFile(pidFile); err != nil {
+		log.Fatalf("Unable to write pidfile: %s\n", err.Error())
+	}
+
+	// Script the daemon's behavior based on the command line.
+	d.Update(func(s *cointest.State) {
+		s.Blocks = opts.blocks
+		s.Headers = opts.blocks
+		s.ForkHeight = opts.forkAt
+		s.Warmup = opts.warmup > 0
+		s.Synced = opts.syncFor == 0
+		s.MasternodeStatus = opts.mnStatus
+		if opts.mnStatus != cointest.MasternodeStarted {
+			s.MasternodeMessage = "Not capable masternode: Hot node, waiting for remote activation."
+		}
+	})
+	if opts.warmup > 0 {
+		d.After(opts.warmup, func(s *cointest.State) { s.Warmup = false })
+	}
+	if opts.syncFor > 0 {
+		d.After(opts.warmup+opts.syncFor, func(s *cointest.State) { s.Synced = true })
+	}
+	if opts.mnStartIn > 0 {
+		d.After(opts.warmup+opts.syncFor+opts.mnStartIn, func(s *cointest.State) {
+			s.MasternodeStatus = cointest.MasternodeStarted
+			s.MasternodeMessage = "Masternode successfully started"
+		})
+	}
+	// Import a bootstrap.dat like the real daemons do on startup, the file is
+	// renamed once all of its blocks are loaded.
+	if fp := filepath.Join(opts.dataDir, "bootstrap.dat"); coin.FileExists(fp) {
+		d.Update(func(s *cointest.State) { s.Blocks, s.Headers = 0, 0 })
+		go importBootstrap(d, fp)
+	}
+	if opts.blockTime > 0 {
+		go func() {
+			for {
+				select {
+				case <-time.After(opts.blockTime):
+					d.MineBlock()
+				case <-d.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	log.Printf("fakecoind listening on %s (pid %d)\n", d.URL, os.Getpid())
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+
+	var crash <-chan time.Time
+	if opts.crashAfter > 0 {
+		crash = time.After(opts.crashAfter)
+	}
+
+	select {
+	case <-d.Done():
+		log.Printf("fakecoind stopped\n")
+	case <-sigs:
+		d.Close()
+		log.Printf("fakecoind shutting down\n")
+	case <-crash:
+		d.Crash()
+		log.Printf("fakecoind crashed!\n")
+		os.Exit(1)
+	}
+}
+
+// importBootstrap pretends to load `-blocks` blocks from the bootstrap.dat at
+// `fp` over `-importtime`.
+func importBootstrap(d *cointest.Daemon, fp string) {
+	const steps = 10
+	for i := int64(1); i <= steps; i++ {
+		select {
+		case <-time.After(opts.importTime / steps):
+		case <-d.Done():
+			return
+		}
+		d.Update(func(s *cointest.State) {
+			s.Blocks = opts.blocks * i / steps
+			s.Headers = s.Blocks
+		})
+	}
+	if err := os.Rename(fp, fp+".old"); err != nil {
+		log.Printf("Unable to rename %s: %s\n", fp, err.Error())
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func init() {
+	log.SetFlags(0)
+	log.SetPrefix("")
+
+	// Flags mirror the real daemons where possible (ex: `-datadir`, `-conf`).
+	flag.StringVar(&opts.dataDir, "datadir", filepath.Join(coin.HomeDir(), ".pivx"), "data directory")
+	flag.StringVar(&opts.confFile, "conf", "pivx.conf", "conf file, relative to the data directory")
+	flag.StringVar(&opts.pidFile, "pid", "", "pid file, relative to the data directory (default <binary>.pid)")
+	flag.IntVar(&opts.rpcPort, "rpcport", 0, "override the rpcport from the conf file")
+	flag.Int64Var(&opts.blocks, "blocks", 1000, "initial block height")
+	flag.Int64Var(&opts.forkAt, "forkat", 0, "follow a fork of the chain from this height on (0 => no fork)")
+	flag.DurationVar(&opts.blockTime, "blocktime", 0, "interval between new blocks (0 => no new blocks)")
+	flag.DurationVar(&opts.warmup, "warmup", 0, "time to answer every RPC with -28 (warming up)")
+	flag.DurationVar(&opts.syncFor, "sync", 0, "time to report syncing, after warmup")
+	flag.IntVar(&opts.mnStatus, "mnstatus", cointest.MasternodeStarted, "initial masternode status code")
+	flag.DurationVar(&opts.mnStartIn, "mnstart", 0, "time until the masternode reports started, after sync")
+	flag.DurationVar(&opts.crashAfter, "crash", 0, "time until the daemon crashes (0 => never)")
+	flag.DurationVar(&opts.importTime, "importtime", 10*time.Second, "time to import a bootstrap.dat found in the data directory")
+
+	// Since gomn launches the daemon without arguments, extra flags can also
+	// be passed along via the environment.
+	args := strings.Fields(os.Getenv("FAKECOIND_FLAGS"))
+	flag.CommandLine.Parse(append(args, os.Args[1:]...))
+}
+
+////////////////////////////////////////////////////////////////////////////////
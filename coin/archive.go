@@ -0,0 +1,239 @@
+package coin
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Extractor unpacks a downloaded file into a directory.
+type Extractor interface {
+	// Extract unpacks the file at `srcfp` into the directory `dstdp`.  `name`
+	// is the original file name (ex: the last element of its url), formats
+	// which do not carry names of their own (plain files, .gz) install the
+	// file under it.
+	Extract(srcfp, dstdp, name string) error
+}
+
+// ExtractorFunc adapts a function to the Extractor interface.
+type ExtractorFunc func(srcfp, dstdp, name string) error
+
+// Extract implements the Extractor interface.
+func (fn ExtractorFunc) Extract(srcfp, dstdp, name string) error {
+	return fn(srcfp, dstdp, name)
+}
+
+// MatchFunc reports whether `head`, the first bytes of a file (up to
+// `sniffLen`), look like a given archive format.
+type MatchFunc func(head []byte) bool
+
+////////////////////////////////////////////////////////////////////////////////
+
+const (
+	sniffLen = 4096 // bytes read from the start of a file to detect its format
+)
+
+var (
+	ErrUnknownFormat = errors.New("unable to detect archive format")
+)
+
+// archiveFormat is a registered archive format.
+type archiveFormat struct {
+	name    string    // canonical name, ex: "tar.gz"
+	aliases []string  // other accepted names, ex: "tgz"
+	match   MatchFunc // nil if the format can not be detected
+	ext     Extractor
+}
+
+// formats stores the registered archive formats in registration order, which
+// is also the order they are tried in when detecting a file's format.
+var (
+	formatsLock = sync.RWMutex{}
+	formats     = []*archiveFormat{}
+)
+
+// RegisterExtractor registers an archive format `name` (plus any `aliases`)
+// which is recognized by `match` and unpacked by `ext`.  Formats registered
+// earlier take precedence when detecting, so more specific formats (tar.gz)
+// should be registered before more general ones (gz).
+func RegisterExtractor(name string, aliases []string, match MatchFunc, ext Extractor) error {
+	formatsLock.Lock()
+	defer formatsLock.Unlock()
+
+	for _, n := range append([]string{name}, aliases...) {
+		if f := lookupFormat(n); f != nil {
+			return fmt.Errorf("archive format %s already registered (as %s)", n, f.name)
+		}
+	}
+	formats = append(formats, &archiveFormat{
+		name:    strings.ToLower(name),
+		aliases: aliases,
+		match:   match,
+		ext:     ext,
+	})
+	return nil
+}
+
+// lookupFormat finds a format by name or alias, must be called with the lock
+// held.
+func lookupFormat(name string) *archiveFormat {
+	name = strings.ToLower(name)
+	for _, f := range formats {
+		if f.name == name {
+			return f
+		}
+		for _, a := range f.aliases {
+			if strings.ToLower(a) == name {
+				return f
+			}
+		}
+	}
+	return nil
+}
+
+// RegisteredExtractors returns the names of all registered archive formats.
+func RegisteredExtractors() []string {
+	formatsLock.RLock()
+	defer formatsLock.RUnlock()
+
+	ret := []string{}
+	for _, f := range formats {
+		ret = append(ret, f.name)
+	}
+	return ret
+}
+
+// GetExtractor returns the extractor registered for `name` (or an alias).
+func GetExtractor(name string) (Extractor, error) {
+	formatsLock.RLock()
+	defer formatsLock.RUnlock()
+
+	if f := lookupFormat(name); f != nil {
+		return f.ext, nil
+	}
+	return nil, fmt.Errorf("unsupported compression type (%s)", name)
+}
+
+// DetectFormat returns the name of the archive format of the file at `fp`
+// based on its magic bytes.
+func DetectFormat(fp string) (string, error) {
+	f, err := os.Open(fp)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	head = head[:n]
+
+	formatsLock.RLock()
+	defer formatsLock.RUnlock()
+	for _, f := range formats {
+		if f.match != nil && f.match(head) {
+			return f.name, nil
+		}
+	}
+	return "", ErrUnknownFormat
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// magic returns a MatchFunc which matches files starting with `prefix`.
+func magic(prefix string) MatchFunc {
+	return func(head []byte) bool {
+		return bytes.HasPrefix(head, []byte(prefix))
+	}
+}
+
+// isTar returns true if `head` looks like the start of a tar archive.
+func isTar(head []byte) bool {
+	const magicOffset = 257
+	if len(head) < magicOffset+5 {
+		return false
+	}
+	return string(head[magicOffset:magicOffset+5]) == "ustar"
+}
+
+// compressedTar returns a MatchFunc which matches files starting with
+// `prefix` that decompress (using `decompress`) into a tar archive.
+func compressedTar(prefix string, decompress func(io.Reader) (io.Reader, error)) MatchFunc {
+	return func(head []byte) bool {
+		if !bytes.HasPrefix(head, []byte(prefix)) {
+			return false
+		}
+		r, err := decompress(bytes.NewReader(head))
+		if err != nil {
+			return false
+		}
+		inner := make([]byte, 512)
+		n, _ := io.ReadFull(r, inner)
+		return isTar(inner[:n])
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// extractToPath extracts the file at `srcfp`, which was downloaded as `name`,
+// into `dstdp`.  The declared compression type `ctype` is checked against the
+// file's magic bytes: if it is empty or does not match, the detected format
+// is used instead.
+func extractToPath(ctype, srcfp, dstdp, name string) error {
+	ctype = strings.ToLower(ctype)
+	detected, err := DetectFormat(srcfp)
+	switch {
+	case err == ErrUnknownFormat:
+		detected = ""
+	case err != nil:
+		return err
+	}
+
+	formatsLock.RLock()
+	declared := lookupFormat(ctype)
+	formatsLock.RUnlock()
+
+	// A declared format which can be detected but was not, is wrong: the file
+	// is either some other format, or not an archive at all.
+	format := ctype
+	switch {
+	case len(detected) == 0 && declared != nil && declared.match != nil:
+		detected = "none"
+		fallthrough
+	case len(detected) > 0 && (declared == nil || declared.name != detected):
+		if len(ctype) > 0 {
+			log.Printf("  Warning: %s was declared as %s but looks like %s\n", name, ctype, detected)
+		}
+		format = detected
+	}
+
+	ext, err := GetExtractor(format)
+	if err != nil {
+		return err
+	}
+	log.Printf("  Extracting %s (%s) into %s\n", name, format, dstdp)
+	return ext.Extract(srcfp, dstdp, name)
+}
+
+// baseName returns the file name to use for the download at `url`.
+func baseName(url string) string {
+	name := path.Base(strings.SplitN(url, "?", 2)[0])
+	if name == "." || name == "/" || len(name) == 0 {
+		return "download"
+	}
+	return name
+}
+
+////////////////////////////////////////////////////////////////////////////////
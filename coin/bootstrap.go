@@ -0,0 +1,323 @@
+package coin
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sabhiram/gomn/types"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// BootstrapType describes what a coin's bootstrap archive contains.
+type BootstrapType string
+
+const (
+	BootstrapAuto     BootstrapType = ""              // detect from the archive's contents
+	BootstrapDat      BootstrapType = "bootstrap.dat" // a bootstrap.dat the daemon imports on startup
+	BootstrapSnapshot BootstrapType = "snapshot"      // the daemon's blocks and chainstate directories
+)
+
+const (
+	bootstrapDatFile     = "bootstrap.dat"
+	bootstrapDatImported = "bootstrap.dat.old" // the daemon renames the file once it is imported
+)
+
+var (
+	// chainDirs are the data subdirectories which hold the block chain, they
+	// are replaced by a bootstrap.
+	chainDirs = []string{"blocks", "chainstate"}
+
+	// snapshotSkipDirs are directories found next to the chain data which are
+	// never installed from a snapshot.
+	snapshotSkipDirs = map[string]bool{"backups": true, "wallets": true}
+
+	// importPollInterval is how often the import of a bootstrap.dat is polled.
+	importPollInterval = 5 * time.Second
+
+	ErrDaemonRunning = errors.New("daemon is running, stop it first")
+	ErrNoBootstrap   = errors.New("bootstrap contains neither a bootstrap.dat nor a blocks/chainstate snapshot")
+)
+
+// ParseBootstrapType validates a bootstrap type name.
+func ParseBootstrapType(s string) (BootstrapType, error) {
+	switch t := BootstrapType(strings.ToLower(s)); t {
+	case BootstrapAuto, BootstrapDat, BootstrapSnapshot:
+		return t, nil
+	}
+	return BootstrapAuto, fmt.Errorf("invalid bootstrap type (%s), expected %s or %s", s, BootstrapDat, BootstrapSnapshot)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// keepFiles returns the names of files in the data directory which belong to
+// the node operator, a bootstrap never moves or replaces them.
+func (c *Coin) keepFiles() map[string]bool {
+	return map[string]bool{
+		"wallet.dat":      true,
+		"masternode.conf": true,
+		c.configFile:      true,
+	}
+}
+
+// DownloadBootstrap fetches the coin's bootstrap into the data directory.
+// Existing chain data is only replaced if `override.Force` is set, in which
+// case it is moved aside to a timestamped backup first.  The wallet, the conf
+// file and masternode.conf are always left in place.
+func (c *Coin) DownloadBootstrap(args []string, override *types.Bootstrap) error {
+	if c.daemonReady() == nil {
+		return ErrDaemonRunning
+	}
+
+	dataPath := c.state.dataPath
+	existing := []string{}
+	for _, name := range chainDirs {
+		if _, err := os.Lstat(filepath.Join(dataPath, name)); err == nil {
+			existing = append(existing, name)
+		}
+	}
+	if len(existing) > 0 && !override.Force {
+		return fmt.Errorf("chain data already exists in %s (use --force to back it up and re-bootstrap)", dataPath)
+	}
+
+	// Extract into a staging directory next to the data, so that a failed
+	// download leaves the existing data alone.
+	if err := os.MkdirAll(dataPath, 0700); err != nil {
+		return err
+	}
+	stage, err := ioutil.TempDir(dataPath, ".bootstrap-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(stage)
+
+	if err := c.bootstrapDownloader.DownloadToPath(stage, override); err != nil {
+		return err
+	}
+
+	typ := c.bootstrapDownloader.Type
+	if len(override.Mode) > 0 {
+		if typ, err = ParseBootstrapType(override.Mode); err != nil {
+			return err
+		}
+	}
+	// What is to be installed is gathered next to the staging directory, not
+	// in it, as a snapshot at the root of the archive is the staging
+	// directory itself.
+	install, err := ioutil.TempDir(dataPath, ".bootstrap-install-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(install)
+
+	if typ, err = prepareBootstrap(stage, install, typ); err != nil {
+		return err
+	}
+	if err := c.installBootstrap(install, existing, override.Force); err != nil {
+		return err
+	}
+
+	if typ == BootstrapDat {
+		log.Printf("  %s will import %s when it starts\n", c.daemonBin, bootstrapDatFile)
+		if override.Watch {
+			return c.watchImport()
+		}
+	}
+	return nil
+}
+
+// prepareBootstrap finds the bootstrap of type `typ` (or whichever type it
+// looks like) in the extracted archive in `stage`, and moves what is to be
+// installed into the empty directory `src`.  The bootstrap's type is returned.
+func prepareBootstrap(stage, src string, typ BootstrapType) (BootstrapType, error) {
+	datFile, snapshotDir := "", ""
+	err := filepath.Walk(stage, func(fp string, info os.FileInfo, err error) error {
+		switch {
+		case err != nil:
+			return err
+		case len(datFile) == 0 && !info.IsDir() && info.Name() == bootstrapDatFile:
+			datFile = fp
+		case len(snapshotDir) == 0 && info.IsDir() &&
+			DirExists(filepath.Join(fp, "blocks")) && DirExists(filepath.Join(fp, "chainstate")):
+			snapshotDir = fp
+		}
+		return nil
+	})
+	if err != nil {
+		return typ, err
+	}
+
+	if typ == BootstrapAuto {
+		switch {
+		case len(snapshotDir) > 0:
+			typ = BootstrapSnapshot
+		case len(datFile) > 0:
+			typ = BootstrapDat
+		default:
+			return typ, ErrNoBootstrap
+		}
+	}
+
+	switch typ {
+	case BootstrapDat:
+		if len(datFile) == 0 {
+			return typ, fmt.Errorf("bootstrap does not contain a %s", bootstrapDatFile)
+		}
+		log.Printf("  Found %s (%s)\n", bootstrapDatFile, strings.TrimPrefix(datFile, stage+string(filepath.Separator)))
+		return typ, os.Rename(datFile, filepath.Join(src, bootstrapDatFile))
+
+	case BootstrapSnapshot:
+		if len(snapshotDir) == 0 {
+			return typ, errors.New("bootstrap does not contain a blocks/chainstate snapshot")
+		}
+		if err := validateSnapshot(snapshotDir); err != nil {
+			return typ, err
+		}
+		// Only the chain's databases are installed, loose files (logs, pid
+		// files, peers) belong to whoever made the snapshot.
+		fis, err := ioutil.ReadDir(snapshotDir)
+		if err != nil {
+			return typ, err
+		}
+		for _, fi := range fis {
+			if !fi.IsDir() || snapshotSkipDirs[fi.Name()] {
+				continue
+			}
+			if err := os.Rename(filepath.Join(snapshotDir, fi.Name()), filepath.Join(src, fi.Name())); err != nil {
+				return typ, err
+			}
+		}
+		return typ, nil
+	}
+	return typ, fmt.Errorf("invalid bootstrap type (%s)", typ)
+}
+
+// validateSnapshot checks that `dp` holds a plausible blocks/chainstate
+// snapshot: block files, and the block index and chainstate databases.
+func validateSnapshot(dp string) error {
+	blks, err := filepath.Glob(filepath.Join(dp, "blocks", "blk*.dat"))
+	if err != nil {
+		return err
+	}
+	switch {
+	case len(blks) == 0:
+		return errors.New("invalid snapshot, no block files (blocks/blk*.dat)")
+	case !FileExists(filepath.Join(dp, "blocks", "index", "CURRENT")):
+		return errors.New("invalid snapshot, missing the block index (blocks/index)")
+	case !FileExists(filepath.Join(dp, "chainstate", "CURRENT")):
+		return errors.New("invalid snapshot, missing the chainstate database (chainstate)")
+	}
+	return nil
+}
+
+// watchImport starts the daemon (if needed) and reports its progress while it
+// imports a bootstrap.dat, until the import is done.
+func (c *Coin) watchImport() error {
+	if c.daemonReady() != nil {
+		log.Printf("  Starting %s to import %s\n", c.daemonBin, bootstrapDatFile)
+		if err := c.StartDaemon(); err != nil {
+			return err
+		}
+	}
+
+	imported := filepath.Join(c.state.dataPath, bootstrapDatImported)
+	start, last := time.Now(), int64(-1)
+	for {
+		time.Sleep(importPollInterval)
+
+		var blocks int64
+		if rsp, err := c.DoJSONRPCCommand("getblockcount", nil); err == nil {
+			if err := rsp.Decode(&blocks); err == nil && blocks != last {
+				rate := float64(blocks) / time.Since(start).Seconds()
+				log.Printf("  Imported %d blocks (%.0f blocks/s)\n", blocks, rate)
+				last = blocks
+			}
+		}
+		if FileExists(imported) {
+			log.Printf("  Import of %s done after %s\n", bootstrapDatFile, time.Since(start).Round(time.Second))
+			return nil
+		}
+		if !FileExists(filepath.Join(c.state.dataPath, bootstrapDatFile)) {
+			return fmt.Errorf("%s disappeared before it was imported", bootstrapDatFile)
+		}
+	}
+}
+
+// installBootstrap moves the extracted bootstrap in `stage` into the data
+// directory.  `existing` chain data, and anything else the bootstrap would
+// replace, is moved aside if `force` is set.
+func (c *Coin) installBootstrap(stage string, existing []string, force bool) error {
+	dataPath := c.state.dataPath
+	keep := c.keepFiles()
+
+	fis, err := ioutil.ReadDir(stage)
+	if err != nil {
+		return err
+	}
+	install := []string{}
+	for _, fi := range fis {
+		name := fi.Name()
+		if keep[name] {
+			log.Printf("  Warning: Bootstrap contains %s, keeping the existing one\n", name)
+			continue
+		}
+		install = append(install, name)
+
+		if _, err := os.Lstat(filepath.Join(dataPath, name)); err == nil && !contains(existing, name) {
+			existing = append(existing, name)
+		}
+	}
+	if len(existing) > 0 && !force {
+		return fmt.Errorf("bootstrap would replace %v in %s (use --force to back them up)", existing, dataPath)
+	}
+
+	// Should any step fail, whatever was done so far is undone so that the
+	// data directory is left as we found it.
+	backups := map[string]string{}
+	installed := []string{}
+	rollback := func(err error) error {
+		for _, name := range installed {
+			os.Rename(filepath.Join(dataPath, name), filepath.Join(stage, name))
+		}
+		for name, bp := range backups {
+			os.Rename(bp, filepath.Join(dataPath, name))
+		}
+		return err
+	}
+
+	for _, name := range existing {
+		bp, err := MoveAside(filepath.Join(dataPath, name))
+		if err != nil {
+			return rollback(err)
+		}
+		backups[name] = bp
+		log.Printf("  Moved existing %s aside to %s\n", name, filepath.Base(bp))
+	}
+	for _, name := range install {
+		if err := os.Rename(filepath.Join(stage, name), filepath.Join(dataPath, name)); err != nil {
+			return rollback(err)
+		}
+		installed = append(installed, name)
+	}
+	log.Printf("  Bootstrap installed into %s\n", dataPath)
+	return nil
+}
+
+func contains(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,315 @@
+package coin
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sabhiram/gomn/coin/cointest"
+	"github.com/sabhiram/gomn/types"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// newBootstrapCoin returns a test coin whose bootstrap is a .tar.gz of
+// `entries`.
+func newBootstrapCoin(t *testing.T, entries []cointest.Entry) *Coin {
+	bs, err := cointest.TarGz(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := serveFiles(t, map[string][]byte{"/bootstrap.tar.gz": bs})
+	c := newTestCoin(t, "user", "secret", freePort(t))
+	c.bootstrapDownloader = NewBootstrapDownloader(s.URL+"/bootstrap.tar.gz", "")
+	return c
+}
+
+// writeFiles creates `files` (name -> contents) under `dp`.
+func writeFiles(t *testing.T, dp string, files map[string]string) {
+	for name, body := range files {
+		fp := filepath.Join(dp, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(fp), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(fp, []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// checkFiles checks the contents of `files` (name -> contents) under `dp`.
+func checkFiles(t *testing.T, dp string, files map[string]string) {
+	t.Helper()
+	for name, body := range files {
+		bs, err := ioutil.ReadFile(filepath.Join(dp, filepath.FromSlash(name)))
+		if err != nil {
+			t.Errorf("%s: %s", name, err.Error())
+		} else if string(bs) != body {
+			t.Errorf("%s contains %q, expected %q", name, bs, body)
+		}
+	}
+}
+
+// backups returns the backups of `name` in `dp`.
+func backups(dp, name string) []string {
+	ret, _ := filepath.Glob(filepath.Join(dp, name+".backup-*"))
+	return ret
+}
+
+// chainEntries is a snapshot of the chain, and a wallet which must not replace
+// the user's.
+var chainEntries = []cointest.Entry{
+	{Name: "blocks", Mode: os.ModeDir | 0700},
+	{Name: "blocks/blk00000.dat", Body: "new blocks", Mode: 0600},
+	{Name: "blocks/index", Mode: os.ModeDir | 0700},
+	{Name: "blocks/index/CURRENT", Body: "MANIFEST-000001", Mode: 0600},
+	{Name: "chainstate", Mode: os.ModeDir | 0700},
+	{Name: "chainstate/000001.ldb", Body: "new chainstate", Mode: 0600},
+	{Name: "chainstate/CURRENT", Body: "MANIFEST-000001", Mode: 0600},
+	{Name: "wallet.dat", Body: "someone else's wallet", Mode: 0600},
+}
+
+// snapshotFiles is a minimal valid snapshot, for writeFiles.
+var snapshotFiles = map[string]string{
+	"blocks/blk00000.dat":  "blocks",
+	"blocks/index/CURRENT": "MANIFEST-000001",
+	"chainstate/CURRENT":   "MANIFEST-000001",
+}
+
+// prefixed returns `files` moved into the directory `prefix`, with `extra`
+// files added.
+func prefixed(prefix string, files map[string]string, extra map[string]string) map[string]string {
+	ret := map[string]string{}
+	for name, body := range files {
+		ret[filepath.Join(prefix, name)] = body
+	}
+	for name, body := range extra {
+		ret[name] = body
+	}
+	return ret
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func TestDownloadBootstrap(t *testing.T) {
+	c := newBootstrapCoin(t, chainEntries)
+	dp := c.GetDataPath()
+	if err := c.DownloadBootstrap(nil, &types.Bootstrap{}); err != nil {
+		t.Fatal(err)
+	}
+	checkFiles(t, dp, map[string]string{
+		"blocks/blk00000.dat":   "new blocks",
+		"chainstate/000001.ldb": "new chainstate",
+	})
+	if FileExists(filepath.Join(dp, "wallet.dat")) {
+		t.Error("bootstrap installed a wallet.dat")
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(dp, ".bootstrap-*")); len(leftovers) > 0 {
+		t.Errorf("staging left behind: %v", leftovers)
+	}
+}
+
+func TestDownloadBootstrapForce(t *testing.T) {
+	c := newBootstrapCoin(t, chainEntries)
+	dp := c.GetDataPath()
+	mine := map[string]string{
+		"blocks/blk00000.dat":   "old blocks",
+		"chainstate/000001.ldb": "old chainstate",
+		"wallet.dat":            "my wallet",
+		"masternode.conf":       "mn1 127.0.0.1:51472 KEY TX 0",
+	}
+	writeFiles(t, dp, mine)
+	conf, _ := ioutil.ReadFile(c.GetConfFilePath())
+
+	// Without --force, existing chain data is left alone.
+	err := c.DownloadBootstrap(nil, &types.Bootstrap{})
+	if err == nil || !strings.Contains(err.Error(), "--force") {
+		t.Fatalf("err = %v, expected a hint to use --force", err)
+	}
+	checkFiles(t, dp, mine)
+
+	// With it, the chain data is moved aside, the user's files are kept.
+	if err := c.DownloadBootstrap(nil, &types.Bootstrap{Force: true}); err != nil {
+		t.Fatal(err)
+	}
+	checkFiles(t, dp, map[string]string{
+		"blocks/blk00000.dat":   "new blocks",
+		"chainstate/000001.ldb": "new chainstate",
+		"wallet.dat":            "my wallet",
+		"masternode.conf":       mine["masternode.conf"],
+		"pivx.conf":             string(conf),
+	})
+	for _, name := range []string{"blocks", "chainstate"} {
+		bps := backups(dp, name)
+		if len(bps) != 1 {
+			t.Fatalf("%d backups of %s, expected 1", len(bps), name)
+		}
+		checkFiles(t, bps[0], map[string]map[string]string{
+			"blocks":     {"blk00000.dat": "old blocks"},
+			"chainstate": {"000001.ldb": "old chainstate"},
+		}[name])
+	}
+}
+
+func TestDownloadBootstrapDaemonRunning(t *testing.T) {
+	_, c := newTestDaemon(t)
+	if err := c.DownloadBootstrap(nil, &types.Bootstrap{Force: true}); err != ErrDaemonRunning {
+		t.Errorf("err = %v, expected %v", err, ErrDaemonRunning)
+	}
+}
+
+func TestDownloadWalletForce(t *testing.T) {
+	_, c := newWalletCoin(t, walletRelease(t, "1.0.0", nil))
+	if err := c.DownloadWallet(nil, &types.Download{Version: "1.0.0"}); err != nil {
+		t.Fatal(err)
+	}
+	wv, _ := LoadWalletVersions(c.state.walletPath)
+	marker := filepath.Join(wv.Dir("1.0.0"), "marker")
+	writeFiles(t, wv.Dir("1.0.0"), map[string]string{"marker": "old install"})
+
+	if err := c.DownloadWallet(nil, &types.Download{Version: "1.0.0"}); err == nil || !strings.Contains(err.Error(), "--force") {
+		t.Fatalf("err = %v, expected a hint to use --force", err)
+	}
+	if err := c.DownloadWallet(nil, &types.Download{Version: "1.0.0", Force: true}); err != nil {
+		t.Fatal(err)
+	}
+	if FileExists(marker) {
+		t.Error("reinstall kept the old install's files")
+	}
+	bps := backups(filepath.Dir(wv.Dir("1.0.0")), "1.0.0")
+	if len(bps) != 1 {
+		t.Fatalf("%d backups of the old install, expected 1", len(bps))
+	}
+	checkFiles(t, bps[0], map[string]string{"marker": "old install"})
+}
+
+func TestPrepareBootstrap(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		files     map[string]string // the extracted archive
+		typ       BootstrapType     // requested type
+		expected  BootstrapType     // "" => an error
+		installed []string          // what is moved to the install dir
+	}{
+		{"bootstrap.dat at the root", map[string]string{"bootstrap.dat": "dat"},
+			BootstrapAuto, BootstrapDat, []string{"bootstrap.dat"}},
+		{"nested bootstrap.dat", map[string]string{"pivx-chain/data/bootstrap.dat": "dat", "README": "hi"},
+			BootstrapAuto, BootstrapDat, []string{"bootstrap.dat"}},
+		{"snapshot at the root", prefixed("", snapshotFiles, map[string]string{"debug.log": "x", "wallets/wallet.dat": "w"}),
+			BootstrapAuto, BootstrapSnapshot, []string{"blocks", "chainstate"}},
+		{"snapshot one level down", prefixed("PIVX", snapshotFiles, map[string]string{"PIVX/peers.dat": "x"}),
+			BootstrapAuto, BootstrapSnapshot, []string{"blocks", "chainstate"}},
+		{"snapshot preferred to bootstrap.dat", prefixed("", snapshotFiles, map[string]string{"bootstrap.dat": "dat"}),
+			BootstrapAuto, BootstrapSnapshot, []string{"blocks", "chainstate"}},
+		{"bootstrap.dat requested next to a snapshot", prefixed("", snapshotFiles, map[string]string{"bootstrap.dat": "dat"}),
+			BootstrapDat, BootstrapDat, []string{"bootstrap.dat"}},
+		{"snapshot requested, only a bootstrap.dat", map[string]string{"bootstrap.dat": "dat"},
+			BootstrapSnapshot, "", nil},
+		{"bootstrap.dat requested, only a snapshot", snapshotFiles,
+			BootstrapDat, "", nil},
+		{"neither", map[string]string{"README": "hi"},
+			BootstrapAuto, "", nil},
+	} {
+		stage, src := t.TempDir(), t.TempDir()
+		writeFiles(t, stage, tc.files)
+
+		typ, err := prepareBootstrap(stage, src, tc.typ)
+		switch {
+		case len(tc.expected) == 0 && err == nil:
+			t.Errorf("%s: prepared a %s bootstrap, expected an error", tc.name, typ)
+			continue
+		case len(tc.expected) == 0:
+			continue
+		case err != nil:
+			t.Errorf("%s: %s", tc.name, err.Error())
+			continue
+		case typ != tc.expected:
+			t.Errorf("%s: type = %s, expected %s", tc.name, typ, tc.expected)
+		}
+
+		fis, _ := ioutil.ReadDir(src)
+		installed := []string{}
+		for _, fi := range fis {
+			installed = append(installed, fi.Name())
+		}
+		if strings.Join(installed, ",") != strings.Join(tc.installed, ",") {
+			t.Errorf("%s: installing %v, expected %v", tc.name, installed, tc.installed)
+		}
+	}
+}
+
+func TestValidateSnapshot(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		missing string // file removed from a valid snapshot
+		errText string
+	}{
+		{"valid", "", ""},
+		{"no block files", "blocks/blk00000.dat", "no block files"},
+		{"no block index", "blocks/index/CURRENT", "block index"},
+		{"no chainstate", "chainstate/CURRENT", "chainstate database"},
+	} {
+		files := prefixed("", snapshotFiles, map[string]string{"blocks/rev00000.dat": "rev"})
+		delete(files, tc.missing)
+		dp := t.TempDir()
+		writeFiles(t, dp, files)
+		os.MkdirAll(filepath.Join(dp, "chainstate"), 0700)
+
+		err := validateSnapshot(dp)
+		switch {
+		case len(tc.errText) == 0 && err != nil:
+			t.Errorf("%s: %s", tc.name, err.Error())
+		case len(tc.errText) > 0 && (err == nil || !strings.Contains(err.Error(), tc.errText)):
+			t.Errorf("%s: err = %v, expected %q", tc.name, err, tc.errText)
+		}
+	}
+}
+
+func TestDownloadBootstrapSnapshotAtRoot(t *testing.T) {
+	// Loose files at the root of the archive are not installed.
+	entries := append([]cointest.Entry{{Name: "debug.log", Body: "log", Mode: 0600}}, chainEntries...)
+	c := newBootstrapCoin(t, entries)
+	dp := c.GetDataPath()
+	if err := c.DownloadBootstrap(nil, &types.Bootstrap{Mode: "snapshot"}); err != nil {
+		t.Fatal(err)
+	}
+	checkFiles(t, dp, map[string]string{"blocks/blk00000.dat": "new blocks"})
+	if FileExists(filepath.Join(dp, "debug.log")) {
+		t.Error("snapshot installed a loose file")
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(dp, ".bootstrap-*")); len(leftovers) > 0 {
+		t.Errorf("staging left behind: %v", leftovers)
+	}
+}
+
+func TestInstallBootstrapRollback(t *testing.T) {
+	c := newTestCoin(t, "user", "secret", freePort(t))
+	dp := c.GetDataPath()
+
+	// The last thing in the way can not be moved aside, its backup name is
+	// too long.
+	long := strings.Repeat("x", 250)
+	mine := map[string]string{
+		"blocks/blk00000.dat":   "old blocks",
+		"chainstate/000001.ldb": "old chainstate",
+		long + "/file":          "old",
+	}
+	writeFiles(t, dp, mine)
+	stage := t.TempDir()
+	writeFiles(t, stage, prefixed("", snapshotFiles, map[string]string{long + "/file": "new"}))
+
+	if err := c.installBootstrap(stage, []string{"blocks", "chainstate"}, true); err == nil {
+		t.Fatal("installed a bootstrap which could not replace everything")
+	}
+	checkFiles(t, dp, mine)
+	checkFiles(t, stage, snapshotFiles)
+	if bps := append(backups(dp, "blocks"), backups(dp, "chainstate")...); len(bps) > 0 {
+		t.Errorf("backups left behind: %v", bps)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
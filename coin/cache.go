@@ -0,0 +1,410 @@
+package coin
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+const (
+	defaultCacheMax = 5 << 30 // bytes, used until `gomn cache max` is set
+	cacheConfigFile = "cache.json"
+)
+
+var (
+	errCacheMiss = errors.New("not in the download cache")
+
+	// cacheDir is where the download cache is kept, see CacheDir.
+	cacheDir = filepath.Join(GomnDir(), "cache")
+
+	// linkFile hardlinks files into and out of the cache, they are copied
+	// when it fails (ex: the cache is on another filesystem).
+	linkFile = os.Link
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// CacheDir returns the directory holding the download cache.  Verified
+// downloads are stored by their sha256, so the same file is only downloaded
+// once no matter how many nodes are provisioned from it.
+func CacheDir() string {
+	return cacheDir
+}
+
+// CacheEntry describes a file in the download cache.
+type CacheEntry struct {
+	Sha256   string    `json:"sha256"`
+	Sha512   string    `json:"sha512,omitempty"` // if the file was verified against one
+	URL      string    `json:"url"`              // where the file was downloaded from
+	Size     int64     `json:"size"`
+	Added    time.Time `json:"added"`
+	LastUsed time.Time `json:"last_used"`
+}
+
+func (e *CacheEntry) path() string {
+	return filepath.Join(CacheDir(), e.Sha256)
+}
+
+func (e *CacheEntry) metaPath() string {
+	return e.path() + ".json"
+}
+
+func (e *CacheEntry) save() error {
+	bs, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(e.metaPath(), bs, 0644)
+}
+
+func (e *CacheEntry) remove() error {
+	os.Remove(e.metaPath())
+	return os.Remove(e.path())
+}
+
+// CacheEntries returns the files in the download cache, least recently used
+// first.
+func CacheEntries() ([]*CacheEntry, error) {
+	fps, err := filepath.Glob(filepath.Join(CacheDir(), "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	ret := []*CacheEntry{}
+	for _, fp := range fps {
+		if filepath.Base(fp) == cacheConfigFile {
+			continue
+		}
+		bs, err := ioutil.ReadFile(fp)
+		if err != nil {
+			continue
+		}
+		e := &CacheEntry{}
+		if err := json.Unmarshal(bs, e); err != nil || !FileExists(e.path()) {
+			continue
+		}
+		ret = append(ret, e)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].LastUsed.Before(ret[j].LastUsed)
+	})
+	return ret, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// cacheConfig is persisted in the cache directory.
+type cacheConfig struct {
+	MaxSize int64 `json:"max_size"` // bytes, 0 => no limit
+}
+
+func loadCacheConfig() *cacheConfig {
+	cc := &cacheConfig{MaxSize: defaultCacheMax}
+	if bs, err := ioutil.ReadFile(filepath.Join(CacheDir(), cacheConfigFile)); err == nil {
+		json.Unmarshal(bs, cc)
+	}
+	return cc
+}
+
+func (cc *cacheConfig) save() error {
+	if err := os.MkdirAll(CacheDir(), 0755); err != nil {
+		return err
+	}
+	bs, err := json.MarshalIndent(cc, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(CacheDir(), cacheConfigFile), bs, 0644)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// cacheLookup finds the file matching `cs` in the cache and places a copy of
+// it at `fp`.  The cached file is verified on the way, a bad entry is evicted.
+func cacheLookup(cs *Checksum, fp string) error {
+	var entry *CacheEntry
+	switch cs.Algo {
+	case "sha256":
+		entry = &CacheEntry{Sha256: cs.Sum}
+		if bs, err := ioutil.ReadFile(entry.metaPath()); err == nil {
+			json.Unmarshal(bs, entry)
+		}
+	default:
+		entries, err := CacheEntries()
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if cs.Algo == "sha512" && e.Sha512 == cs.Sum {
+				entry = e
+				break
+			}
+		}
+	}
+	if entry == nil || !FileExists(entry.path()) {
+		return errCacheMiss
+	}
+
+	// Link the cached file into place where possible, it is verified either
+	// way so that a corrupt entry is never used.
+	os.Remove(fp)
+	if err := linkFile(entry.path(), fp); err != nil {
+		if err := copyFile(entry.path(), fp); err != nil {
+			os.Remove(fp)
+			return err
+		}
+	}
+	if err := verifyLocal(fp, cs); err != nil {
+		log.Printf("  Warning: Evicting corrupt cache entry %s\n", entry.Sha256)
+		entry.remove()
+		os.Remove(fp)
+		return errCacheMiss
+	}
+
+	entry.LastUsed = time.Now()
+	entry.save()
+	return nil
+}
+
+// cacheStore adds the verified download at `fp` to the cache.  `sha256sum` is
+// its sha256, `cs` what it was verified against.  Failing to cache a file is
+// not fatal, the download itself succeeded.
+func cacheStore(fp, url, sha256sum string, cs *Checksum) {
+	st, err := os.Stat(fp)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(CacheDir(), 0755); err != nil {
+		log.Printf("  Warning: Unable to create cache directory: %s\n", err.Error())
+		return
+	}
+
+	now := time.Now()
+	e := &CacheEntry{
+		Sha256:   sha256sum,
+		URL:      url,
+		Size:     st.Size(),
+		Added:    now,
+		LastUsed: now,
+	}
+	if cs.Algo == "sha512" {
+		e.Sha512 = cs.Sum
+	}
+
+	// Link the file into the cache where possible, it is usually on the same
+	// filesystem as the download directory.
+	os.Remove(e.path())
+	if err := linkFile(fp, e.path()); err != nil {
+		if err := copyFile(fp, e.path()); err != nil {
+			log.Printf("  Warning: Unable to cache %s: %s\n", fp, err.Error())
+			os.Remove(e.path())
+			return
+		}
+	}
+	if err := e.save(); err != nil {
+		log.Printf("  Warning: Unable to cache %s: %s\n", fp, err.Error())
+		os.Remove(e.path())
+		return
+	}
+
+	if _, err := pruneCache(loadCacheConfig().MaxSize); err != nil {
+		log.Printf("  Warning: Unable to prune cache: %s\n", err.Error())
+	}
+}
+
+// pruneCache evicts the least recently used entries until the cache holds at
+// most `max` bytes (0 => no limit, < 0 => evict everything).  Returns the
+// evicted entries.
+func pruneCache(max int64) ([]*CacheEntry, error) {
+	entries, err := CacheEntries()
+	if err != nil || max == 0 {
+		return nil, err
+	}
+
+	var total int64
+	for _, e := range entries {
+		total += e.Size
+	}
+
+	evicted := []*CacheEntry{}
+	for _, e := range entries {
+		if max > 0 && total <= max {
+			break
+		}
+		if err := e.remove(); err != nil {
+			return evicted, err
+		}
+		total -= e.Size
+		evicted = append(evicted, e)
+	}
+	return evicted, nil
+}
+
+// copyFile copies `src` to `dst`.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, in); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// multiHash feeds every write to several hashes, its digest is the first's.
+type multiHash []hash.Hash
+
+func (m multiHash) Write(bs []byte) (int, error) {
+	for _, h := range m {
+		h.Write(bs)
+	}
+	return len(bs), nil
+}
+
+func (m multiHash) Sum(b []byte) []byte { return m[0].Sum(b) }
+func (m multiHash) Size() int           { return m[0].Size() }
+func (m multiHash) BlockSize() int      { return m[0].BlockSize() }
+
+func (m multiHash) Reset() {
+	for _, h := range m {
+		h.Reset()
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// ParseSize parses a size in bytes, optionally with a K, M, G or T suffix
+// (powers of 1024).
+func ParseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSuffix(strings.TrimSpace(s), "B"))
+	mult := int64(1)
+	if n := len(s); n > 0 {
+		if idx := strings.IndexByte("KMGT", s[n-1]); idx >= 0 {
+			mult = int64(1) << (10 * uint(idx+1))
+			s = s[:n-1]
+		}
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid size (%s)", s)
+	}
+	return int64(v * float64(mult)), nil
+}
+
+// FormatSize formats `n` bytes for humans, ex: "1.5G".
+func FormatSize(n int64) string {
+	const units = "KMGT"
+	if n < 1024 {
+		return fmt.Sprintf("%dB", n)
+	}
+	v, i := float64(n)/1024, 0
+	for v >= 1024 && i < len(units)-1 {
+		v /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.1f%c", v, units[i])
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// CacheCommand implements the "cache" command: list the cached downloads,
+// prune them, or set the maximum size of the cache.
+func CacheCommand(args []string) error {
+	sub := "list"
+	if len(args) > 0 {
+		sub, args = strings.ToLower(args[0]), args[1:]
+	}
+
+	cc := loadCacheConfig()
+	switch sub {
+	case "list":
+		entries, err := CacheEntries()
+		if err != nil {
+			return err
+		}
+		var total int64
+		fmt.Printf("Download cache in %s:\n", CacheDir())
+		for i := len(entries) - 1; i >= 0; i-- {
+			e := entries[i]
+			total += e.Size
+			fmt.Printf("  %s  %8s  used %s  %s\n", e.Sha256[:16], FormatSize(e.Size),
+				e.LastUsed.Format("2006-01-02 15:04"), e.URL)
+		}
+		max := "unlimited"
+		if cc.MaxSize > 0 {
+			max = FormatSize(cc.MaxSize)
+		}
+		fmt.Printf("%d files, %s of %s\n", len(entries), FormatSize(total), max)
+		return nil
+
+	case "prune":
+		fs := flag.NewFlagSet("cache-prune", flag.ContinueOnError)
+		maxStr := fs.String("max-size", "", "prune down to this size (default: the cache's maximum size)")
+		all := fs.Bool("all", false, "remove everything from the cache")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+
+		max := cc.MaxSize
+		switch {
+		case *all:
+			max = -1
+		case len(*maxStr) > 0:
+			v, err := ParseSize(*maxStr)
+			if err != nil {
+				return err
+			}
+			if max = v; max == 0 {
+				max = -1
+			}
+		}
+		evicted, err := pruneCache(max)
+		for _, e := range evicted {
+			fmt.Printf("Removed %s (%s) %s\n", e.Sha256[:16], FormatSize(e.Size), e.URL)
+		}
+		return err
+
+	case "max":
+		if len(args) != 1 {
+			return errors.New("expected 'cache max SIZE' (0 => unlimited)")
+		}
+		v, err := ParseSize(args[0])
+		if err != nil {
+			return err
+		}
+		cc.MaxSize = v
+		if err := cc.save(); err != nil {
+			return err
+		}
+		_, err = pruneCache(cc.MaxSize)
+		return err
+	}
+	return fmt.Errorf("invalid cache command, expected 'list', 'prune' or 'max SIZE'")
+}
+
+////////////////////////////////////////////////////////////////////////////////
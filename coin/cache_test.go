@@ -0,0 +1,241 @@
+package coin
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// TestMain keeps the downloads made by the tests out of the user's cache.
+func TestMain(m *testing.M) {
+	dp, err := ioutil.TempDir("", "gomn-cache-")
+	if err != nil {
+		panic(err)
+	}
+	cacheDir = dp
+	code := m.Run()
+	os.RemoveAll(dp)
+	os.Exit(code)
+}
+
+// emptyCache gives the test a cache of its own.
+func emptyCache(t *testing.T) {
+	defer func(dp string) {
+		t.Cleanup(func() { cacheDir = dp })
+	}(cacheDir)
+	cacheDir = t.TempDir()
+}
+
+// cacheFile stores `body` in the cache as if it was downloaded from `url`,
+// and returns its checksum.
+func cacheFile(t *testing.T, url string, body []byte) *Checksum {
+	fp := filepath.Join(t.TempDir(), baseName(url))
+	if err := ioutil.WriteFile(fp, body, 0644); err != nil {
+		t.Fatal(err)
+	}
+	cs := &Checksum{Algo: "sha256", Sum: sha256Hex(body)}
+	cacheStore(fp, url, cs.Sum, cs)
+	return cs
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func TestParseSize(t *testing.T) {
+	for _, tc := range []struct {
+		s        string
+		expected int64
+		ok       bool
+	}{
+		{"0", 0, true},
+		{"512", 512, true},
+		{"512B", 512, true},
+		{"10K", 10 << 10, true},
+		{"1.5m", 3 << 19, true},
+		{" 5G ", 5 << 30, true},
+		{"2TB", 2 << 40, true},
+		{"", 0, false},
+		{"G", 0, false},
+		{"-1G", 0, false},
+		{"10X", 0, false},
+	} {
+		v, err := ParseSize(tc.s)
+		switch {
+		case tc.ok && err != nil:
+			t.Errorf("%q: %s", tc.s, err.Error())
+		case !tc.ok && err == nil:
+			t.Errorf("%q: parsed as %d, expected an error", tc.s, v)
+		case tc.ok && v != tc.expected:
+			t.Errorf("%q: %d, expected %d", tc.s, v, tc.expected)
+		}
+	}
+
+	for n, expected := range map[int64]string{
+		100:             "100B",
+		1536:            "1.5K",
+		5 << 30:         "5.0G",
+		3 << 40:         "3.0T",
+		(1 << 50) + 100: "1024.0T",
+	} {
+		if s := FormatSize(n); s != expected {
+			t.Errorf("FormatSize(%d) = %s, expected %s", n, s, expected)
+		}
+	}
+}
+
+func TestCacheLookup(t *testing.T) {
+	emptyCache(t)
+	body := testBody(5000)
+	cs := cacheFile(t, "https://example.com/pivx.tar.gz", body)
+
+	fp := filepath.Join(t.TempDir(), "pivx.tar.gz")
+	if err := cacheLookup(cs, fp); err != nil {
+		t.Fatal(err)
+	}
+	if bs, _ := ioutil.ReadFile(fp); string(bs) != string(body) {
+		t.Error("cache hit does not match the cached file")
+	}
+
+	// Entries are found by sha512 too, if that is what they were verified
+	// against.
+	sum := sha512.Sum512(body)
+	cs512 := &Checksum{Algo: "sha512", Sum: hex.EncodeToString(sum[:])}
+	if err := cacheLookup(cs512, fp); err != errCacheMiss {
+		t.Errorf("sha512 lookup of a file stored by sha256: err = %v, expected a miss", err)
+	}
+	cacheStore(fp, "https://example.com/pivx.tar.gz", cs.Sum, cs512)
+	if err := cacheLookup(cs512, filepath.Join(t.TempDir(), "pivx.tar.gz")); err != nil {
+		t.Errorf("sha512 lookup: %s", err.Error())
+	}
+
+	if err := cacheLookup(&Checksum{Algo: "sha256", Sum: sha256Hex([]byte("other"))}, fp); err != errCacheMiss {
+		t.Errorf("err = %v, expected a miss", err)
+	}
+
+	// A corrupt entry is evicted rather than used.
+	entry := &CacheEntry{Sha256: cs.Sum}
+	os.Remove(entry.path())
+	ioutil.WriteFile(entry.path(), []byte("corrupt"), 0644)
+	if err := cacheLookup(cs, filepath.Join(t.TempDir(), "pivx.tar.gz")); err != errCacheMiss {
+		t.Errorf("corrupt entry: err = %v, expected a miss", err)
+	}
+	if FileExists(entry.path()) || FileExists(entry.metaPath()) {
+		t.Error("corrupt entry not evicted")
+	}
+}
+
+func TestCacheLinks(t *testing.T) {
+	emptyCache(t)
+	defer func() { linkFile = os.Link }()
+	body := testBody(5000)
+
+	for _, link := range []bool{true, false} {
+		if !link {
+			linkFile = func(string, string) error { return errors.New("cross-device link") }
+		}
+		dp := t.TempDir()
+		src, dst := filepath.Join(dp, "src"), filepath.Join(dp, "dst")
+		ioutil.WriteFile(src, body, 0644)
+		cs := &Checksum{Algo: "sha256", Sum: sha256Hex(body)}
+		cacheStore(src, "https://example.com/src", cs.Sum, cs)
+		if err := cacheLookup(cs, dst); err != nil {
+			t.Fatal(err)
+		}
+
+		stSrc, _ := os.Stat(src)
+		stDst, _ := os.Stat(dst)
+		if os.SameFile(stSrc, stDst) != link {
+			t.Errorf("link %v: cache hit is the same file as the download: %v", link, !link)
+		}
+		if bs, _ := ioutil.ReadFile(dst); string(bs) != string(body) {
+			t.Errorf("link %v: cache hit does not match the download", link)
+		}
+		pruneCache(-1)
+	}
+}
+
+func TestPruneCache(t *testing.T) {
+	emptyCache(t)
+	old := time.Now().Add(-time.Hour)
+	for i, name := range []string{"a", "b", "c"} {
+		cacheFile(t, "https://example.com/"+name, testBody(1000+i))
+	}
+	entries, _ := CacheEntries()
+	for i, e := range entries {
+		e.LastUsed = old.Add(time.Duration(len(entries)-i) * time.Minute)
+		e.save()
+	}
+	// Order is now c (oldest), b, a.
+	entries, _ = CacheEntries()
+	if len(entries) != 3 || entries[0].URL != "https://example.com/c" || entries[2].URL != "https://example.com/a" {
+		t.Fatalf("entries not ordered least recently used first")
+	}
+
+	if evicted, _ := pruneCache(0); len(evicted) != 0 {
+		t.Errorf("no limit evicted %d entries", len(evicted))
+	}
+	evicted, err := pruneCache(2100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(evicted) != 1 || evicted[0].URL != "https://example.com/c" {
+		t.Errorf("pruning to 2100 bytes evicted %d entries, expected the least recently used", len(evicted))
+	}
+	if evicted, _ = pruneCache(-1); len(evicted) != 2 {
+		t.Errorf("pruning everything evicted %d entries, expected 2", len(evicted))
+	}
+	if entries, _ = CacheEntries(); len(entries) != 0 {
+		t.Errorf("%d entries left", len(entries))
+	}
+
+	// Storing beyond the maximum size prunes the cache.
+	if err := CacheCommand([]string{"max", "2K"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a", "b", "c"} {
+		cacheFile(t, "https://example.com/"+name, testBody(1000))
+	}
+	if entries, _ = CacheEntries(); len(entries) != 1 || entries[0].URL != "https://example.com/c" {
+		t.Errorf("%d entries over the maximum size, expected the most recent", len(entries))
+	}
+}
+
+func TestDownloadCached(t *testing.T) {
+	emptyCache(t)
+	body := testBody(5000)
+	fs := newFileServer(t, body, "")
+	url := fs.URL + "/pivx.tar.gz"
+
+	// The second download of a file is served from the cache, without
+	// asking the server.
+	for i := 0; i < 2; i++ {
+		fp, cleanup, err := fetchFromMirrors(url, nil, false, sha256Hex(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkFile(t, fp, body)
+		cleanup()
+	}
+	if n := len(fs.requests()); n != 1 {
+		t.Errorf("%d requests, expected 1", n)
+	}
+
+	// Nor is a download without a checksum.
+	fp := filepath.Join(t.TempDir(), "pivx.tar.gz")
+	if err := downloadURLToPath(url, fp, nil); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(fs.requests()); n != 2 {
+		t.Errorf("unverified download made %d requests, expected 2", n)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
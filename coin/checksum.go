@@ -0,0 +1,100 @@
+package coin
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Checksum is an expected digest for a download.
+type Checksum struct {
+	Algo string // "sha256" or "sha512"
+	Sum  string // lower case hex digest
+}
+
+// ParseChecksum parses a checksum of the form "[algo:]hexdigest".  If the algo
+// is omitted, it is inferred from the length of the digest.  An empty string
+// returns a nil checksum (nothing to verify).
+func ParseChecksum(s string) (*Checksum, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if len(s) == 0 {
+		return nil, nil
+	}
+
+	algo := ""
+	if idx := strings.IndexByte(s, ':'); idx >= 0 {
+		algo, s = s[:idx], s[idx+1:]
+	}
+	if _, err := hex.DecodeString(s); err != nil {
+		return nil, fmt.Errorf("invalid checksum (%s), expected a hex digest", s)
+	}
+
+	switch {
+	case algo == "" && len(s) == sha256.Size*2:
+		algo = "sha256"
+	case algo == "" && len(s) == sha512.Size*2:
+		algo = "sha512"
+	case algo == "":
+		return nil, fmt.Errorf("unable to infer checksum type from digest length (%d)", len(s))
+	}
+
+	c := &Checksum{Algo: algo, Sum: s}
+	h := c.New()
+	if h == nil {
+		return nil, fmt.Errorf("unsupported checksum type (%s)", algo)
+	}
+	if len(s) != h.Size()*2 {
+		return nil, fmt.Errorf("invalid %s checksum length (%d)", algo, len(s))
+	}
+	return c, nil
+}
+
+// New returns a new hash for the checksum's algorithm (nil if unsupported).
+func (c *Checksum) New() hash.Hash {
+	switch c.Algo {
+	case "sha256":
+		return sha256.New()
+	case "sha512":
+		return sha512.New()
+	}
+	return nil
+}
+
+// Verify returns an error if the digest in `h` does not match the checksum.
+func (c *Checksum) Verify(h hash.Hash) error {
+	sum := hex.EncodeToString(h.Sum(nil))
+	if sum != c.Sum {
+		return fmt.Errorf("%s for download (%s) does not match expected (%s)", c.Algo, sum, c.Sum)
+	}
+	return nil
+}
+
+// String implements the Stringer interface.
+func (c *Checksum) String() string {
+	return c.Algo + ":" + c.Sum
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// hashFile feeds the contents of the file at `fp` into `h`.
+func hashFile(fp string, h hash.Hash) error {
+	f, err := os.Open(fp)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(h, f)
+	return err
+}
+
+////////////////////////////////////////////////////////////////////////////////
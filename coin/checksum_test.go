@@ -0,0 +1,116 @@
+package coin
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+func TestParseChecksum(t *testing.T) {
+	body := []byte("wallet")
+	s256, s512 := sha256.Sum256(body), sha512.Sum512(body)
+	hex256, hex512 := hex.EncodeToString(s256[:]), hex.EncodeToString(s512[:])
+
+	for _, tc := range []struct {
+		in   string
+		algo string // "" => nil checksum
+		err  bool
+	}{
+		{"", "", false},
+		{"  ", "", false},
+		{hex256, "sha256", false},
+		{strings.ToUpper(hex256), "sha256", false},
+		{"sha256:" + hex256, "sha256", false},
+		{" SHA256:" + hex256 + "\n", "sha256", false},
+		{hex512, "sha512", false},
+		{"sha512:" + hex512, "sha512", false},
+		{"sha512:" + hex256, "", true},   // wrong length for the algo
+		{"sha256:" + hex512, "", true},   // wrong length for the algo
+		{"md5:" + hex256[:32], "", true}, // unsupported algo
+		{hex256[:40], "", true},          // length matches no algo
+		{"zz" + hex256[2:], "", true},    // not hex
+		{hex256[1:], "", true},           // odd length
+	} {
+		cs, err := ParseChecksum(tc.in)
+		switch {
+		case tc.err && err == nil:
+			t.Errorf("%q: parsed as %v, expected an error", tc.in, cs)
+		case !tc.err && err != nil:
+			t.Errorf("%q: %s", tc.in, err.Error())
+		case tc.err:
+		case len(tc.algo) == 0 && cs != nil:
+			t.Errorf("%q: parsed as %v, expected nil", tc.in, cs)
+		case len(tc.algo) > 0 && (cs == nil || cs.Algo != tc.algo):
+			t.Errorf("%q: parsed as %v, expected %s", tc.in, cs, tc.algo)
+		}
+	}
+
+	for sum, algo := range map[string]string{hex256: "sha256", hex512: "sha512"} {
+		cs, _ := ParseChecksum(sum)
+		h := cs.New()
+		h.Write(body)
+		if err := cs.Verify(h); err != nil {
+			t.Errorf("%s: %s", algo, err.Error())
+		}
+		h = cs.New()
+		h.Write([]byte("tampered"))
+		if err := cs.Verify(h); err == nil {
+			t.Errorf("%s: tampered body verified", algo)
+		}
+	}
+}
+
+func TestFetchAndVerify(t *testing.T) {
+	body := testBody(5000)
+	sum := sha512.Sum512(body)
+	fs := newFileServer(t, body, `"v1"`)
+
+	fp := filepath.Join(t.TempDir(), "wallet.tar.gz")
+	if err := fetchAndVerify(fs.URL, fp, "sha512:"+hex.EncodeToString(sum[:])); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, fp, body)
+
+	// A mismatching download is removed, so the next attempt starts over
+	// rather than resuming a bad file.
+	fp = filepath.Join(t.TempDir(), "wallet.tar.gz")
+	bad := sha256.Sum256([]byte("something else"))
+	err := fetchAndVerify(fs.URL, fp, hex.EncodeToString(bad[:]))
+	if err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Fatalf("err = %v, expected a checksum mismatch", err)
+	}
+	for _, f := range []string{fp, fp + ".part", fp + ".part.json"} {
+		if FileExists(f) {
+			t.Errorf("%s left behind after a checksum mismatch", f)
+		}
+	}
+
+	// A mismatching partial file is removed too.
+	fs.handle = func(w http.ResponseWriter, r *http.Request, n int) bool {
+		fs.interrupt(w, 1000)
+		return true
+	}
+	fp = filepath.Join(t.TempDir(), "wallet.tar.gz")
+	if err := fetchURLToPath(fs.URL, fp, nil); err == nil {
+		t.Fatal("interrupted download succeeded")
+	}
+	fs.handle = nil
+	if err := fetchAndVerify(fs.URL, fp, hex.EncodeToString(bad[:])); err == nil {
+		t.Fatal("resumed download with a bad checksum verified")
+	}
+	for _, f := range []string{fp, fp + ".part", fp + ".part.json"} {
+		if FileExists(f) {
+			t.Errorf("%s left behind after a checksum mismatch", f)
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -10,7 +10,11 @@ package coin
 import (
 	"errors"
 	"fmt"
+	"log"
+	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/sabhiram/gomn/types"
 )
@@ -28,6 +32,7 @@ var (
 type CoinState struct {
 	walletPath       string // path where the wallet will exist
 	walletPathExists bool   // true if the above path exists
+	walletVersion    string // active wallet version (empty if not managed by gomn)
 	binPath          string // path where the bins will exist
 	binPathExists    bool   // true if the above path exists
 	daemonBinPath    string // populated if the daemon binary exists at the specified path
@@ -39,7 +44,9 @@ type CoinState struct {
 	dataPathExists   bool              // true if the above path exists
 	configFilePath   string            // path to config file
 	configFileExists bool              // true if the above file exists
-	config           map[string]string // k-v map of `coin`.conf file
+	conf             *ConfDoc          // the `coin`.conf file (and its includes)
+	config           map[string]string // k-v map of the conf file for its network
+	confReported     string            // conf problems last reported by UpdateDynamic
 }
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -83,16 +90,27 @@ func (c *Coin) UpdateDynamic(wallet, subpath, data string) error {
 	////////////////////////////////////////////////////////////
 
 	c.state.walletPath = c.defaultWalletPath
-	if len(subpath) > 0 {
-		c.state.walletPath = subpath
+	if len(wallet) > 0 {
+		c.state.walletPath = wallet
 	}
 	c.state.walletPathExists = DirExists(c.state.walletPath)
 
-	subpathToBins := c.defaultBinSubPath
+	// Bins are found through the active wallet version (if gomn installed
+	// one), unless the user overrides the subpath.
+	c.state.walletVersion = ""
+	c.state.binPath = filepath.Join(c.state.walletPath, c.defaultBinSubPath)
 	if len(subpath) > 0 {
-		subpathToBins = subpath
+		c.state.binPath = filepath.Join(c.state.walletPath, subpath)
+	} else if wv, err := LoadWalletVersions(c.state.walletPath); err != nil {
+		return err
+	} else if len(wv.Current) > 0 {
+		bp, err := wv.BinPath(wv.Current)
+		if err != nil {
+			return err
+		}
+		c.state.walletVersion = wv.Current
+		c.state.binPath = bp
 	}
-	c.state.binPath = filepath.Join(c.state.walletPath, subpathToBins)
 	c.state.binPathExists = DirExists(c.state.binPath)
 
 	c.state.daemonBinPath = filepath.Join(c.state.binPath, c.daemonBin)
@@ -110,22 +128,53 @@ func (c *Coin) UpdateDynamic(wallet, subpath, data string) error {
 
 	c.state.dataPathExists = DirExists(c.state.dataPath)
 	c.state.configFilePath = filepath.Join(c.state.dataPath, c.configFile)
-	c.state.configFileExists = FileExists(c.state.configFilePath)
-	c.state.config = emptyMap
 
 	////////////////////////////////////////////////////////////
 
+	if err := c.loadConf(); err != nil {
+		return err
+	}
+	c.reportConfProblems()
+	return nil
+}
+
+// loadConf (re)loads the conf file, if there is one.
+func (c *Coin) loadConf() error {
+	c.state.configFileExists = FileExists(c.state.configFilePath)
+	c.state.conf = ParseConf(nil)
+	c.state.config = emptyMap
+
 	if c.state.configFileExists {
-		m, err := LoadConfFile(c.state.configFilePath)
+		d, err := LoadConfDoc(c.state.configFilePath)
 		if err != nil {
 			return err
 		}
-		c.state.config = m
+		c.state.conf = d
+		c.state.config = d.NetworkMap(d.Network())
 	}
+	return nil
+}
 
-	////////////////////////////////////////////////////////////
+// reportConfProblems logs what is wrong with the conf file (see ValidateConf)
+// as warnings, once for as long as the problems stay the same.
+func (c *Coin) reportConfProblems() {
+	problems := c.ValidateConf()
+	msgs := []string{}
+	for _, p := range problems {
+		msgs = append(msgs, p.String())
+	}
+	reported := strings.Join(msgs, "\n")
+	if reported == c.state.confReported {
+		return
+	}
+	c.state.confReported = reported
 
-	return nil
+	for _, msg := range msgs {
+		log.Printf("  Warning: %s: %s\n", c.state.configFilePath, msg)
+	}
+	if len(msgs) > 0 {
+		log.Printf("  See 'gomn config validate' for the details\n")
+	}
 }
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -180,6 +229,8 @@ func (c *Coin) GetRPCPort() int {
 	return c.rpcPort
 }
 
+// GetConfig returns the settings in the config file for the network it
+// selects (see GetNetwork), keys set more than once map to their first value.
 func (c *Coin) GetConfig() map[string]string {
 	if c == nil {
 		return emptyMap
@@ -187,8 +238,17 @@ func (c *Coin) GetConfig() map[string]string {
 	return c.state.config
 }
 
-// GetConfigValue returns the value for a given key in the config file.  Returns
-// an empty string if the key is not found.
+// GetNetwork returns the network the config file selects, "main", "test" or
+// "regtest".
+func (c *Coin) GetNetwork() string {
+	if c == nil || c.state == nil || c.state.conf == nil {
+		return NetworkMain
+	}
+	return c.state.conf.Network()
+}
+
+// GetConfigValue returns the value for a given key in the config file, for the
+// network it selects.  Returns an empty string if the key is not found.
 func (c *Coin) GetConfigValue(key string) string {
 	m := c.GetConfig()
 	if v, ok := m[key]; ok {
@@ -197,6 +257,30 @@ func (c *Coin) GetConfigValue(key string) string {
 	return ""
 }
 
+// GetConfigValues returns every value for a given key in the config file (ex:
+// "addnode"), for the network it selects.
+func (c *Coin) GetConfigValues(key string) []string {
+	return c.GetNetworkConfigValues(c.GetNetwork(), key)
+}
+
+// GetNetworkConfigValue returns the value for a given key in the config file
+// for `network`.  Returns an empty string if the key is not found.
+func (c *Coin) GetNetworkConfigValue(network, key string) string {
+	if vs := c.GetNetworkConfigValues(network, key); len(vs) > 0 {
+		return vs[0]
+	}
+	return ""
+}
+
+// GetNetworkConfigValues returns every value for a given key in the config
+// file for `network`, those in the network's section win over the others.
+func (c *Coin) GetNetworkConfigValues(network, key string) []string {
+	if c == nil || c.state == nil || c.state.conf == nil {
+		return []string{}
+	}
+	return c.state.conf.NetworkValues(network, key)
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 
 // PrintCoinInfo is a common function that can be used by all coin
@@ -210,7 +294,13 @@ func (c *Coin) PrintCoinInfo(prefix string) error {
 		return fmt.Sprintf("[ %s ] %s", st, s)
 	}
 
+	version := c.state.walletVersion
+	if len(version) == 0 {
+		version = "unmanaged"
+	}
+
 	fmt.Printf(`%s
+  * Wallet version:     %s
   * Base directory:     %s
   * Binary directory:   %s
   * Coin daemon binary: %s
@@ -219,6 +309,7 @@ func (c *Coin) PrintCoinInfo(prefix string) error {
   * Config file:        %s
 `,
 		prefix,
+		version,
 		phelper(c.state.walletPath, c.state.walletPathExists),
 		phelper(c.state.binPath, c.state.binPathExists),
 		phelper(c.state.daemonBinPath, c.state.daemonBinExists),
@@ -231,21 +322,101 @@ func (c *Coin) PrintCoinInfo(prefix string) error {
 
 ////////////////////////////////////////////////////////////////////////////////
 
+// DownloadWallet installs a version of the wallet alongside any others under
+// the wallet path.  The first version installed becomes the active one.
 func (c *Coin) DownloadWallet(args []string, override *types.Download) error {
-	if c.state.walletPathExists &&
-		c.state.binPathExists &&
-		c.state.daemonBinExists &&
-		c.state.statusBinExists {
-		return errors.New("wallet binary already exists (TODO: Add --force option)")
+	wv, err := LoadWalletVersions(c.state.walletPath)
+	if err != nil {
+		return err
 	}
-	return c.walletDownloader.DownloadToPath(c.state.walletPath, override)
+	version, err := c.installWallet(wv, override, false)
+	if err != nil {
+		return err
+	}
+
+	if len(wv.Current) == 0 {
+		if err := wv.Use(version); err != nil {
+			return err
+		}
+		log.Printf("  Now using %s wallet %s\n", c.name, version)
+	} else {
+		log.Printf("  Still using %s wallet %s, switch with 'gomn versions use %s'\n", c.name, wv.Current, version)
+	}
+	return nil
 }
 
-func (c *Coin) DownloadBootstrap(args []string, override *types.Bootstrap) error {
-	if c.state.dataPathExists {
-		return errors.New("wallet data already exists (TODO: add --force option)")
+// installWallet downloads and installs the wallet version described by
+// `override` (see WalletDownloader.Resolve), and returns its version.  If the
+// version is already installed, it is an error unless `reuse` is set.
+func (c *Coin) installWallet(wv *WalletVersions, override *types.Download, reuse bool) (string, error) {
+	// Fall back to a user provided keyring for the coin (if any).
+	if fp := filepath.Join(KeyringDir(), c.name+".asc"); len(override.Keyring) == 0 && FileExists(fp) {
+		override.Keyring = fp
+	}
+
+	w, err := c.walletDownloader.Resolve(override)
+	if err != nil {
+		return "", err
+	}
+	_, installed := wv.Versions[w.Version]
+	switch {
+	case installed && reuse:
+		log.Printf("  %s wallet %s is already installed\n", c.name, w.Version)
+		return w.Version, nil
+	case installed && !override.Force:
+		return "", fmt.Errorf("wallet version %s already installed (use --force to reinstall it)", w.Version)
+	}
+
+	// Extract into a staging directory next to the install, which is only
+	// renamed into place once the binaries are found in it.  A failed install
+	// leaves nothing behind.
+	dst := wv.Dir(w.Version)
+	stage, err := StagingDir(dst)
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(stage)
+
+	if err := w.DownloadToPath(stage, &types.Download{Keyring: override.Keyring}); err != nil {
+		return "", err
+	}
+	binSubPath := w.PathToBins
+	if len(binSubPath) == 0 {
+		binSubPath = c.defaultBinSubPath
+	}
+	if binSubPath, err = findBinDir(stage, c.daemonBin, binSubPath); err != nil {
+		return "", err
+	}
+	if len(c.statusBin) > 0 && !FileExists(filepath.Join(stage, binSubPath, c.statusBin)) {
+		return "", fmt.Errorf("unable to find %s next to %s in the installed wallet", c.statusBin, c.daemonBin)
+	}
+
+	// Anything in the way (a forced reinstall, or the remains of an old
+	// install) is moved aside rather than deleted.
+	backup := ""
+	if _, err := os.Lstat(dst); err == nil {
+		if backup, err = MoveAside(dst); err != nil {
+			return "", err
+		}
+		log.Printf("  Moved existing %s aside to %s\n", dst, backup)
+	}
+	if err := os.Rename(stage, dst); err != nil {
+		if len(backup) > 0 {
+			os.Rename(backup, dst)
+		}
+		return "", err
+	}
+
+	if err := wv.Add(&WalletVersion{
+		Version:    w.Version,
+		BinSubPath: binSubPath,
+		Source:     w.DownloadURL,
+		Installed:  time.Now(),
+	}); err != nil {
+		return "", err
 	}
-	return c.bootstrapDownloader.DownloadToPath(c.state.dataPath, override)
+	log.Printf("  Installed %s wallet %s, binaries are in %s\n", c.name, w.Version, filepath.Join(dst, binSubPath))
+	return w.Version, nil
 }
 
 ////////////////////////////////////////////////////////////////////////////////
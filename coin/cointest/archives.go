@@ -0,0 +1,224 @@
+package cointest
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Entry describes a single member of a generated archive.
+type Entry struct {
+	Name     string      // path within the archive
+	Body     string      // contents for regular files
+	Mode     os.FileMode // permissions, plus os.ModeDir / os.ModeSymlink
+	Linkname string      // target for symlinks and hardlinks
+	Hardlink bool        // true if this is a (tar) hardlink to `Linkname`
+	ModTime  time.Time   // modification time (zero => ArchiveTime)
+}
+
+// ArchiveTime is the modification time given to entries which do not specify
+// one, it is fixed so that extractors can be checked for preserving mtimes.
+var ArchiveTime = time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)
+
+func (e Entry) modTime() time.Time {
+	if e.ModTime.IsZero() {
+		return ArchiveTime
+	}
+	return e.ModTime
+}
+
+// TarGz builds a .tar.gz archive containing `entries` in order.
+func TarGz(entries []Entry) ([]byte, error) {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+
+	for _, e := range entries {
+		hdr := &tar.Header{
+			Name:    e.Name,
+			Mode:    int64(e.Mode.Perm()),
+			ModTime: e.modTime(),
+		}
+		switch {
+		case e.Hardlink:
+			hdr.Typeflag = tar.TypeLink
+			hdr.Linkname = e.Linkname
+		case e.Mode&os.ModeSymlink != 0:
+			hdr.Typeflag = tar.TypeSymlink
+			hdr.Linkname = e.Linkname
+		case e.Mode.IsDir():
+			hdr.Typeflag = tar.TypeDir
+		default:
+			hdr.Typeflag = tar.TypeReg
+			hdr.Size = int64(len(e.Body))
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			if _, err := tw.Write([]byte(e.Body)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Zip builds a .zip archive containing `entries` in order.  Hardlinks can not
+// be represented in a zip and are skipped.
+func Zip(entries []Entry) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	for _, e := range entries {
+		if e.Hardlink {
+			continue
+		}
+		hdr := &zip.FileHeader{
+			Name:     e.Name,
+			Method:   zip.Deflate,
+			Modified: e.modTime(),
+		}
+		hdr.SetMode(e.Mode)
+		body := e.Body
+		switch {
+		case e.Mode&os.ModeSymlink != 0:
+			body = e.Linkname
+		case e.Mode.IsDir():
+			hdr.Name += "/"
+			body = ""
+		}
+		w, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write([]byte(body)); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// WalletEntries returns a well formed wallet-like layout rooted at `root`:
+// executables for each of `bins` under "bin/", a versioned shared library
+// with a relative symlink to it, and a hardlinked copy of the first binary.
+func WalletEntries(root string, bins ...string) []Entry {
+	entries := []Entry{
+		{Name: root, Mode: os.ModeDir | 0755},
+		{Name: root + "/bin", Mode: os.ModeDir | 0755},
+		{Name: root + "/lib", Mode: os.ModeDir | 0750},
+		{Name: root + "/lib/libcoin.so.1", Body: "\x7fELF", Mode: 0644},
+		{Name: root + "/lib/libcoin.so", Mode: os.ModeSymlink | 0777, Linkname: "libcoin.so.1"},
+	}
+	for _, b := range bins {
+		entries = append(entries, Entry{Name: root + "/bin/" + b, Body: "#!/bin/sh\n", Mode: 0755})
+	}
+	if len(bins) > 0 {
+		entries = append(entries, Entry{
+			Name:     root + "/bin/" + bins[0] + "-link",
+			Hardlink: true,
+			Linkname: root + "/bin/" + bins[0],
+		})
+	}
+	return entries
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// MaliciousArchive is a crafted archive which a safe extractor must reject.
+// `Escape` names the file (relative to the parent of the extraction
+// directory) that the archive tries to create, link to or overwrite; it must
+// be left untouched whether or not it existed beforehand.
+type MaliciousArchive struct {
+	Name    string  // description of the attack
+	Entries []Entry // archive members, see TarGz and Zip
+	Escape  string  // path the attack targets, relative to the dst's parent
+}
+
+// MaliciousArchives returns the set of known attacks against extractors:
+// path traversal ("zip slip"), absolute paths, and writes or links through
+// symlinks and hardlinks which point outside of the destination.
+func MaliciousArchives() []MaliciousArchive {
+	return []MaliciousArchive{
+		{
+			Name:    "dot-dot traversal",
+			Entries: []Entry{{Name: "../evil", Body: "pwned", Mode: 0644}},
+			Escape:  "evil",
+		},
+		{
+			Name:    "nested dot-dot traversal",
+			Entries: []Entry{{Name: "bin/../../evil", Body: "pwned", Mode: 0644}},
+			Escape:  "evil",
+		},
+		{
+			Name:    "backslash traversal",
+			Entries: []Entry{{Name: `..\evil`, Body: "pwned", Mode: 0644}},
+			Escape:  "evil",
+		},
+		{
+			Name:    "absolute path",
+			Entries: []Entry{{Name: "/tmp/gomn-evil-abs", Body: "pwned", Mode: 0644}},
+			Escape:  "../../../../../../tmp/gomn-evil-abs",
+		},
+		{
+			Name: "symlink to parent then write through it",
+			Entries: []Entry{
+				{Name: "link", Mode: os.ModeSymlink | 0777, Linkname: ".."},
+				{Name: "link/evil", Body: "pwned", Mode: 0644},
+			},
+			Escape: "evil",
+		},
+		{
+			Name: "absolute symlink then write through it",
+			Entries: []Entry{
+				{Name: "link", Mode: os.ModeSymlink | 0777, Linkname: "/tmp"},
+				{Name: "link/gomn-evil-symlink", Body: "pwned", Mode: 0644},
+			},
+			Escape: "../../../../../../tmp/gomn-evil-symlink",
+		},
+		{
+			Name: "symlink overwrite of a regular file",
+			Entries: []Entry{
+				{Name: "evil", Mode: os.ModeSymlink | 0777, Linkname: "../evil"},
+				{Name: "evil", Body: "pwned", Mode: 0644},
+			},
+			Escape: "evil",
+		},
+		{
+			Name: "symlink climbing through another symlink",
+			Entries: []Entry{
+				{Name: "a/b", Mode: os.ModeSymlink | 0777, Linkname: ".."},
+				{Name: "a/l", Mode: os.ModeSymlink | 0777, Linkname: "b/../.."},
+				{Name: "a/l/evil", Body: "pwned", Mode: 0644},
+			},
+			Escape: "evil",
+		},
+		{
+			Name: "hardlink to a file outside",
+			Entries: []Entry{
+				{Name: "evil", Hardlink: true, Linkname: "../evil"},
+			},
+			Escape: "evil",
+		},
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,539 @@
+// Package cointest provides a fake masternode coin daemon which speaks just
+// enough JSON-RPC for gomn to be exercised without a real `pivxd`.  Much like
+// `net/http/httptest`, it is meant to be used from tests, or wrapped in a
+// binary (see `cmd/fakecoind`) which gomn can launch as if it were the real
+// coin daemon.
+package cointest
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sabhiram/gomn/zmq"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Common RPC error codes returned by bitcoin derived daemons.
+const (
+	ErrCodeMisc           = -1 // generic error, also used for "not a masternode"
+	ErrCodeMethodNotFound = -32601
+	ErrCodeInWarmup       = -28 // daemon is still loading (block index, wallet...)
+)
+
+// Masternode status codes as reported by `getmasternodestatus`.
+const (
+	MasternodeInitial       = 0 // initial state
+	MasternodeSyncInProcess = 1 // sync in process
+	MasternodeInputTooNew   = 2 // collateral input has too few confirmations
+	MasternodeNotCapable    = 3 // node is not capable of being a masternode
+	MasternodeStarted       = 4 // masternode successfully started
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// RPCError is the error portion of a JSON-RPC response.
+type RPCError struct {
+	Code    int64  `json:"code"`
+	Message string `json:"message"`
+}
+
+// HandlerFunc is invoked for a given RPC method.  It returns either a result
+// (which is JSON encoded as-is) or an error to send back to the caller.
+type HandlerFunc func(d *Daemon, params []interface{}) (interface{}, *RPCError)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// State is the scriptable state of the fake daemon.  All fields can be changed
+// while the daemon is serving requests via `Daemon.Update`.
+type State struct {
+	Version     int64  // reported daemon version
+	Blocks      int64  // current block height
+	Headers     int64  // best known header height
+	BestHash    string // hash of the block at `Blocks` (generated if empty)
+	ForkHeight  int64  // if > 0, blocks from this height on are on a fork
+	Connections int64  // number of peers
+	Synced      bool   // true if the blockchain and masternode lists are synced
+
+	Warmup        bool   // true if every call should fail with -28
+	WarmupMessage string // message sent along with the warmup error
+
+	MasternodeStatus  int    // one of the Masternode* constants
+	MasternodeMessage string // human readable masternode status
+	MasternodeAddr    string // IP:port of the masternode
+
+	CollateralOutputs []string // "txid:index" of the wallet's unspent collateral
+}
+
+// DefaultState returns the state of a healthy, synced, running masternode.
+func DefaultState() State {
+	return State{
+		Version:     2020100,
+		Blocks:      1000,
+		Headers:     1000,
+		Connections: 8,
+		Synced:      true,
+
+		WarmupMessage: "Loading block index...",
+
+		MasternodeStatus:  MasternodeStarted,
+		MasternodeMessage: "Masternode successfully started",
+		MasternodeAddr:    "127.0.0.1:51472",
+
+		CollateralOutputs: []string{strings.Repeat("ab", 32) + ":0"},
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Daemon is a fake coin daemon serving JSON-RPC over HTTP with Basic auth.
+type Daemon struct {
+	User     string // rpcuser expected in the Basic auth header
+	Password string // rpcpassword expected in the Basic auth header
+	Addr     string // host:port the daemon is listening on
+	URL      string // base URL of the daemon, ex: "http://127.0.0.1:51473"
+
+	lock     sync.Mutex
+	state    State
+	handlers map[string]HandlerFunc
+	calls    map[string]int
+	pidFile  string
+	conns    map[net.Conn]struct{}
+	listener net.Listener
+	server   *http.Server
+	done     chan struct{}
+	closed   bool
+
+	publishers []publisher               // zmq publishers, one per address
+	zmqTopics  map[string]*zmq.Publisher // topic -> publisher
+	zmqSeq     map[string]uint32         // topic -> next sequence number
+}
+
+type publisher struct {
+	addr string
+	pub  *zmq.Publisher
+}
+
+// NewDaemon starts a fake daemon listening on `addr` (use "127.0.0.1:0" to pick
+// a free port) which expects `user` and `password` as its RPC credentials.
+func NewDaemon(addr, user, password string) (*Daemon, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Daemon{
+		User:     user,
+		Password: password,
+		Addr:     l.Addr().String(),
+		URL:      "http://" + l.Addr().String(),
+
+		state:    DefaultState(),
+		handlers: map[string]HandlerFunc{},
+		calls:    map[string]int{},
+		conns:    map[net.Conn]struct{}{},
+		listener: l,
+		done:     make(chan struct{}),
+
+		zmqTopics: map[string]*zmq.Publisher{},
+		zmqSeq:    map[string]uint32{},
+	}
+	for method, fn := range defaultHandlers {
+		d.handlers[method] = fn
+	}
+
+	d.server = &http.Server{
+		Handler:   d,
+		ConnState: d.trackConn,
+	}
+	go func() {
+		d.server.Serve(l)
+		close(d.done)
+	}()
+	return d, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Port returns the TCP port the daemon is listening on.
+func (d *Daemon) Port() int {
+	_, p, err := net.SplitHostPort(d.Addr)
+	if err != nil {
+		return -1
+	}
+	port, err := strconv.Atoi(p)
+	if err != nil {
+		return -1
+	}
+	return port
+}
+
+// Done returns a channel which is closed once the daemon stops serving, be
+// it from a `Close`, `Crash` or a `stop` RPC.
+func (d *Daemon) Done() <-chan struct{} {
+	return d.done
+}
+
+// State returns a copy of the daemon's current state.
+func (d *Daemon) State() State {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.state
+}
+
+// Update calls `fn` with the daemon's state locked so that it can be modified.
+func (d *Daemon) Update(fn func(s *State)) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	fn(&d.state)
+}
+
+// After applies `fn` to the daemon's state once `delay` has elapsed.  This is
+// used to script transitions (ex: warmup -> syncing -> masternode started).
+func (d *Daemon) After(delay time.Duration, fn func(s *State)) {
+	go func() {
+		select {
+		case <-time.After(delay):
+			d.Update(fn)
+		case <-d.done:
+		}
+	}()
+}
+
+// Handle overrides (or adds) the handler for a given RPC `method`.
+func (d *Daemon) Handle(method string, fn HandlerFunc) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.handlers[method] = fn
+}
+
+// Calls returns the number of times `method` has been called.
+func (d *Daemon) Calls(method string) int {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.calls[method]
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// WritePidFile writes the current process's pid to `fp`, the file is removed
+// when the daemon is closed cleanly (but not when it crashes).
+func (d *Daemon) WritePidFile(fp string) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if err := ioutil.WriteFile(fp, []byte(fmt.Sprintf("%d\n", os.Getpid())), 0644); err != nil {
+		return err
+	}
+	d.pidFile = fp
+	return nil
+}
+
+// Close gracefully shuts the daemon down and removes its pidfile (if any).
+func (d *Daemon) Close() error {
+	d.lock.Lock()
+	if d.closed {
+		d.lock.Unlock()
+		return nil
+	}
+	d.closed = true
+	pidFile := d.pidFile
+	d.closeZMQ()
+	d.lock.Unlock()
+
+	// Remove the pidfile first, a process waiting on `Done` may exit as soon
+	// as the server is closed.
+	if len(pidFile) > 0 {
+		os.Remove(pidFile)
+	}
+	err := d.server.Close()
+	<-d.done
+	return err
+}
+
+// Crash abruptly stops the daemon: the listener and any open connections are
+// dropped mid-flight and the pidfile is left behind, as if the process died.
+func (d *Daemon) Crash() {
+	d.lock.Lock()
+	if d.closed {
+		d.lock.Unlock()
+		return
+	}
+	d.closed = true
+	d.listener.Close()
+	for c := range d.conns {
+		c.Close()
+	}
+	d.closeZMQ()
+	d.lock.Unlock()
+	<-d.done
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func (d *Daemon) trackConn(c net.Conn, cs http.ConnState) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	switch cs {
+	case http.StateNew:
+		d.conns[c] = struct{}{}
+	case http.StateHijacked, http.StateClosed:
+		delete(d.conns, c)
+	}
+}
+
+// ServeHTTP implements the `http.Handler` interface for the JSON-RPC endpoint.
+func (d *Daemon) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "JSONRPC server handles only POST requests", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, pass, ok := r.BasicAuth()
+	if !ok || user != d.User || pass != d.Password {
+		w.Header().Set("WWW-Authenticate", `Basic realm="jsonrpc"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	req := &struct {
+		Method string        `json:"method"`
+		ID     interface{}   `json:"id"`
+		Params []interface{} `json:"params"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		http.Error(w, "Parse error", http.StatusBadRequest)
+		return
+	}
+
+	result, rpcErr := d.dispatch(req.Method, req.Params)
+	rsp := &struct {
+		Result interface{} `json:"result"`
+		Error  *RPCError   `json:"error"`
+		ID     interface{} `json:"id"`
+	}{
+		Result: result,
+		Error:  rpcErr,
+		ID:     req.ID,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case rpcErr == nil:
+		w.WriteHeader(http.StatusOK)
+	case rpcErr.Code == ErrCodeMethodNotFound:
+		w.WriteHeader(http.StatusNotFound)
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	json.NewEncoder(w).Encode(rsp)
+
+	if req.Method == "stop" && rpcErr == nil {
+		go d.Close()
+	}
+}
+
+func (d *Daemon) dispatch(method string, params []interface{}) (interface{}, *RPCError) {
+	d.lock.Lock()
+	d.calls[method]++
+	fn, ok := d.handlers[method]
+	warmup, msg := d.state.Warmup, d.state.WarmupMessage
+	d.lock.Unlock()
+
+	switch {
+	case warmup:
+		return nil, &RPCError{Code: ErrCodeInWarmup, Message: msg}
+	case !ok:
+		return nil, &RPCError{Code: ErrCodeMethodNotFound, Message: "Method not found"}
+	}
+	return fn(d, params)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// BlockHash returns the fake (but stable) hash for the block at `height`.
+func BlockHash(height int64) string {
+	return fmt.Sprintf("%064x", height)
+}
+
+// ForkBlockHash returns the fake hash for the block at `height` on a fork of
+// the chain described by `BlockHash`.
+func ForkBlockHash(height int64) string {
+	return fmt.Sprintf("f%063x", height)
+}
+
+// blockHash returns the hash of the block at `height` for the state `s`.
+func (s *State) blockHash(height int64) string {
+	switch {
+	case height == s.Blocks && len(s.BestHash) > 0:
+		return s.BestHash
+	case s.ForkHeight > 0 && height >= s.ForkHeight:
+		return ForkBlockHash(height)
+	}
+	return BlockHash(height)
+}
+
+// bestHash returns the best block hash for the state `s`.
+func (s *State) bestHash() string {
+	return s.blockHash(s.Blocks)
+}
+
+// blockHeight returns the height of the block with `hash`, or -1 if it is not
+// part of the chain described by `s`.
+func (s *State) blockHeight(hash string) int64 {
+	if len(hash) != 64 {
+		return -1
+	}
+	if hash == s.bestHash() {
+		return s.Blocks
+	}
+	h, err := strconv.ParseInt(strings.TrimPrefix(hash, "f"), 16, 64)
+	if err != nil || h < 0 || h > s.Blocks || s.blockHash(h) != hash {
+		return -1
+	}
+	return h
+}
+
+var defaultHandlers = map[string]HandlerFunc{
+	"getinfo": func(d *Daemon, _ []interface{}) (interface{}, *RPCError) {
+		s := d.State()
+		return map[string]interface{}{
+			"version":         s.Version,
+			"protocolversion": 70914,
+			"walletversion":   61000,
+			"balance":         0.0,
+			"blocks":          s.Blocks,
+			"timeoffset":      0,
+			"connections":     s.Connections,
+			"proxy":           "",
+			"difficulty":      1.0,
+			"testnet":         false,
+			"errors":          "",
+		}, nil
+	},
+	"getblockcount": func(d *Daemon, _ []interface{}) (interface{}, *RPCError) {
+		return d.State().Blocks, nil
+	},
+	"getbestblockhash": func(d *Daemon, _ []interface{}) (interface{}, *RPCError) {
+		s := d.State()
+		return s.bestHash(), nil
+	},
+	"getblockhash": func(d *Daemon, params []interface{}) (interface{}, *RPCError) {
+		s := d.State()
+		if len(params) != 1 {
+			return nil, &RPCError{Code: ErrCodeMisc, Message: "getblockhash index"}
+		}
+		h, ok := params[0].(float64)
+		if !ok || int64(h) < 0 || int64(h) > s.Blocks {
+			return nil, &RPCError{Code: -8, Message: "Block height out of range"}
+		}
+		return s.blockHash(int64(h)), nil
+	},
+	"getblock": func(d *Daemon, params []interface{}) (interface{}, *RPCError) {
+		s := d.State()
+		hash, ok := "", len(params) > 0
+		if ok {
+			hash, ok = params[0].(string)
+		}
+		if !ok {
+			return nil, &RPCError{Code: ErrCodeMisc, Message: "getblock \"hash\" ( verbose )"}
+		}
+
+		height := s.blockHeight(hash)
+		if height < 0 {
+			return nil, &RPCError{Code: -5, Message: "Block not found"}
+		}
+		return map[string]interface{}{
+			"hash":          hash,
+			"height":        height,
+			"confirmations": s.Blocks - height + 1,
+			"time":          time.Now().Unix() - (s.Blocks-height)*60,
+		}, nil
+	},
+	"mnsync": func(d *Daemon, params []interface{}) (interface{}, *RPCError) {
+		s := d.State()
+		if len(params) != 1 || params[0] != "status" {
+			return nil, &RPCError{Code: ErrCodeMisc, Message: "mnsync \"status|reset\""}
+		}
+		asset := 999
+		if !s.Synced {
+			asset = 1
+		}
+		return map[string]interface{}{
+			"IsBlockchainSynced":        s.Synced && s.Blocks >= s.Headers,
+			"RequestedMasternodeAssets": asset,
+		}, nil
+	},
+	"getmasternodestatus": func(d *Daemon, _ []interface{}) (interface{}, *RPCError) {
+		s := d.State()
+		if s.MasternodeStatus == MasternodeNotCapable {
+			return nil, &RPCError{
+				Code:    ErrCodeMisc,
+				Message: "Masternode not found in the list of available masternodes. Current status: " + s.MasternodeMessage,
+			}
+		}
+		return map[string]interface{}{
+			"txhash":    strings.Repeat("ab", 32),
+			"outputidx": 0,
+			"netaddr":   s.MasternodeAddr,
+			"addr":      "DFakeMasternodeAddressxxxxxxxxxxxx",
+			"status":    s.MasternodeStatus,
+			"message":   s.MasternodeMessage,
+		}, nil
+	},
+	"getmasternodeoutputs": func(d *Daemon, _ []interface{}) (interface{}, *RPCError) {
+		ret := []map[string]interface{}{}
+		for _, out := range d.State().CollateralOutputs {
+			idx := strings.LastIndex(out, ":")
+			if idx < 0 {
+				return nil, &RPCError{Code: ErrCodeMisc, Message: fmt.Sprintf("invalid collateral output (%s), expected TXHASH:INDEX", out)}
+			}
+			n, err := strconv.Atoi(out[idx+1:])
+			if err != nil {
+				return nil, &RPCError{Code: ErrCodeMisc, Message: fmt.Sprintf("invalid collateral output index (%s)", out)}
+			}
+			ret = append(ret, map[string]interface{}{
+				"txhash":    out[:idx],
+				"outputidx": n,
+			})
+		}
+		return ret, nil
+	},
+	"stop": func(d *Daemon, _ []interface{}) (interface{}, *RPCError) {
+		return "PIVX server stopping", nil
+	},
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// ErrDaemonNotReady is returned by `WaitReady` if the daemon never answered.
+var ErrDaemonNotReady = errors.New("daemon did not become ready in time")
+
+// WaitReady blocks until something is accepting TCP connections on `addr`, or
+// until `timeout` elapses.  This is handy when the fake daemon was launched
+// as a separate process.
+func WaitReady(addr string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if c, err := net.DialTimeout("tcp", addr, 100*time.Millisecond); err == nil {
+			c.Close()
+			return nil
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return ErrDaemonNotReady
+}
+
+////////////////////////////////////////////////////////////////////////////////
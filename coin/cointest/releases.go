@@ -0,0 +1,135 @@
+package cointest
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Release is a release published by a ReleaseServer.
+type Release struct {
+	Tag        string            // ex: "v2.2.1"
+	Draft      bool              // drafts are listed but should never be installed
+	Prerelease bool              // pre-releases are never "latest"
+	Assets     map[string][]byte // asset name -> contents
+}
+
+// ReleaseServer is a local stand-in for a GitHub-releases-style API.  The
+// release list is served at "/releases" and assets are served from
+// "/download/<tag>/<name>".
+type ReleaseServer struct {
+	*httptest.Server
+
+	NoDigests bool // if set, assets are listed without a "digest"
+
+	lock     sync.Mutex
+	releases []Release
+}
+
+// NewReleaseServer starts a release server publishing `releases`.
+func NewReleaseServer(releases ...Release) *ReleaseServer {
+	s := &ReleaseServer{releases: releases}
+	s.Server = httptest.NewServer(s)
+	return s
+}
+
+// APIURL returns the url which lists the releases.
+func (s *ReleaseServer) APIURL() string {
+	return s.URL + "/releases"
+}
+
+// AssetURL returns the download url for asset `name` of release `tag`.
+func (s *ReleaseServer) AssetURL(tag, name string) string {
+	return s.URL + "/download/" + tag + "/" + name
+}
+
+// Publish adds a release.
+func (s *ReleaseServer) Publish(r Release) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.releases = append(s.releases, r)
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (s *ReleaseServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if r.URL.Path == "/releases" {
+		s.serveList(w)
+		return
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/download/"), "/", 2)
+	if len(parts) == 2 {
+		for _, rel := range s.releases {
+			if bs, ok := rel.Assets[parts[1]]; ok && rel.Tag == parts[0] {
+				w.Write(bs)
+				return
+			}
+		}
+	}
+	http.NotFound(w, r)
+}
+
+func (s *ReleaseServer) serveList(w http.ResponseWriter) {
+	type asset struct {
+		Name   string `json:"name"`
+		URL    string `json:"browser_download_url"`
+		Size   int    `json:"size"`
+		Digest string `json:"digest,omitempty"`
+	}
+	type release struct {
+		TagName    string  `json:"tag_name"`
+		Name       string  `json:"name"`
+		Draft      bool    `json:"draft"`
+		Prerelease bool    `json:"prerelease"`
+		Assets     []asset `json:"assets"`
+	}
+
+	// Like github, the newest release is listed first.
+	list := []release{}
+	for i := len(s.releases) - 1; i >= 0; i-- {
+		rel := s.releases[i]
+		names := []string{}
+		for name := range rel.Assets {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		assets := []asset{}
+		for _, name := range names {
+			a := asset{
+				Name: name,
+				URL:  s.AssetURL(rel.Tag, name),
+				Size: len(rel.Assets[name]),
+			}
+			if !s.NoDigests {
+				sum := sha256.Sum256(rel.Assets[name])
+				a.Digest = "sha256:" + hex.EncodeToString(sum[:])
+			}
+			assets = append(assets, a)
+		}
+		list = append(list, release{
+			TagName:    rel.Tag,
+			Name:       rel.Tag,
+			Draft:      rel.Draft,
+			Prerelease: rel.Prerelease,
+			Assets:     assets,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,60 @@
+package cointest
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// FakeDaemonPkg is the import path of the fake daemon binary.
+const FakeDaemonPkg = "github.com/sabhiram/gomn/cmd/fakecoind"
+
+// BuildFakeDaemon compiles the `fakecoind` binary to `dst` so that it can be
+// used in place of a real coin daemon (ex: `<bins>/pivxd`).  This requires a
+// working go toolchain.
+func BuildFakeDaemon(dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	out, err := exec.Command("go", "build", "-o", dst, FakeDaemonPkg).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("unable to build %s: %s\n%s", FakeDaemonPkg, err.Error(), string(out))
+	}
+	return nil
+}
+
+// WriteConf writes a coin conf file at `fp` with the given RPC credentials and
+// port, this is read both by gomn and by `fakecoind`.  Any key-value pairs in
+// `extra` are appended to the file.
+func WriteConf(fp, user, password string, rpcPort int, extra map[string]string) error {
+	lines := []string{
+		"rpcuser=" + user,
+		"rpcpassword=" + password,
+		"rpcallowip=127.0.0.1",
+		fmt.Sprintf("rpcport=%d", rpcPort),
+	}
+
+	keys := []string{}
+	for k := range extra {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		lines = append(lines, k+"="+extra[k])
+	}
+
+	if err := os.MkdirAll(filepath.Dir(fp), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fp, []byte(strings.Join(lines, "\n")+"\n"), 0600)
+}
+
+////////////////////////////////////////////////////////////////////////////////
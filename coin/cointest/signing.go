@@ -0,0 +1,77 @@
+package cointest
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"bytes"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/clearsign"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Signer is a throwaway release signing key, used to sign checksum manifests
+// the way a coin's release team would.
+type Signer struct {
+	entity *openpgp.Entity
+}
+
+// signerConfig uses ed25519 keys, they are much faster to generate than the
+// default RSA ones.
+var signerConfig = &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA}
+
+// NewSigner generates a signing key for `name` (ex: "PIVX Release Team").
+func NewSigner(name string) (*Signer, error) {
+	e, err := openpgp.NewEntity(name, "", "", signerConfig)
+	if err != nil {
+		return nil, err
+	}
+	return &Signer{entity: e}, nil
+}
+
+// PublicKey returns the signer's armored public key block.
+func (s *Signer) PublicKey() (string, error) {
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, openpgp.PublicKeyType, nil)
+	if err != nil {
+		return "", err
+	}
+	if err := s.entity.Serialize(w); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// ClearSign returns `data` clearsigned (ex: SHA256SUMS.asc).
+func (s *Signer) ClearSign(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := clearsign.Encode(&buf, s.entity.PrivateKey, signerConfig)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// DetachSign returns an armored detached signature for `data` (ex:
+// SHA256SUMS.sig).
+func (s *Signer) DetachSign(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&buf, s.entity, bytes.NewReader(data), signerConfig); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,82 @@
+package cointest
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+
+	"github.com/sabhiram/gomn/zmq"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// ListenZMQ starts publishing notifications for `topic` (ex: "hashblock",
+// "rawtx") on `addr`, mirroring the daemon's `zmqpub<topic>` option.  Several
+// topics can share the same address.  Returns the endpoint to subscribe to.
+func (d *Daemon) ListenZMQ(topic, addr string) (string, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	for _, p := range d.publishers {
+		if p.addr == addr {
+			d.zmqTopics[topic] = p.pub
+			return p.pub.Endpoint, nil
+		}
+	}
+
+	pub, err := zmq.Publish(addr)
+	if err != nil {
+		return "", err
+	}
+	d.publishers = append(d.publishers, publisher{addr: addr, pub: pub})
+	d.zmqTopics[topic] = pub
+	return pub.Endpoint, nil
+}
+
+// notify publishes `body` on `topic` if anything is listening for it, must be
+// called with the lock held.
+func (d *Daemon) notify(topic string, body []byte) {
+	pub, ok := d.zmqTopics[topic]
+	if !ok {
+		return
+	}
+	seq := make([]byte, 4)
+	binary.LittleEndian.PutUint32(seq, d.zmqSeq[topic])
+	d.zmqSeq[topic]++
+	pub.Send(zmq.Message{[]byte(topic), body, seq})
+}
+
+// closeZMQ shuts down all publishers, must be called with the lock held.
+func (d *Daemon) closeZMQ() {
+	for _, p := range d.publishers {
+		p.pub.Close()
+	}
+	d.publishers = nil
+	d.zmqTopics = map[string]*zmq.Publisher{}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// MineBlock advances the chain by one block and publishes a "hashblock"
+// notification for it.
+func (d *Daemon) MineBlock() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.state.Blocks++
+	d.state.Headers = d.state.Blocks
+	d.state.BestHash = ""
+
+	hash, _ := hex.DecodeString(d.state.bestHash())
+	d.notify("hashblock", hash)
+}
+
+// RelayTx publishes a "rawtx" notification with the serialized transaction.
+func (d *Daemon) RelayTx(raw []byte) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.notify("rawtx", raw)
+}
+
+////////////////////////////////////////////////////////////////////////////////
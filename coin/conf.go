@@ -3,70 +3,759 @@ package coin
 ////////////////////////////////////////////////////////////////////////////////
 
 import (
+	"bytes"
+	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io/ioutil"
-	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 	"time"
+
+	"github.com/sabhiram/gomn/types"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+const (
+	// ConfFilePerm is the mode conf files are written with, they hold the RPC
+	// credentials and the masternode's private key.
+	ConfFilePerm = 0600
+)
+
+var (
+	ErrNoConfFile = errors.New("conf file does not exist (see 'gomn configure' or 'gomn config set')")
 )
 
 ////////////////////////////////////////////////////////////////////////////////
 
-// Returns a random hex string of `size`.
+// Returns a random hex string of `size` bytes (2 * `size` characters) from
+// the system's secure random source, fit for use as a credential.
 func GetRandomHex(size int) string {
 	bs := make([]byte, size)
-	rand.Read(bs)
+	if _, err := rand.Read(bs); err != nil {
+		// There is no safe fallback for credentials.
+		panic(fmt.Sprintf("unable to read random bytes: %s", err.Error()))
+	}
 	return hex.EncodeToString(bs)
 }
 
 ////////////////////////////////////////////////////////////////////////////////
 
+// confLine is a single line of a conf file.  Lines which are not settings
+// (blank lines, comments, section headers) only have their raw text.
+type confLine struct {
+	raw     string // the line as read (or last written), without its ending
+	eol     string // the line's ending, "\n" or "\r\n"
+	section string // section the line is in, empty for the top of the file
+	header  bool   // true if the line starts a section, ex: "[test]"
+	key     string // empty if the line is not a setting
+	value   string
+	comment string // trailing comment of a setting, ex: " # why"
+}
+
+// parseConfLine parses a single line of a conf file, which follows the lines
+// of `section`.
+func parseConfLine(raw, section string) *confLine {
+	l := &confLine{raw: raw, section: section}
+	line := strings.TrimSpace(raw)
+	if len(line) == 0 || line[0] == '#' {
+		return l
+	}
+	if line[0] == '[' && strings.HasSuffix(line, "]") {
+		l.header = true
+		l.section = strings.TrimSpace(line[1 : len(line)-1])
+		return l
+	}
+	idx := strings.IndexByte(line, '=')
+	if idx < 0 {
+		return l
+	}
+
+	key, value := line[:idx], line[idx+1:]
+	if cidx := strings.IndexByte(value, '#'); cidx >= 0 {
+		value, l.comment = value[:cidx], value[cidx:]
+		l.comment = " " + l.comment
+	}
+	l.key = strings.TrimSpace(key)
+	l.value = strings.TrimSpace(value)
+	return l
+}
+
+// set changes the line's value, keeping its trailing comment (if any).
+func (l *confLine) set(value string) {
+	l.value = value
+	l.raw = l.key + "=" + value + l.comment
+}
+
+// is returns true if the line sets `key` in `section`, either inside of the
+// section or as "section.key" at the top of the file.
+func (l *confLine) is(section, key string) bool {
+	switch {
+	case len(l.key) == 0:
+		return false
+	case l.section == section && l.key == key:
+		return true
+	}
+	return len(section) > 0 && len(l.section) == 0 && l.key == section+"."+key
+}
+
+// splitKey splits "section.key" into its section and key, keys without a
+// section are at the top of the file.
+func splitKey(key string) (string, string) {
+	if idx := strings.IndexByte(key, '.'); idx > 0 {
+		return key[:idx], key[idx+1:]
+	}
+	return "", key
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+const (
+	NetworkMain    = "main"
+	NetworkTest    = "test"
+	NetworkRegtest = "regtest"
+
+	includeConfKey = "includeconf"
+)
+
+// ConfDoc is a conf file which can be edited and written back without losing
+// its comments, blank lines or the order of its settings.  A document which
+// is not edited is written back byte for byte.
+//
+// Keys may be set more than once (ex: "addnode"), and may be set for one
+// network only, either in a "[test]" style section or as "test.key".  Keys
+// are named "section.key" for the methods below, a key without a section is
+// one at the top of the file.  Files pulled in with "includeconf" are read as
+// part of the document, but are never written.
+type ConfDoc struct {
+	lines    []*confLine
+	eol      string     // line ending for new lines, the file's first one
+	final    bool       // true if the file ends with a line ending
+	includes []*ConfDoc // files included by this one, in order
+}
+
+// ParseConf parses the contents of a conf file, without its includes.
+func ParseConf(data []byte) *ConfDoc {
+	d := &ConfDoc{eol: "\n", final: true}
+	s := string(data)
+	if len(s) == 0 {
+		return d
+	}
+
+	d.final = strings.HasSuffix(s, "\n")
+	s = strings.TrimSuffix(s, "\n")
+	section := ""
+	for i, raw := range strings.Split(s, "\n") {
+		eol := "\n"
+		if strings.HasSuffix(raw, "\r") {
+			raw, eol = raw[:len(raw)-1], "\r\n"
+		}
+		if i == 0 {
+			d.eol = eol
+		}
+		l := parseConfLine(raw, section)
+		l.eol = eol
+		section = l.section
+		d.lines = append(d.lines, l)
+	}
+
+	// The last line of a file which does not end with a line ending gets the
+	// file's, in case lines are added after it.
+	if !d.final {
+		d.lines[len(d.lines)-1].eol = d.eol
+	}
+	return d
+}
+
+// LoadConfDoc reads the conf file at `fp`, and the files it includes.  As for
+// the daemon, included files are relative to the conf file's directory and
+// can not include others themselves.  Each file is only read once, should it
+// be included twice (or include itself).
+func LoadConfDoc(fp string) (*ConfDoc, error) {
+	bs, err := ioutil.ReadFile(fp)
+	if err != nil {
+		return nil, err
+	}
+	d := ParseConf(bs)
+
+	seen := map[string]bool{filepath.Clean(fp): true}
+	for _, l := range d.lines {
+		if len(l.key) == 0 || l.key != includeConfKey && !strings.HasSuffix(l.key, "."+includeConfKey) {
+			continue
+		}
+		ifp := l.value
+		if !filepath.IsAbs(ifp) {
+			ifp = filepath.Join(filepath.Dir(fp), ifp)
+		}
+		if seen[filepath.Clean(ifp)] {
+			continue
+		}
+		seen[filepath.Clean(ifp)] = true
+		ibs, err := ioutil.ReadFile(ifp)
+		if err != nil {
+			return nil, fmt.Errorf("unable to include %s: %s", l.value, err.Error())
+		}
+		d.includes = append(d.includes, ParseConf(ibs))
+	}
+	return d, nil
+}
+
+// Bytes returns the contents of the conf file (without its includes).
+func (d *ConfDoc) Bytes() []byte {
+	var buf bytes.Buffer
+	for i, l := range d.lines {
+		buf.WriteString(l.raw)
+		if i < len(d.lines)-1 || d.final {
+			buf.WriteString(l.eol)
+		}
+	}
+	return buf.Bytes()
+}
+
+// Save writes the document to `fp` with permissions `perm` (see
+// writeFileAtomic).
+func (d *ConfDoc) Save(fp string, perm os.FileMode) error {
+	return writeFileAtomic(fp, d.Bytes(), perm)
+}
+
+// Keys returns the keys set in the document, in the order they first appear.
+// Keys in a section are returned as "section.key".
+func (d *ConfDoc) Keys() []string {
+	ret := []string{}
+	seen := map[string]bool{}
+	for _, doc := range d.docs() {
+		for _, l := range doc.lines {
+			key := l.key
+			if len(l.section) > 0 {
+				key = l.section + "." + key
+			}
+			if len(l.key) > 0 && !seen[key] {
+				seen[key] = true
+				ret = append(ret, key)
+			}
+		}
+	}
+	return ret
+}
+
+// Values returns every value of `key`, in the order they appear (the
+// included files last).
+func (d *ConfDoc) Values(key string) []string {
+	section, key := splitKey(key)
+	ret := []string{}
+	for _, doc := range d.docs() {
+		for _, l := range doc.lines {
+			if l.is(section, key) {
+				ret = append(ret, l.value)
+			}
+		}
+	}
+	return ret
+}
+
+// Get returns the value of `key`.  If it is set more than once, the first one
+// wins (like it does for the daemon).
+func (d *ConfDoc) Get(key string) (string, bool) {
+	if vs := d.Values(key); len(vs) > 0 {
+		return vs[0], true
+	}
+	return "", false
+}
+
+// Network returns the network the conf file selects: "main", "test" (with
+// testnet=1) or "regtest" (with regtest=1).
+func (d *ConfDoc) Network() string {
+	switch {
+	case d.bool("regtest"):
+		return NetworkRegtest
+	case d.bool("testnet"):
+		return NetworkTest
+	}
+	return NetworkMain
+}
+
+func (d *ConfDoc) bool(key string) bool {
+	v, _ := d.Get(key)
+	return v == "1" || v == "true"
+}
+
+// NetworkValues returns the values of `key` for `network`: those in the
+// network's section if it sets any, the ones at the top of the file if not.
+func (d *ConfDoc) NetworkValues(network, key string) []string {
+	if len(network) > 0 {
+		if vs := d.Values(network + "." + key); len(vs) > 0 {
+			return vs
+		}
+	}
+	return d.Values(key)
+}
+
+// NetworkGet returns the value of `key` for `network` (see NetworkValues).
+func (d *ConfDoc) NetworkGet(network, key string) (string, bool) {
+	if vs := d.NetworkValues(network, key); len(vs) > 0 {
+		return vs[0], true
+	}
+	return "", false
+}
+
+// Map returns the settings at the top of the file as a k-v map, see NetworkMap
+// for the settings of a network.
+func (d *ConfDoc) Map() map[string]string {
+	return d.NetworkMap("")
+}
+
+// NetworkMap returns the settings for `network` as a k-v map, its section
+// takes precedence over the top of the file.  Keys set more than once map to
+// their first value.
+func (d *ConfDoc) NetworkMap(network string) map[string]string {
+	m := map[string]string{}
+	for _, key := range d.Keys() {
+		section, name := splitKey(key)
+		if len(section) > 0 && section != network {
+			continue
+		}
+		if v, ok := d.NetworkGet(network, name); ok {
+			m[name] = v
+		}
+	}
+	return m
+}
+
+// Set sets `key` to `value`.  An existing setting is changed where it is (any
+// repeats of it are removed), a new one is added at the end of its section.
+func (d *ConfDoc) Set(key, value string) {
+	section, name := splitKey(key)
+	found := false
+	lines := d.lines[:0]
+	for _, l := range d.lines {
+		if l.is(section, name) {
+			if found {
+				continue
+			}
+			found = true
+			l.set(value)
+		}
+		lines = append(lines, l)
+	}
+	d.lines = lines
+
+	if !found {
+		d.Add(key, value)
+	}
+}
+
+// SetFirst sets the first setting of `key` to `value` where it is, leaving any
+// repeats of it (ex: other "bind" addresses) alone.  It is added at the end
+// of its section if it is not set.
+func (d *ConfDoc) SetFirst(key, value string) {
+	section, name := splitKey(key)
+	for _, l := range d.lines {
+		if l.is(section, name) {
+			l.set(value)
+			return
+		}
+	}
+	d.Add(key, value)
+}
+
+// Add adds another `value` for `key`, after the key's existing values (or at
+// the end of its section).
+func (d *ConfDoc) Add(key, value string) {
+	section, name := splitKey(key)
+	l := &confLine{key: name, section: section}
+	l.set(value)
+
+	for i := len(d.lines) - 1; i >= 0; i-- {
+		if d.lines[i].is(section, name) {
+			d.insert(i+1, l)
+			return
+		}
+	}
+	d.insert(d.sectionEnd(section), l)
+}
+
+// Unset removes the settings of `key`, all of them if `values` is empty or
+// those with one of the `values` otherwise.  Returns false if nothing was
+// removed.
+func (d *ConfDoc) Unset(key string, values ...string) bool {
+	section, name := splitKey(key)
+	found := false
+	lines := d.lines[:0]
+	for _, l := range d.lines {
+		if l.is(section, name) && (len(values) == 0 || contains(values, l.value)) {
+			found = true
+			continue
+		}
+		lines = append(lines, l)
+	}
+	d.lines = lines
+	return found
+}
+
+// AddComment appends a comment line (or a blank line for an empty `text`).
+func (d *ConfDoc) AddComment(text string) {
+	raw := ""
+	if len(text) > 0 {
+		raw = "# " + text
+	}
+	d.insert(len(d.lines), &confLine{raw: raw, section: d.lastSection()})
+}
+
+// SetCommented sets a commented out `key` (ex: "# masternode=1") at the top of
+// the file, for settings the user has to enable themselves.  An existing
+// commented out line for the key is changed where it is.
+func (d *ConfDoc) SetCommented(key, value string) {
+	raw := "# " + key + "=" + value
+	for _, l := range d.lines {
+		text := strings.TrimSpace(l.raw)
+		if len(l.section) == 0 && strings.HasPrefix(text, "#") &&
+			strings.HasPrefix(strings.TrimSpace(text[1:]), key+"=") {
+			l.raw = raw
+			return
+		}
+	}
+	d.insert(d.sectionEnd(""), &confLine{raw: raw})
+}
+
+// sectionEnd returns where to add a line to `section`: at the end of the file
+// for the last section, otherwise after its last non-blank line (so that the
+// blank lines before the next section stay there).  A missing section is
+// added to the end of the file.
+func (d *ConfDoc) sectionEnd(section string) int {
+	end, last, found := -1, -1, len(section) == 0
+	for i, l := range d.lines {
+		if l.section != section {
+			continue
+		}
+		found, last = true, i
+		if l.header || len(strings.TrimSpace(l.raw)) > 0 {
+			end = i
+		}
+	}
+	if found && last == len(d.lines)-1 {
+		return len(d.lines)
+	}
+	if found {
+		return end + 1
+	}
+
+	if len(d.lines) > 0 {
+		d.insert(len(d.lines), &confLine{section: d.lastSection()})
+	}
+	d.insert(len(d.lines), &confLine{raw: "[" + section + "]", section: section, header: true})
+	return len(d.lines)
+}
+
+func (d *ConfDoc) lastSection() string {
+	if len(d.lines) == 0 {
+		return ""
+	}
+	return d.lines[len(d.lines)-1].section
+}
+
+// insert adds `l` before the line at `idx`, appending to the file means that
+// it then ends with a line ending.
+func (d *ConfDoc) insert(idx int, l *confLine) {
+	l.eol = d.eol
+	d.lines = append(d.lines, nil)
+	copy(d.lines[idx+1:], d.lines[idx:])
+	d.lines[idx] = l
+	if idx == len(d.lines)-1 {
+		d.final = true
+	}
+}
+
+// docs returns the document followed by the ones it includes.
+func (d *ConfDoc) docs() []*ConfDoc {
+	return append([]*ConfDoc{d}, d.includes...)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
 // CreateConfFile generates a config file with the specified key-value pairs in
-// `m`.
+// `m` (see GenerateConf), readable by its owner only.
 func CreateConfFile(fp string, m map[string]string) error {
-	data := fmt.Sprintf(`# Warning: This is an auto-generated file! Do not hand-edit!
-#   Generated using gomn on %s
-# Warning: This is an auto-generated file! Do not hand-edit!
+	return GenerateConf(m).Save(fp, ConfFilePerm)
+}
+
+// GenerateConf returns a new conf document with the key-value pairs in `m`, in
+// order of their keys.  Keys starting with "#" are written commented out.
+func GenerateConf(m map[string]string) *ConfDoc {
+	d := ParseConf(nil)
+	d.AddComment("Generated using gomn on " + time.Now().Format(time.RFC1123))
+	d.AddComment("Edit with 'gomn config set|unset KEY', comments and order are kept.")
+	d.AddComment("")
+
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return strings.TrimPrefix(keys[i], "#") < strings.TrimPrefix(keys[j], "#")
+	})
+	for _, k := range keys {
+		if strings.HasPrefix(k, "#") {
+			d.AddComment(strings.TrimPrefix(k, "#") + "=" + m[k])
+		} else {
+			d.Set(k, m[k])
+		}
+	}
+	return d
+}
 
-`, time.Now().String())
-	for k, v := range m {
-		data += fmt.Sprintf("%s=%s\n", k, v)
+// MergeConf merges the key-value pairs in `m` (as for GenerateConf) into `d`,
+// keeping its other settings, comments and order.  Only the first value of a
+// key set more than once is changed, the others are kept.  Keys in `keep`
+// (ex: the RPC credentials, or settings the user enables themselves) are
+// left alone if `d` sets them.  Keys starting with "#" stay commented out,
+// unless `d` sets them already.
+func MergeConf(d *ConfDoc, m map[string]string, keep ...string) *ConfDoc {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
 	}
-	data += "\n"
-	return ioutil.WriteFile(fp, []byte(data), 0644)
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		name := strings.TrimPrefix(k, "#")
+		_, set := d.Get(name)
+		switch {
+		case contains(keep, name) && set:
+		case name != k && !set:
+			d.SetCommented(name, m[k])
+		default:
+			d.SetFirst(name, m[k])
+		}
+	}
+	return d
 }
 
 // LoadConfFile returns a map of key-value pairs found in a `.conf` file pointed
 // to by `fp`.
 func LoadConfFile(fp string) (map[string]string, error) {
-	bs, err := ioutil.ReadFile(fp)
+	d, err := LoadConfDoc(fp)
 	if err != nil {
 		return nil, err
 	}
+	return d.Map(), nil
+}
 
-	m := map[string]string{}
-	for _, line := range strings.Split(string(bs), "\n") {
-		line = strings.TrimSpace(line)
-		switch {
-		case len(line) == 0:
-			break
-		case line[0] == '#':
-			break
-		default:
-			idx := strings.IndexByte(line, '=')
-			if idx >= 0 {
-				m[line[:idx]] = line[idx+1:]
+////////////////////////////////////////////////////////////////////////////////
+
+// SaveConf writes `d` to the coin's conf file, readable by its owner only.  A
+// new file (and data directory) belongs to the user owning the data directory
+// (or the closest directory above it), which is the user the daemon runs as,
+// even when gomn runs as root.
+func (c *Coin) SaveConf(d *ConfDoc) error {
+	fp := c.state.configFilePath
+	dp := filepath.Dir(fp)
+	existed := DirExists(dp)
+	if err := os.MkdirAll(dp, 0700); err != nil {
+		return err
+	}
+	isNew := !FileExists(fp)
+	if err := d.Save(fp, ConfFilePerm); err != nil {
+		return err
+	}
+	if os.Geteuid() != 0 || !isNew {
+		return nil
+	}
+
+	owner := dp
+	if !existed {
+		owner = filepath.Dir(dp)
+		for !DirExists(owner) && owner != filepath.Dir(owner) {
+			owner = filepath.Dir(owner)
+		}
+	}
+	uid, gid, ok := fileOwner(owner)
+	if !ok {
+		return nil
+	}
+	if !existed {
+		if err := os.Chown(dp, uid, gid); err != nil {
+			return err
+		}
+	}
+	return os.Chown(fp, uid, gid)
+}
+
+// ApplyConf writes the conf file generated by the "configure" command from the
+// key-value pairs in `m` (see GenerateConf).  With `cargs.Merge`, they are
+// merged into the existing file instead (see MergeConf, `keep` are the keys
+// to keep).  With `cargs.DryRun`, the changes are printed as a diff and
+// nothing is written.
+func (c *Coin) ApplyConf(m map[string]string, keep []string, cargs *types.Configure) error {
+	fp := c.state.configFilePath
+	old, err := ioutil.ReadFile(fp)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	d := GenerateConf(m)
+	if cargs.Merge && len(old) > 0 {
+		d = MergeConf(ParseConf(old), m, keep...)
+	}
+
+	if cargs.DryRun {
+		secrets := c.secretKeys()
+		a, values := redactConf(old, secrets, nil)
+		b, _ := redactConf(d.Bytes(), secrets, values)
+		diff := UnifiedDiff(fp, fp+" (configured)", a, b)
+		if len(diff) == 0 {
+			fmt.Printf("%s would not change\n", fp)
+		} else {
+			fmt.Printf("%s", diff)
+		}
+		return nil
+	}
+	return c.SaveConf(d)
+}
+
+const (
+	redacted        = "<redacted>"
+	redactedChanged = "<redacted, changed>"
+)
+
+// defaultSecretKeys are the keys whose values are never printed, whether or
+// not the coin's schema marks them as secret.
+var defaultSecretKeys = []string{"rpcpassword", "masternodeprivkey"}
+
+// redactConf returns `data` with the values of the `secrets` keys (commented
+// out or not) masked, so that it can be printed.  If `known` is not nil (the
+// values returned for the previous version of the file), the values not in
+// it are masked as changed so that a diff still shows them.  Returns the
+// values which were masked, by key.
+func redactConf(data []byte, secrets []string, known map[string][]string) ([]byte, map[string][]string) {
+	values := map[string][]string{}
+	mask := func(key, value string) string {
+		values[key] = append(values[key], value)
+		if known == nil || contains(known[key], value) {
+			return redacted
+		}
+		return redactedChanged
+	}
+
+	d := ParseConf(data)
+	for _, l := range d.lines {
+		if len(l.key) > 0 {
+			if _, name := splitKey(l.key); contains(secrets, name) {
+				l.set(mask(l.key, l.value))
 			}
+			continue
+		}
+
+		// Commented out settings, ex: "# masternodeprivkey=..."
+		text := strings.TrimSpace(l.raw)
+		if !strings.HasPrefix(text, "#") {
+			continue
+		}
+		kv := strings.SplitN(strings.TrimSpace(text[1:]), "=", 2)
+		key := strings.TrimSpace(kv[0])
+		if _, name := splitKey(key); len(kv) == 2 && contains(secrets, name) {
+			l.raw = "# " + key + "=" + mask("#"+key, strings.TrimSpace(kv[1]))
 		}
 	}
-	return m, nil
+	return d.Bytes(), values
 }
 
-////////////////////////////////////////////////////////////////////////////////
+// Config implements the "config" command: get, set, add or unset a setting in
+// the coin's conf file, or show or validate the file.  The file is edited in
+// place, its comments and the order of its settings are kept.  Keys for one
+// network are named "section.key" (ex: "test.rpcport").
+func (c *Coin) Config(args []string) error {
+	fp := c.state.configFilePath
+	sub := "show"
+	if len(args) > 0 {
+		sub, args = strings.ToLower(args[0]), args[1:]
+	}
+
+	d, err := LoadConfDoc(fp)
+	switch {
+	case os.IsNotExist(err) && (sub == "set" || sub == "add"):
+		d = ParseConf(nil)
+	case os.IsNotExist(err):
+		return ErrNoConfFile
+	case err != nil:
+		return err
+	}
+
+	switch {
+	case sub == "show" && len(args) == 0:
+		fmt.Printf("%s", d.Bytes())
+		return nil
+
+	case sub == "validate" && len(args) == 0:
+		return c.validateConf(d)
+
+	case sub == "get" && len(args) == 1:
+		vs := d.Values(args[0])
+		if len(vs) == 0 {
+			return fmt.Errorf("%s is not set in %s", args[0], fp)
+		}
+		for _, v := range vs {
+			fmt.Printf("%s\n", v)
+		}
+		return nil
+
+	case (sub == "set" || sub == "add") && len(args) == 2:
+		if strings.ContainsAny(args[0], "=#[]\n") || len(strings.TrimSpace(args[0])) == 0 {
+			return fmt.Errorf("invalid key (%s)", args[0])
+		}
+		if strings.ContainsAny(args[1], "#\n") {
+			return fmt.Errorf("invalid value for %s, it can not contain '#' or newlines", args[0])
+		}
+		if sub == "add" {
+			d.Add(args[0], args[1])
+		} else {
+			d.Set(args[0], args[1])
+		}
+		if err := c.SaveConf(d); err != nil {
+			return err
+		}
+		fmt.Printf("Set %s in %s\n", args[0], fp)
+		return nil
 
-func init() {
-	rand.Seed(time.Now().UnixNano())
+	case sub == "unset" && (len(args) == 1 || len(args) == 2):
+		if !d.Unset(args[0], args[1:]...) {
+			return fmt.Errorf("%s is not set in %s", strings.Join(args, "="), fp)
+		}
+		if err := c.SaveConf(d); err != nil {
+			return err
+		}
+		fmt.Printf("Removed %s from %s\n", strings.Join(args, "="), fp)
+		return nil
+	}
+	return fmt.Errorf("invalid config command, expected 'show', 'validate', 'get KEY', 'set KEY VALUE', 'add KEY VALUE' or 'unset KEY [VALUE]'")
+}
+
+// validateConf prints the problems with `d` (see ConfSchema.Validate), and
+// returns an error if any of them are errors.
+func (c *Coin) validateConf(d *ConfDoc) error {
+	s := GetConfSchema(c.name)
+	if s == nil {
+		return fmt.Errorf("no conf schema registered for %s", c.name)
+	}
+
+	errs := 0
+	problems := s.Validate(d)
+	for _, p := range problems {
+		fmt.Printf("%s\n", p)
+		if p.Severity == ConfError {
+			errs++
+		}
+	}
+	switch {
+	case errs > 0:
+		return fmt.Errorf("%s has %d error(s)", c.state.configFilePath, errs)
+	case len(problems) == 0:
+		fmt.Printf("%s is valid\n", c.state.configFilePath)
+	}
+	return nil
 }
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,339 @@
+package coin
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// testConf has everything a hand edited conf file might: comments, trailing
+// comments, blank lines, odd spacing and repeated keys.
+const testConf = `# pivx.conf
+rpcuser=user
+rpcpassword = secret  # keep this safe
+
+  # network
+listen=1
+addnode=1.2.3.4
+addnode=5.6.7.8
+not a setting
+`
+
+////////////////////////////////////////////////////////////////////////////////
+
+func TestConfRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		data string
+	}{
+		{"empty", ""},
+		{"lf", testConf},
+		{"crlf", strings.Replace(testConf, "\n", "\r\n", -1)},
+		{"no final newline", strings.TrimSuffix(testConf, "\n")},
+		{"crlf, no final newline", strings.TrimSuffix(strings.Replace(testConf, "\n", "\r\n", -1), "\r\n")},
+		{"blank lines only", "\n\n\n"},
+		{"mixed endings", "a=1\r\nb=2\nc=3\r\n"},
+	} {
+		if bs := ParseConf([]byte(tc.data)).Bytes(); string(bs) != tc.data {
+			t.Errorf("%s: round trip gave %q, expected %q", tc.name, bs, tc.data)
+		}
+	}
+}
+
+func TestConfGet(t *testing.T) {
+	d := ParseConf([]byte(testConf))
+	for key, expected := range map[string]string{
+		"rpcuser":     "user",
+		"rpcpassword": "secret",
+		"addnode":     "1.2.3.4", // the first one wins
+		"listen":      "1",
+	} {
+		if v, ok := d.Get(key); !ok || v != expected {
+			t.Errorf("%s = %q (%v), expected %q", key, v, ok, expected)
+		}
+	}
+	if _, ok := d.Get("network"); ok {
+		t.Error("found a key in a comment")
+	}
+	if keys := strings.Join(d.Keys(), ","); keys != "rpcuser,rpcpassword,listen,addnode" {
+		t.Errorf("keys = %s", keys)
+	}
+	if vs := strings.Join(d.Values("addnode"), ","); vs != "1.2.3.4,5.6.7.8" {
+		t.Errorf("addnode values = %s", vs)
+	}
+}
+
+func TestConfEdit(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		data     string
+		edit     func(d *ConfDoc)
+		expected string
+	}{
+		{"set in place, keeping the comment", testConf, func(d *ConfDoc) { d.Set("rpcpassword", "new") },
+			strings.Replace(testConf, "rpcpassword = secret  # keep this safe", "rpcpassword=new # keep this safe", 1)},
+		{"set a repeated key", testConf, func(d *ConfDoc) { d.Set("addnode", "9.9.9.9") },
+			strings.Replace(testConf, "addnode=1.2.3.4\naddnode=5.6.7.8", "addnode=9.9.9.9", 1)},
+		{"set a new key", testConf, func(d *ConfDoc) { d.Set("txindex", "1") },
+			testConf + "txindex=1\n"},
+		{"unset", testConf, func(d *ConfDoc) { d.Unset("listen"); d.Unset("addnode") },
+			strings.Replace(testConf, "listen=1\naddnode=1.2.3.4\naddnode=5.6.7.8\n", "", 1)},
+		{"unset a missing key", testConf, func(d *ConfDoc) { d.Unset("txindex") },
+			testConf},
+		{"set in a crlf file", "a=1\r\nb=2\r\n", func(d *ConfDoc) { d.Set("a", "3"); d.Set("c", "4") },
+			"a=3\r\nb=2\r\nc=4\r\n"},
+		{"set in a crlf file without a final newline", "a=1\r\nb=2", func(d *ConfDoc) { d.Set("c", "3") },
+			"a=1\r\nb=2\r\nc=3\r\n"},
+		{"set in a file without a final newline", "a=1", func(d *ConfDoc) { d.Set("b", "2") },
+			"a=1\nb=2\n"},
+		{"set in an empty file", "", func(d *ConfDoc) { d.AddComment("hi"); d.Set("a", "1") },
+			"# hi\na=1\n"},
+	} {
+		d := ParseConf([]byte(tc.data))
+		tc.edit(d)
+		if bs := d.Bytes(); string(bs) != tc.expected {
+			t.Errorf("%s: %q, expected %q", tc.name, bs, tc.expected)
+		}
+	}
+}
+
+func TestConfigCommand(t *testing.T) {
+	c := newTestCoin(t, "user", "secret", freePort(t))
+	fp := c.GetConfFilePath()
+	writeFiles(t, filepath.Dir(fp), map[string]string{filepath.Base(fp): testConf})
+
+	if err := c.Config([]string{"set", "rpcuser", "other"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Config([]string{"unset", "listen"}); err != nil {
+		t.Fatal(err)
+	}
+	expected := strings.Replace(strings.Replace(testConf, "rpcuser=user", "rpcuser=other", 1), "listen=1\n", "", 1)
+	checkFiles(t, filepath.Dir(fp), map[string]string{filepath.Base(fp): expected})
+
+	for _, args := range [][]string{
+		{"get", "listen"},
+		{"unset", "listen"},
+		{"set", "bad=key", "1"},
+		{"set", "key", "value # comment"},
+		{"set", "key"},
+		{"frobnicate"},
+	} {
+		if err := c.Config(args); err == nil {
+			t.Errorf("config %s succeeded", strings.Join(args, " "))
+		}
+	}
+}
+
+func TestConfNetwork(t *testing.T) {
+	const conf = `rpcport=51473
+addnode=1.1.1.1
+test.rpcport=51475
+testnet=1
+
+[test]
+addnode=2.2.2.2
+addnode=3.3.3.3
+
+[regtest]
+rpcport=51476
+`
+	d := ParseConf([]byte(conf))
+	if n := d.Network(); n != NetworkTest {
+		t.Errorf("network = %s, expected %s", n, NetworkTest)
+	}
+	for _, tc := range []struct {
+		network, key string
+		expected     string // values, comma separated
+	}{
+		{NetworkMain, "rpcport", "51473"},
+		{NetworkMain, "addnode", "1.1.1.1"},
+		{NetworkTest, "rpcport", "51475"}, // "test.key" at the top of the file
+		{NetworkTest, "addnode", "2.2.2.2,3.3.3.3"},
+		{NetworkRegtest, "rpcport", "51476"},
+		{NetworkRegtest, "addnode", "1.1.1.1"}, // not in the section
+		{NetworkRegtest, "txindex", ""},
+	} {
+		vs := d.NetworkValues(tc.network, tc.key)
+		if strings.Join(vs, ",") != tc.expected {
+			t.Errorf("%s %s = %v, expected %s", tc.network, tc.key, vs, tc.expected)
+		}
+		v, ok := d.NetworkGet(tc.network, tc.key)
+		if ok != (len(tc.expected) > 0) || v != strings.Split(tc.expected, ",")[0] {
+			t.Errorf("%s %s: got %q (%v)", tc.network, tc.key, v, ok)
+		}
+	}
+
+	m := d.NetworkMap(NetworkTest)
+	if m["rpcport"] != "51475" || m["addnode"] != "2.2.2.2" || m["testnet"] != "1" {
+		t.Errorf("test settings = %v", m)
+	}
+	for conf, network := range map[string]string{
+		"":                     NetworkMain,
+		"testnet=0":            NetworkMain,
+		"testnet=true":         NetworkTest,
+		"testnet=1\nregtest=1": NetworkRegtest,
+	} {
+		if n := ParseConf([]byte(conf)).Network(); n != network {
+			t.Errorf("%q: network = %s, expected %s", conf, n, network)
+		}
+	}
+}
+
+func TestConfAdd(t *testing.T) {
+	const conf = "addnode=1.1.1.1\nlisten=1\n\n[test]\naddnode=2.2.2.2\n\n# end\n"
+	for _, tc := range []struct {
+		name     string
+		edit     func(d *ConfDoc)
+		expected string
+	}{
+		{"after the key's values", func(d *ConfDoc) { d.Add("addnode", "3.3.3.3") },
+			"addnode=1.1.1.1\naddnode=3.3.3.3\nlisten=1\n\n[test]\naddnode=2.2.2.2\n\n# end\n"},
+		{"in the key's section", func(d *ConfDoc) { d.Add("test.addnode", "3.3.3.3") },
+			"addnode=1.1.1.1\nlisten=1\n\n[test]\naddnode=2.2.2.2\naddnode=3.3.3.3\n\n# end\n"},
+		{"new key at the end of the top of the file", func(d *ConfDoc) { d.Add("txindex", "1") },
+			"addnode=1.1.1.1\nlisten=1\ntxindex=1\n\n[test]\naddnode=2.2.2.2\n\n# end\n"},
+		{"new key at the end of a section", func(d *ConfDoc) { d.Set("test.rpcport", "51475") },
+			"addnode=1.1.1.1\nlisten=1\n\n[test]\naddnode=2.2.2.2\n\n# end\nrpcport=51475\n"},
+		{"new section", func(d *ConfDoc) { d.Add("regtest.addnode", "3.3.3.3") },
+			conf + "\n[regtest]\naddnode=3.3.3.3\n"},
+		{"unset one value", func(d *ConfDoc) { d.Add("addnode", "3.3.3.3"); d.Unset("addnode", "1.1.1.1") },
+			"addnode=3.3.3.3\nlisten=1\n\n[test]\naddnode=2.2.2.2\n\n# end\n"},
+		{"unset in a section only", func(d *ConfDoc) { d.Unset("test.addnode") },
+			"addnode=1.1.1.1\nlisten=1\n\n[test]\n\n# end\n"},
+	} {
+		d := ParseConf([]byte(conf))
+		tc.edit(d)
+		if bs := d.Bytes(); string(bs) != tc.expected {
+			t.Errorf("%s: %q, expected %q", tc.name, bs, tc.expected)
+		}
+	}
+
+	// Adding to an empty document does not start it with a blank line.
+	d := ParseConf(nil)
+	d.Add("test.addnode", "1.1.1.1")
+	if bs := d.Bytes(); string(bs) != "[test]\naddnode=1.1.1.1\n" {
+		t.Errorf("empty document: %q", bs)
+	}
+}
+
+func TestLoadConfIncludes(t *testing.T) {
+	dp := t.TempDir()
+	other := filepath.Join(t.TempDir(), "other.conf")
+	writeFiles(t, dp, map[string]string{
+		"pivx.conf":      "addnode=1.1.1.1\nincludeconf=nodes.conf\nincludeconf=" + other + "\nincludeconf=pivx.conf\n",
+		"nodes.conf":     "addnode=2.2.2.2\nincludeconf=pivx.conf\nincludeconf=more.conf\n",
+		"more.conf":      "addnode=4.4.4.4\n",
+		"missing.conf":   "includeconf=nowhere.conf\n",
+		"duplicate.conf": "includeconf=more.conf\nincludeconf=./more.conf\n",
+	})
+	writeFiles(t, filepath.Dir(other), map[string]string{"other.conf": "addnode=3.3.3.3\n"})
+
+	// Included files are read once, and do not include others.
+	d, err := LoadConfDoc(filepath.Join(dp, "pivx.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vs := strings.Join(d.Values("addnode"), ","); vs != "1.1.1.1,2.2.2.2,3.3.3.3" {
+		t.Errorf("addnode = %s", vs)
+	}
+	if bs := d.Bytes(); strings.Contains(string(bs), "2.2.2.2") {
+		t.Error("included settings written with the conf file")
+	}
+
+	if d, err = LoadConfDoc(filepath.Join(dp, "duplicate.conf")); err != nil {
+		t.Fatal(err)
+	}
+	if vs := d.Values("addnode"); len(vs) != 1 {
+		t.Errorf("file included twice: addnode = %v", vs)
+	}
+
+	if _, err := LoadConfDoc(filepath.Join(dp, "missing.conf")); err == nil || !strings.Contains(err.Error(), "nowhere.conf") {
+		t.Errorf("missing include: err = %v", err)
+	}
+}
+
+func TestMergeConf(t *testing.T) {
+	d := ParseConf([]byte(`# my node
+rpcuser=me
+rpcpassword=hunter2
+masternode=0
+bind=10.0.0.1
+bind=10.0.0.2 # backup
+externalip=1.1.1.1
+externalip=2.2.2.2
+addnode=seed.example.com
+`))
+	MergeConf(d, map[string]string{
+		"rpcuser":            "generated",
+		"rpcpassword":        "generated",
+		"#masternode":        "1",
+		"bind":               "0.0.0.0",
+		"externalip":         "3.3.3.3",
+		"port":               "51472",
+		"#masternodeprivkey": "KEY",
+	}, "rpcuser", "rpcpassword", "masternode")
+
+	expected := `# my node
+rpcuser=me
+rpcpassword=hunter2
+masternode=0
+bind=0.0.0.0
+bind=10.0.0.2 # backup
+externalip=3.3.3.3
+externalip=2.2.2.2
+addnode=seed.example.com
+# masternodeprivkey=KEY
+port=51472
+`
+	if got := string(d.Bytes()); got != expected {
+		t.Errorf("merged conf:\n%s\nexpected:\n%s", got, expected)
+	}
+}
+
+func TestSetFirst(t *testing.T) {
+	d := ParseConf([]byte("bind=a\nbind=b\n[test]\nbind=c\n"))
+	d.SetFirst("bind", "x")
+	d.SetFirst("test.bind", "y")
+	d.SetFirst("test.port", "1")
+
+	if got, expected := string(d.Bytes()), "bind=x\nbind=b\n[test]\nbind=y\nport=1\n"; got != expected {
+		t.Errorf("conf = %q, expected %q", got, expected)
+	}
+}
+
+func TestRedactConfDiff(t *testing.T) {
+	old := []byte("rpcuser=me\nrpcpassword=hunter2\nmasternodeprivkey=KEY1\n[test]\nrpcpassword=testpw\n")
+	new := []byte("rpcuser=me\nrpcpassword=hunter2\n# masternodeprivkey=KEY2\n[test]\nrpcpassword=newpw\n")
+
+	secrets := []string{"rpcpassword", "masternodeprivkey"}
+	a, values := redactConf(old, secrets, nil)
+	b, _ := redactConf(new, secrets, values)
+	diff := UnifiedDiff("pivx.conf", "pivx.conf (configured)", a, b)
+
+	for _, secret := range []string{"hunter2", "KEY1", "KEY2", "testpw", "newpw"} {
+		if strings.Contains(diff, secret) {
+			t.Errorf("diff shows %s:\n%s", secret, diff)
+		}
+	}
+	expected := `--- pivx.conf
++++ pivx.conf (configured)
+@@ -1,5 +1,5 @@
+ rpcuser=me
+ rpcpassword=<redacted>
+-masternodeprivkey=<redacted>
++# masternodeprivkey=<redacted, changed>
+ [test]
+-rpcpassword=<redacted>
++rpcpassword=<redacted, changed>
+`
+	if diff != expected {
+		t.Errorf("diff:\n%s\nexpected:\n%s", diff, expected)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,140 @@
+package coin
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/sabhiram/gomn/types"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+const (
+	// Sizes (in random bytes) of generated RPC credentials.
+	rpcUserSize     = 32
+	rpcPasswordSize = 64
+)
+
+// NewRPCCredentials returns a freshly generated rpcuser and rpcpassword.
+func NewRPCCredentials() (string, string) {
+	return GetRandomHex(rpcUserSize), GetRandomHex(rpcPasswordSize)
+}
+
+// setRPCCredentials sets the rpcuser and rpcpassword in `d`, including in any
+// network section which overrides them.
+func setRPCCredentials(d *ConfDoc, user, password string) {
+	d.Set("rpcuser", user)
+	d.Set("rpcpassword", password)
+	for _, key := range d.Keys() {
+		switch section, name := splitKey(key); {
+		case len(section) == 0:
+		case name == "rpcuser":
+			d.Set(key, user)
+		case name == "rpcpassword":
+			d.Set(key, password)
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// RotateRPCCreds implements the "rotate-rpc-creds" command: generate new RPC
+// credentials in the conf file.  A running daemon is stopped (with the old
+// credentials) first, and restarted on the new ones.  If it does not come
+// back, the old credentials are restored and it is restarted on those.
+func (c *Coin) RotateRPCCreds(args []string) error {
+	rargs := &types.RotateCreds{}
+	fs := flag.NewFlagSet("rotate-rpc-creds", flag.ContinueOnError)
+	fs.StringVar(&rargs.Timeout, "timeout", "5m", "how long to wait for the daemon to stop, and to restart")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	timeout, err := time.ParseDuration(rargs.Timeout)
+	if err != nil {
+		return err
+	}
+
+	d, err := LoadConfDoc(c.state.configFilePath)
+	if err != nil {
+		if FileExists(c.state.configFilePath) {
+			return err
+		}
+		return ErrNoConfFile
+	}
+	old := ParseConf(d.Bytes())
+
+	// The daemon only reads its credentials when it starts, so a running one
+	// has to be stopped while we can still talk to it.
+	err = c.daemonReady()
+	wasRunning := err == nil
+	switch {
+	case err == nil || err == ErrCouldNotConnectToServer:
+	default:
+		return fmt.Errorf("daemon is not ready (%s), try again once it is", err.Error())
+	}
+	wasMasternode := wasRunning && c.masternodeStarted() == nil
+	log.Printf("Rotating %s RPC credentials in %s\n", c.name, c.state.configFilePath)
+	log.Printf("  Daemon running: %t, masternode started: %t\n", wasRunning, wasMasternode)
+
+	if wasRunning {
+		if err := c.StopDaemon(timeout); err != nil {
+			return err
+		}
+	}
+
+	user, password := NewRPCCredentials()
+	setRPCCredentials(d, user, password)
+	if err := c.writeConf(d); err != nil {
+		return err
+	}
+	if !wasRunning {
+		log.Printf("Rotated %s RPC credentials\n", c.name)
+		return nil
+	}
+
+	err = c.startAndWait(wasMasternode, timeout)
+	if err == nil {
+		log.Printf("Rotated %s RPC credentials, the daemon is back up\n", c.name)
+		return nil
+	}
+
+	// Put the old credentials back, they worked before.
+	log.Printf("  Restart failed (%s), restoring the old credentials\n", err.Error())
+	if c.daemonReady() == nil {
+		if serr := c.StopDaemon(timeout); serr != nil {
+			return fmt.Errorf("restart failed (%s), unable to roll back: %s", err.Error(), serr.Error())
+		}
+	}
+	if rerr := c.writeConf(old); rerr != nil {
+		return fmt.Errorf("restart failed (%s), unable to restore the old credentials: %s", err.Error(), rerr.Error())
+	}
+	if rerr := c.startAndWait(wasMasternode, timeout); rerr != nil {
+		return fmt.Errorf("restart failed (%s), restart with the old credentials failed: %s", err.Error(), rerr.Error())
+	}
+	return fmt.Errorf("restart failed (%s), restored the old credentials", err.Error())
+}
+
+// writeConf saves `d` as the coin's conf file and reloads it, so that RPCs
+// use what it says from now on.
+func (c *Coin) writeConf(d *ConfDoc) error {
+	if err := c.SaveConf(d); err != nil {
+		return err
+	}
+	return c.loadConf()
+}
+
+// startAndWait starts the daemon and waits (up to `timeout`) for it to become
+// healthy (see waitHealthy).
+func (c *Coin) startAndWait(masternode bool, timeout time.Duration) error {
+	log.Printf("  Starting %s\n", c.GetDaemonBinPath())
+	if err := c.StartDaemon(); err != nil {
+		return err
+	}
+	return c.waitHealthy(masternode, timeout, 0)
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,212 @@
+package coin
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// confCreds returns the rpcuser and rpcpassword in the coin's conf file.
+func confCreds(t *testing.T, c *Coin) (string, string) {
+	t.Helper()
+	d, err := LoadConfDoc(c.state.configFilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, _ := d.Get("rpcuser")
+	password, _ := d.Get("rpcpassword")
+	return user, password
+}
+
+// newDaemonCoin returns a test coin whose daemon is `fakecoind`, started and
+// healthy.
+func newDaemonCoin(t *testing.T) *Coin {
+	bin := fakeDaemonBin(t)
+	c := newTestCoin(t, "user", "secret", freePort(t))
+	if err := ioutil.WriteFile(filepath.Join(c.GetBinPath(), "pivxd"), bin, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.UpdateDynamic("", "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(d time.Duration) { upgradePollInterval = d }(upgradePollInterval)
+	upgradePollInterval = 100 * time.Millisecond
+
+	if err := c.StartDaemon(); err != nil {
+		t.Fatal(err)
+	}
+	stopOnCleanup(t, c)
+	if err := c.waitHealthy(true, 10*time.Second, 0); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func TestNewRPCCredentials(t *testing.T) {
+	user, password := NewRPCCredentials()
+	if len(user) != 2*rpcUserSize || len(password) != 2*rpcPasswordSize {
+		t.Errorf("credentials of %d and %d chars", len(user), len(password))
+	}
+	if user2, password2 := NewRPCCredentials(); user2 == user || password2 == password {
+		t.Error("credentials repeat")
+	}
+
+	d := ParseConf([]byte("rpcuser=old\nrpcpassword=old\n[test]\nrpcuser=told\nrpcport=1\n[main]\nrpcpassword=mold\n"))
+	setRPCCredentials(d, "u", "p")
+	expected := "rpcuser=u\nrpcpassword=p\n[test]\nrpcuser=u\nrpcport=1\n[main]\nrpcpassword=p\n"
+	if s := string(d.Bytes()); s != expected {
+		t.Errorf("credentials set to:\n%s\nexpected:\n%s", s, expected)
+	}
+}
+
+func TestSaveConfMode(t *testing.T) {
+	c := newTestCoin(t, "user", "secret", 1234)
+	fp := c.state.configFilePath
+	if err := os.Chmod(fp, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// An existing file is tightened, a new one is created private.
+	d, err := LoadConfDoc(fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SaveConf(d); err != nil {
+		t.Fatal(err)
+	}
+	c.state.configFilePath = filepath.Join(t.TempDir(), "new", "pivx.conf")
+	if err := c.SaveConf(d); err != nil {
+		t.Fatal(err)
+	}
+	for _, fp := range []string{fp, c.state.configFilePath} {
+		if st, err := os.Stat(fp); err != nil || st.Mode().Perm() != ConfFilePerm {
+			t.Errorf("%s: mode = %v (%v), expected %v", fp, st.Mode().Perm(), err, ConfFilePerm)
+		}
+	}
+	if st, _ := os.Stat(filepath.Dir(c.state.configFilePath)); st.Mode().Perm() != 0700 {
+		t.Errorf("new data directory has mode %v, expected 0700", st.Mode().Perm())
+	}
+}
+
+func TestSaveConfOwner(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("requires root to chown files")
+	}
+	c := newTestCoin(t, "user", "secret", 1234)
+	d, err := LoadConfDoc(c.state.configFilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Run as root for a user whose home we write into, the new data
+	// directory and conf file belong to that user.
+	home := t.TempDir()
+	if err := os.Chown(home, 1234, 1234); err != nil {
+		t.Fatal(err)
+	}
+	c.state.configFilePath = filepath.Join(home, ".pivx", "pivx.conf")
+	if err := c.SaveConf(d); err != nil {
+		t.Fatal(err)
+	}
+	for _, fp := range []string{filepath.Dir(c.state.configFilePath), c.state.configFilePath} {
+		if uid, gid, _ := fileOwner(fp); uid != 1234 || gid != 1234 {
+			t.Errorf("%s owned by %d:%d, expected 1234:1234", fp, uid, gid)
+		}
+	}
+
+	// An existing file keeps its owner.
+	if err := os.Chown(c.state.configFilePath, 4321, 4321); err != nil {
+		t.Fatal(err)
+	}
+	d.Set("rpcport", "4321")
+	if err := c.SaveConf(d); err != nil {
+		t.Fatal(err)
+	}
+	if uid, gid, _ := fileOwner(c.state.configFilePath); uid != 4321 || gid != 4321 {
+		t.Errorf("existing conf owned by %d:%d after a save, expected 4321:4321", uid, gid)
+	}
+}
+
+func TestRotateRPCCredsStopped(t *testing.T) {
+	c := newTestCoin(t, "user", "secret", freePort(t))
+	if err := c.RotateRPCCreds(nil); err != nil {
+		t.Fatal(err)
+	}
+	user, password := confCreds(t, c)
+	if user == "user" || password == "secret" || len(user) != 2*rpcUserSize {
+		t.Errorf("credentials not rotated: %s / %s", user, password)
+	}
+	if m, _ := LoadConfFile(c.state.configFilePath); len(m["rpcport"]) == 0 {
+		t.Error("rotation lost the rest of the conf file")
+	}
+
+	c.state.configFilePath = filepath.Join(t.TempDir(), "pivx.conf")
+	if err := c.RotateRPCCreds(nil); err != ErrNoConfFile {
+		t.Errorf("without a conf file: err = %v, expected %v", err, ErrNoConfFile)
+	}
+}
+
+func TestRotateRPCCreds(t *testing.T) {
+	c := newDaemonCoin(t)
+	defer func(d time.Duration) { upgradePollInterval = d }(upgradePollInterval)
+	upgradePollInterval = 100 * time.Millisecond
+
+	if err := c.RotateRPCCreds([]string{"--timeout", "10s"}); err != nil {
+		t.Fatal(err)
+	}
+	user, password := confCreds(t, c)
+	if user == "user" || password == "secret" {
+		t.Fatal("credentials not rotated")
+	}
+
+	// The restarted daemon only answers to the new credentials.
+	if err := c.daemonReady(); err != nil {
+		t.Errorf("daemon not ready on the new credentials: %s", err.Error())
+	}
+	rc := c.RPCClient()
+	rc.User, rc.Password = "user", "secret"
+	if _, err := rc.Do("getinfo", nil); err != ErrAuthorizationFailed {
+		t.Errorf("old credentials: err = %v, expected %v", err, ErrAuthorizationFailed)
+	}
+}
+
+func TestRotateRPCCredsRollback(t *testing.T) {
+	c := newDaemonCoin(t)
+	defer func(d time.Duration) { upgradePollInterval = d }(upgradePollInterval)
+	upgradePollInterval = 100 * time.Millisecond
+
+	// From now on the daemon refuses to start unless it gets the original
+	// credentials.
+	bp := c.GetDaemonBinPath()
+	if err := os.Rename(bp, bp+".real"); err != nil {
+		t.Fatal(err)
+	}
+	script := fmt.Sprintf("#!/bin/sh\ngrep -q '^rpcuser=user$' %q || exit 1\nexec %q \"$@\"\n", c.state.configFilePath, bp+".real")
+	if err := ioutil.WriteFile(bp, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	err := c.RotateRPCCreds([]string{"--timeout", "2s"})
+	if err == nil || !strings.Contains(err.Error(), "restored the old credentials") {
+		t.Fatalf("err = %v, expected the old credentials to be restored", err)
+	}
+	if user, password := confCreds(t, c); user != "user" || password != "secret" {
+		t.Errorf("credentials are %s / %s after the rollback", user, password)
+	}
+	if err := c.daemonReady(); err != nil {
+		t.Errorf("daemon not running after the rollback: %s", err.Error())
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
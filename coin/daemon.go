@@ -35,7 +35,10 @@ func ExecCmd(cmd string, args ...string) (io.ReadCloser, io.ReadCloser, error) {
 ////////////////////////////////////////////////////////////////////////////////
 
 func (c *Coin) StartDaemon() error {
-	stdout, stderr, err := ExecCmd(c.GetDaemonBinPath())
+	stdout, stderr, err := ExecCmd(c.GetDaemonBinPath(), "-datadir="+c.GetDataPath())
+	if err != nil {
+		return err
+	}
 	go func(outp, errp io.ReadCloser) {
 		_, err := ioutil.ReadAll(outp)
 		if err != nil {
@@ -46,7 +49,7 @@ func (c *Coin) StartDaemon() error {
 			fmt.Printf("Unable to read stderr from cmd! %s\n", err.Error())
 		}
 	}(stdout, stderr)
-	return err
+	return nil
 }
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,94 @@
+package coin
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sabhiram/gomn/coin/cointest"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+var fakeDaemon struct {
+	once sync.Once
+	bs   []byte
+	err  error
+}
+
+// fakeDaemonBin returns the `fakecoind` binary, it is only built once per test
+// run.  Tests which need it are skipped in short mode or without a toolchain.
+func fakeDaemonBin(t *testing.T) []byte {
+	if testing.Short() {
+		t.Skip("builds and runs fakecoind")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("requires a go toolchain to build fakecoind")
+	}
+
+	fakeDaemon.once.Do(func() {
+		dir, err := ioutil.TempDir("", "fakecoind")
+		if err != nil {
+			fakeDaemon.err = err
+			return
+		}
+		fp := filepath.Join(dir, "fakecoind")
+		if fakeDaemon.err = cointest.BuildFakeDaemon(fp); fakeDaemon.err == nil {
+			fakeDaemon.bs, fakeDaemon.err = ioutil.ReadFile(fp)
+		}
+	})
+	if fakeDaemon.err != nil {
+		t.Fatal(fakeDaemon.err)
+	}
+	return fakeDaemon.bs
+}
+
+// stopOnCleanup makes sure a daemon started by the test does not outlive it.
+func stopOnCleanup(t *testing.T, c *Coin) {
+	t.Cleanup(func() {
+		if c.daemonReady() == nil {
+			c.StopDaemon(10 * time.Second)
+		}
+	})
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func TestStartDaemon(t *testing.T) {
+	bin := fakeDaemonBin(t)
+	c := newTestCoin(t, "user", "secret", freePort(t))
+	if err := ioutil.WriteFile(filepath.Join(c.GetBinPath(), "pivxd"), bin, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.UpdateDynamic("", "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(d time.Duration) { upgradePollInterval = d }(upgradePollInterval)
+	upgradePollInterval = 100 * time.Millisecond
+
+	if err := c.StartDaemon(); err != nil {
+		t.Fatal(err)
+	}
+	stopOnCleanup(t, c)
+	if err := c.waitHealthy(true, 10*time.Second, 0); err != nil {
+		t.Fatal(err)
+	}
+	if !FileExists(filepath.Join(c.GetDataPath(), "pivxd.pid")) {
+		t.Error("daemon did not write its pidfile")
+	}
+
+	if err := c.StopDaemon(10 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.daemonReady(); err != ErrCouldNotConnectToServer {
+		t.Errorf("daemon still answering after stop: %v", err)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
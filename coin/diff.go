@@ -0,0 +1,138 @@
+package coin
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+const (
+	// diffContext is the number of unchanged lines shown around changes.
+	diffContext = 3
+)
+
+// diffOp is a line of a diff: kept (' '), removed ('-') or added ('+').
+type diffOp struct {
+	kind byte
+	line string
+	a, b int // index of the line in the old / new file (for ' ' and both)
+}
+
+// splitLines splits `data` into lines without their endings.
+func splitLines(data []byte) []string {
+	s := strings.Replace(string(data), "\r\n", "\n", -1)
+	if len(s) == 0 {
+		return []string{}
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffLines returns the edits turning `a` into `b`, based on their longest
+// common subsequence.  Conf files are small, so the quadratic table is fine.
+func diffLines(a, b []string) []diffOp {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	ops := []diffOp{}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i], i, j})
+			i, j = i+1, j+1
+		case j == len(b) || i < len(a) && lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{'-', a[i], i, j})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j], i, j})
+			j++
+		}
+	}
+	return ops
+}
+
+// UnifiedDiff returns the changes between `a` (named `aName`) and `b` (named
+// `bName`) as a unified diff, or an empty string if they are the same.
+func UnifiedDiff(aName, bName string, a, b []byte) string {
+	ops := diffLines(splitLines(a), splitLines(b))
+
+	var buf bytes.Buffer
+	for start := 0; start < len(ops); {
+		// Find the next change, and the end of the hunk around it: changes
+		// closer than twice the context are shown together.
+		first := start
+		for first < len(ops) && ops[first].kind == ' ' {
+			first++
+		}
+		if first == len(ops) {
+			break
+		}
+		end, kept := first, 0
+		for i := first; i < len(ops) && kept <= 2*diffContext; i++ {
+			if ops[i].kind == ' ' {
+				kept++
+			} else {
+				end, kept = i+1, 0
+			}
+		}
+
+		lo, hi := first-diffContext, end+diffContext
+		if lo < start {
+			lo = start
+		}
+		if hi > len(ops) {
+			hi = len(ops)
+		}
+		if buf.Len() == 0 {
+			fmt.Fprintf(&buf, "--- %s\n+++ %s\n", aName, bName)
+		}
+
+		acount, bcount := 0, 0
+		for _, op := range ops[lo:hi] {
+			if op.kind != '+' {
+				acount++
+			}
+			if op.kind != '-' {
+				bcount++
+			}
+		}
+		fmt.Fprintf(&buf, "@@ -%s +%s @@\n", hunkRange(ops[lo].a, acount), hunkRange(ops[lo].b, bcount))
+		for _, op := range ops[lo:hi] {
+			fmt.Fprintf(&buf, "%c%s\n", op.kind, op.line)
+		}
+		start = hi
+	}
+	return buf.String()
+}
+
+// hunkRange formats the range of a hunk starting at (0 based) line `start`, as
+// diff does: an empty range names the line before it.
+func hunkRange(start, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -3,211 +3,55 @@ package coin
 ////////////////////////////////////////////////////////////////////////////////
 
 import (
-	"archive/tar"
-	"archive/zip"
-	"compress/gzip"
-	"crypto/sha256"
-	"encoding/hex"
 	"fmt"
-	"io"
-	"io/ioutil"
 	"log"
-	"net/http"
-	"os"
-	"path/filepath"
 	"strings"
 
+	"github.com/ProtonMail/go-crypto/openpgp"
+
 	"github.com/sabhiram/gomn/types"
 )
 
-////////////////////////////////////////////////////////////////////////////////
-
-// ProgressTracker implements the Write function so we can have it track the number
-// of bytes being written.
-type ProgressTracker struct {
-	total int64 // Number of total bytes
-	count int64 // Number of bytes seen in Reader
-}
-
-// NewProgressTracker returns a instance that implements a writer interface so we
-// can track progress of a download via a tee reader in the caller.
-func NewProgressTracker(total int64) *ProgressTracker {
-	return &ProgressTracker{
-		total: total,
-		count: 0,
-	}
-}
-
-// Write implements the Write function needed to satisfy the Writer interface.
-func (pt *ProgressTracker) Write(bs []byte) (int, error) {
-	n := len(bs)
-	pt.count += int64(n)
-	percent := (pt.count * 10000) / pt.total
-	percr := percent / 100
-	percf := percent % 100
-	fmt.Printf("%02d.%02d%% Done -- %d/%d\r", percr, percf, pt.count, pt.total)
-	return n, nil
-}
-
-////////////////////////////////////////////////////////////////////////////////
-
-// downloadURLToPath fetches a file specified at `url` to `filepath`.
-func downloadURLToPath(url string, filepath string) error {
-	out, err := os.Create(filepath)
-	if err != nil {
-		return err
-	}
-	defer out.Close()
-
-	resp, err := http.Get(url)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	tee := io.TeeReader(resp.Body, NewProgressTracker(resp.ContentLength))
-	_, err = io.Copy(out, tee)
-	return err
-}
-
 ////////////////////////////////////////////////////////////////////////////////
 ////////////////////////////////////////////////////////////////////////////////
 ////////////////////////////////////////////////////////////////////////////////
 
-// extractTarGzip extracts a given source file path into a destination path
-// provided that the input is a valid tar.gz file.
-func extractTarGzip(srcfp, dstdp string) error {
-	log.Printf("  Extracting .tar.gz file into %s\n", dstdp)
-
-	srcf, err := os.Open(srcfp)
-	if err != nil {
-		return err
-	}
-	defer srcf.Close()
-
-	r, err := gzip.NewReader(srcf)
+// fetchAndVerify downloads `url` to `fp`, hashing the file as it streams in.
+// If `checksum` is not empty, the download must match it.
+func fetchAndVerify(url, fp, checksum string) error {
+	cs, err := ParseChecksum(checksum)
 	if err != nil {
 		return err
 	}
-	defer r.Close()
-
-	if err := os.MkdirAll(dstdp, 0755); err != nil {
-		return err
-	}
-
-	tr := tar.NewReader(r)
-	for {
-		hdr, err := tr.Next()
-		switch {
-		case err == io.EOF:
-			return nil // Done!
-		case err != nil:
-			return err // Actual error, bad news
-		case hdr == nil:
-			continue // edge case, unsure if this is valid
-		}
-
-		targetFile := filepath.Join(dstdp, hdr.Name)
-		switch hdr.Typeflag {
-		case tar.TypeDir:
-			if _, err := os.Stat(targetFile); err != nil {
-				if err := os.MkdirAll(targetFile, 0755); err != nil {
-					return err
-				}
-			}
-		case tar.TypeReg:
-			f, err := os.OpenFile(targetFile, os.O_CREATE|os.O_RDWR, os.FileMode(hdr.Mode))
-			if err != nil {
-				return err
-			}
-			defer f.Close()
-
-			if _, err := io.Copy(f, tr); err != nil {
-				return err
-			}
-		}
+	if cs == nil {
+		log.Printf("  Warning: No checksum specified, download will not be verified\n")
 	}
+	return downloadURLToPath(url, fp, cs)
 }
 
-// extractZip extracts a given source file path into a destination path
-// provided that the input is a valid zip file.
-func extractZip(srcfp, dstdp string) error {
-	log.Printf("  Extracting .zip file into %s\n", dstdp)
-
-	r, err := zip.OpenReader(srcfp)
-	if err != nil {
-		return err
-	}
-	defer r.Close()
-
-	if err := os.MkdirAll(dstdp, 0755); err != nil {
-		return err
-	}
-
-	for _, f := range r.File {
-		rc, err := f.Open()
-		if err != nil {
-			return err
-		}
-		defer rc.Close()
-
-		fpath := filepath.Join(dstdp, f.Name)
-		if f.FileInfo().IsDir() {
-			os.MkdirAll(fpath, 755)
-		} else {
-			var fdir string
-			if lastIndex := strings.LastIndex(fpath, string(os.PathSeparator)); lastIndex > -1 {
-				fdir = fpath[:lastIndex]
-			}
-
-			err = os.MkdirAll(fdir, f.Mode())
-			if err != nil {
-				return err
-			}
-
-			fout, err := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode())
-			if err != nil {
-				return err
-			}
-			defer fout.Close()
-
-			_, err = io.Copy(fout, rc)
-			if err != nil {
-				return err
-			}
-		}
-	}
-	return nil
-}
+////////////////////////////////////////////////////////////////////////////////
 
-// extractToPath extracts the given type of compressed file specified in `srcfp`
-// to `dstdp`.
-func extractToPath(ctype, srcfp, dstdp string) error {
-	switch strings.ToLower(ctype) {
-	case "tar.gz":
-		return extractTarGzip(srcfp, dstdp)
-	case "zip":
-		return extractZip(srcfp, dstdp)
-	case "", "none":
-		log.Printf("No compression type specified, need to move downloaded file!\n")
-		// return os.Rename(srcfp, dstdp)
-		return nil
-	default:
-		return fmt.Errorf("unsupported compression type (%s)", ctype)
-	}
+// WalletAsset is the wallet download for a single platform.
+type WalletAsset struct {
+	DownloadURL     string // url to fetch the wallet
+	CompressionType string // type of compression (empty => the downloader's)
+	Sha256sum       string // checksum for the download, "[sha256|sha512:]hex"
+	PathToBins      string // path from destination -> binary directory
 }
 
-////////////////////////////////////////////////////////////////////////////////
-////////////////////////////////////////////////////////////////////////////////
-////////////////////////////////////////////////////////////////////////////////
-
 // WalletDownloader is a per-coin wallet fetcher.
 type WalletDownloader struct {
-	Version         string // version of the wallet
-	DownloadURL     string // url to fetch the wallet
-	CompressionType string // type of compression ["tar.gz", "zip", "none"]
-	Sha256sum       string // shasum for the download
-	PathToBins      string // path from destination -> binary directory
+	Version         string                  // version of the wallet
+	DownloadURL     string                  // url to fetch the wallet
+	CompressionType string                  // type of compression, see RegisteredExtractors (empty => detect)
+	Sha256sum       string                  // checksum for the download, "[sha256|sha512:]hex"
+	PathToBins      string                  // path from destination -> binary directory
+	Assets          map[string]*WalletAsset // "GOOS/GOARCH" -> download, replaces the above (optional)
+	SignedSumsURL   string                  // url of the signed checksum manifest (optional)
+	Keyring         string                  // armored public keys of the release signers
+	Releases        *ReleaseSource          // discovers other versions of the wallet (optional)
+	Mirrors         []string                // fallback urls, directories or local paths (see parseSource)
+	Fastest         bool                    // try the fastest mirror first, rather than in order
 }
 
 // NewWalletDownloader returns a new instance of a wallet downloader.
@@ -220,58 +64,175 @@ func NewWalletDownloader(v, url, ct, sha string) *WalletDownloader {
 	}
 }
 
-// DownloadToPath grabs the underlying wallet file, and checks its sha256sum
-// to verify that it is indeed the expected file. If so, it extracts the
-// contents to the appropriate
-func (w *WalletDownloader) DownloadToPath(walletPath string, override *types.Download) error {
-	sourceURL := w.DownloadURL
+// Resolve returns the downloader to use given the user's `override`s.  If a
+// version is requested, it is looked up from the wallet's release source and
+// replaces the coin's default url and checksums.  Either way, the download
+// for the host's platform (or the one given by `--arch`) is picked if the
+// wallet has per platform assets: an asset without a pinned checksum is
+// refused unless the user gives one (or a signed manifest) to verify it
+// with.  The returned downloader always has a version (named after the
+// download if nothing else).
+func (w *WalletDownloader) Resolve(override *types.Download) (*WalletDownloader, error) {
+	platform := ParsePlatform(override.Arch)
+	rw := *w
+	switch {
+	case len(override.Version) > 0:
+		dw, err := w.resolve(override.Version, platform, override)
+		if err != nil {
+			return nil, err
+		}
+		rw = *dw
+
+	case len(w.Assets) > 0 && len(override.URL) == 0:
+		a, ok := w.Assets[platform]
+		if !ok {
+			return nil, fmt.Errorf("no wallet download available for %s (use --arch or --url)", platform)
+		}
+		if len(a.Sha256sum) == 0 && len(override.ShaSum) == 0 && len(override.SumsURL) == 0 && len(w.SignedSumsURL) == 0 {
+			return nil, fmt.Errorf("no checksum is pinned for the %s wallet, verify it with --shasum or --sums", platform)
+		}
+		rw.DownloadURL = a.DownloadURL
+		rw.Sha256sum = a.Sha256sum
+		rw.PathToBins = a.PathToBins
+		if len(a.CompressionType) > 0 {
+			rw.CompressionType = a.CompressionType
+		}
+		if platform != HostPlatform() {
+			log.Printf("  Using the %s wallet for %s\n", platform, HostPlatform())
+		}
+	}
+	// The platform is settled, resolving again must not change it.
+	rw.Assets = nil
+
 	if len(override.URL) > 0 {
-		sourceURL = override.URL
+		rw.DownloadURL = override.URL
+		rw.Version = ""
+		rw.PathToBins = ""
 	}
-	compressionType := w.CompressionType
 	if len(override.Type) > 0 {
-		compressionType = override.Type
+		rw.CompressionType = override.Type
 	}
-	expShaSum := w.Sha256sum
 	if len(override.ShaSum) > 0 {
-		expShaSum = override.ShaSum
+		rw.Sha256sum = override.ShaSum
 	}
-	log.Printf("  Fetching wallet from %s into %s\n", sourceURL, walletPath)
-
-	// Fetch the file into a temporary file
-	tempFile := filepath.Join(os.TempDir(), "walletdl")
+	if len(override.SumsURL) > 0 {
+		rw.SignedSumsURL = override.SumsURL
+	}
+	if len(override.Mirrors) > 0 {
+		rw.Mirrors = append(strings.Split(override.Mirrors, ","), w.Mirrors...)
+	}
+	rw.Fastest = w.Fastest || override.Fastest
+	if len(rw.Version) == 0 {
+		rw.Version = versionLabel(rw.DownloadURL)
+	}
+	return &rw, nil
+}
 
-	// Try to fetch the wallet to the temporary file
-	if err := downloadURLToPath(sourceURL, tempFile); err != nil {
+// DownloadToPath grabs the underlying wallet file, and checks its checksum
+// to verify that it is indeed the expected file. If so, it extracts the
+// contents to the appropriate
+func (w *WalletDownloader) DownloadToPath(walletPath string, override *types.Download) error {
+	w, err := w.Resolve(override)
+	if err != nil {
 		return err
 	}
+	sourceURL := w.DownloadURL
+	compressionType := w.CompressionType
+	expShaSum := w.Sha256sum
 
-	// Since we have created a file now, make sure the tempfile is removed
-	// regardless of if this function succeeds.
-	defer func(f string) {
-		if err := os.Remove(f); err != nil {
-			log.Printf("Warning: Unable to cleanup temp file: %s\n", f)
+	// If the release publishes a signed checksum manifest, the checksum we
+	// verify the download against comes from it.
+	if len(w.SignedSumsURL) > 0 {
+		sum, err := w.signedChecksum(w.SignedSumsURL, baseName(sourceURL), expShaSum, override.Keyring)
+		if err != nil {
+			return err
 		}
-	}(tempFile)
+		expShaSum = sum
+	}
+	log.Printf("  Fetching wallet %s into %s\n", baseName(sourceURL), walletPath)
 
-	// Verify sha256 sum
-	bs, err := ioutil.ReadFile(tempFile)
+	// Fetch the wallet from the first source that has it, verifying it on
+	// the way, make sure it is cleaned up regardless of if this succeeds.
+	fp, cleanup, err := fetchFromMirrors(sourceURL, w.Mirrors, w.Fastest, expShaSum)
 	if err != nil {
 		return err
 	}
+	defer cleanup()
+
+	// Extract the file to the specified path, the declared compression type is
+	// double checked against the file's contents.
+	return extractToPath(compressionType, fp, walletPath, baseName(sourceURL))
+}
+
+// resolve looks up `version` from the wallet's release source and returns a
+// downloader for its `platform` asset.  A discovered checksum manifest needs a
+// keyring to be verified with, without one the user must pin the checksum
+// with --shasum.
+func (w *WalletDownloader) resolve(version, platform string, override *types.Download) (*WalletDownloader, error) {
+	if w.Releases == nil {
+		return nil, ErrNoReleaseSource
+	}
+	rw, err := w.Releases.Resolve(version, platform)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("  Resolved %s wallet release to %s\n", version, rw.Version)
+
+	rw.CompressionType = w.CompressionType
+	rw.Keyring = w.Keyring
+	rw.Releases = w.Releases
+	rw.Mirrors = w.Mirrors
+	rw.Fastest = w.Fastest
+	if len(rw.SignedSumsURL) > 0 && len(rw.Keyring) == 0 && len(override.Keyring) == 0 {
+		if len(override.ShaSum) == 0 {
+			return nil, fmt.Errorf("no keyring to verify %s with, use --keyring or --shasum", rw.SignedSumsURL)
+		}
+		log.Printf("  Warning: No keyring to verify %s with, using --shasum instead\n", rw.SignedSumsURL)
+		rw.SignedSumsURL = ""
+	}
+	return rw, nil
+}
 
-	t := []byte{}
-	for _, b := range sha256.Sum256(bs) {
-		t = append(t, b)
+// signedChecksum verifies the manifest at `sumsURL` and returns its checksum
+// for `name`.  The manifest is checked against the keys in `keyringFile` if
+// specified, otherwise against the keys bundled with the coin.  A checksum
+// that is already known (`expected`) must agree with the manifest.
+func (w *WalletDownloader) signedChecksum(sumsURL, name, expected, keyringFile string) (string, error) {
+	var (
+		keyring openpgp.EntityList
+		err     error
+	)
+	switch {
+	case len(keyringFile) > 0:
+		keyring, err = ReadKeyringFile(keyringFile)
+	case len(w.Keyring) > 0:
+		keyring, err = ReadKeyring(w.Keyring)
+	default:
+		err = ErrNoKeyring
 	}
-	shasum := hex.EncodeToString(t)
-	if strings.ToLower(shasum) != strings.ToLower(expShaSum) {
-		return fmt.Errorf("shasum for download (%s) does not match expected (%s)", shasum, expShaSum)
+	if err != nil {
+		return "", err
 	}
 
-	// Extract the file to the specified path, we assume that the type of file
-	// is specified at the tail end of the URL.
-	return extractToPath(compressionType, tempFile, walletPath)
+	log.Printf("  Fetching signed checksums from %s\n", sumsURL)
+	m, err := fetchManifest(sumsURL, keyring)
+	if err != nil {
+		return "", err
+	}
+	cs, err := m.Checksum(name)
+	if err != nil {
+		return "", err
+	}
+	log.Printf("  Checksum manifest signed by %s\n", m.Signer)
+
+	exp, err := ParseChecksum(expected)
+	if err != nil {
+		return "", err
+	}
+	if exp != nil && exp.Algo == cs.Algo && exp.Sum != cs.Sum {
+		return "", fmt.Errorf("%s checksum (%s) does not match the signed manifest (%s)", name, exp.Sum, cs.Sum)
+	}
+	return cs.String(), nil
 }
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -279,8 +240,12 @@ func (w *WalletDownloader) DownloadToPath(walletPath string, override *types.Dow
 ////////////////////////////////////////////////////////////////////////////////
 
 type BootstrapDownloader struct {
-	DownloadURL     string // URL to fetch bootstrap archive
-	CompressionType string // type of compression ["tar.gz", "zip", "none"]
+	DownloadURL     string        // URL to fetch bootstrap archive
+	CompressionType string        // type of compression, see RegisteredExtractors (empty => detect)
+	Checksum        string        // optional checksum for the archive, "[sha256|sha512:]hex"
+	Type            BootstrapType // what the archive contains (empty => detect)
+	Mirrors         []string      // fallback urls, directories or local paths (see parseSource)
+	Fastest         bool          // try the fastest mirror first, rather than in order
 }
 
 // NewBootstrapDownloader returns a new instance of a bootstrap downloader.
@@ -302,28 +267,27 @@ func (b *BootstrapDownloader) DownloadToPath(bootstrapPath string, override *typ
 	if len(override.Type) > 0 {
 		compressionType = override.Type
 	}
-	log.Printf("  Fetching bootstrap from %s into %s\n", sourceURL, bootstrapPath)
-
-	// Fetch the file into a temporary file
-	tempFile := filepath.Join(os.TempDir(), "bootstrapdl")
+	expShaSum := b.Checksum
+	if len(override.ShaSum) > 0 {
+		expShaSum = override.ShaSum
+	}
+	mirrors := b.Mirrors
+	if len(override.Mirrors) > 0 {
+		mirrors = append(strings.Split(override.Mirrors, ","), mirrors...)
+	}
+	log.Printf("  Fetching bootstrap %s into %s\n", baseName(sourceURL), bootstrapPath)
 
-	// Try to fetch the wallet to the temporary file
-	if err := downloadURLToPath(sourceURL, tempFile); err != nil {
+	// Fetch the bootstrap from the first source that has it, verifying it on
+	// the way, make sure it is cleaned up regardless of if this succeeds.
+	fp, cleanup, err := fetchFromMirrors(sourceURL, mirrors, b.Fastest || override.Fastest, expShaSum)
+	if err != nil {
 		return err
 	}
+	defer cleanup()
 
-	// Since we have created a file now, make sure the tempfile is removed
-	// regardless of if this function succeeds.
-	defer func(f string) {
-		if err := os.Remove(f); err != nil {
-			log.Printf("Warning: Unable to cleanup temp file: %s\n", f)
-		}
-	}(tempFile)
-
-	// Extract the file to the specified path, we assume that the type of file
-	// is specified at the tail end of the URL.
-	return extractToPath(compressionType, tempFile, bootstrapPath)
-
+	// Extract the file to the specified path, the declared compression type is
+	// double checked against the file's contents.
+	return extractToPath(compressionType, fp, bootstrapPath, baseName(sourceURL))
 }
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,47 @@
+package coin
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sabhiram/gomn/types"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+func TestResolveUnpinnedAsset(t *testing.T) {
+	const sum = "401e238e1989b2efdc6d2ac0af3944f1277b2807f79319ad1366248e870e8fcf"
+	w := &WalletDownloader{
+		Version: "1.0.0",
+		Assets: map[string]*WalletAsset{
+			"linux/amd64": {DownloadURL: "https://example.com/coin-x86_64.tar.gz", Sha256sum: sum},
+			"linux/arm64": {DownloadURL: "https://example.com/coin-aarch64.tar.gz"},
+		},
+	}
+
+	for _, tc := range []struct {
+		name     string
+		override types.Download
+		ok       bool
+	}{
+		{"pinned", types.Download{Arch: "linux/amd64"}, true},
+		{"unpinned", types.Download{Arch: "linux/arm64"}, false},
+		{"unpinned with --shasum", types.Download{Arch: "linux/arm64", ShaSum: sum}, true},
+		{"unpinned with --sums", types.Download{Arch: "linux/arm64", SumsURL: "https://example.com/SHA256SUMS.asc"}, true},
+		{"unpinned with --url", types.Download{Arch: "linux/arm64", URL: "https://example.com/other.tar.gz"}, true},
+	} {
+		rw, err := w.Resolve(&tc.override)
+		switch {
+		case tc.ok && err != nil:
+			t.Errorf("%s: %s", tc.name, err.Error())
+		case !tc.ok && err == nil:
+			t.Errorf("%s: resolved to %s, expected an error", tc.name, rw.DownloadURL)
+		case !tc.ok && !strings.Contains(err.Error(), "--shasum"):
+			t.Errorf("%s: error does not say how to proceed: %s", tc.name, err.Error())
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
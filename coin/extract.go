@@ -0,0 +1,481 @@
+package coin
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// UnsafeEntryError is returned when an archive contains an entry which would
+// be written (or point) outside of the extraction directory.
+type UnsafeEntryError struct {
+	Name   string // name of the entry in the archive
+	Reason string // why it was rejected
+}
+
+func (e *UnsafeEntryError) Error() string {
+	return fmt.Sprintf("unsafe archive entry (%s): %s", e.Name, e.Reason)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// archiveWriter materializes archive entries under `root`, refusing anything
+// that would escape it.  All archive formats funnel through this so that the
+// safety checks live in one place.
+type archiveWriter struct {
+	root     string               // absolute, symlink-free destination directory
+	dirTimes map[string]time.Time // directory mtimes, applied once we are done
+}
+
+func newArchiveWriter(dstdp string) (*archiveWriter, error) {
+	if err := os.MkdirAll(dstdp, 0755); err != nil {
+		return nil, err
+	}
+	root, err := filepath.Abs(dstdp)
+	if err != nil {
+		return nil, err
+	}
+	if root, err = filepath.EvalSymlinks(root); err != nil {
+		return nil, err
+	}
+	return &archiveWriter{
+		root:     root,
+		dirTimes: map[string]time.Time{},
+	}, nil
+}
+
+// target returns the path that the entry `name` should be written to.  The
+// name must be relative, must not climb out of the root and must not pass
+// through a symlink on its way (which could have been planted by an earlier
+// entry in the same archive).
+func (aw *archiveWriter) target(name string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(strings.Replace(name, `\`, "/", -1)))
+	switch {
+	case len(name) == 0 || clean == ".":
+		return "", &UnsafeEntryError{Name: name, Reason: "empty path"}
+	case filepath.IsAbs(clean) || strings.HasPrefix(name, "/") || filepath.VolumeName(clean) != "":
+		return "", &UnsafeEntryError{Name: name, Reason: "absolute path"}
+	case clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)):
+		return "", &UnsafeEntryError{Name: name, Reason: "path escapes destination"}
+	}
+
+	fp := aw.root
+	parts := strings.Split(clean, string(filepath.Separator))
+	for i, part := range parts {
+		fp = filepath.Join(fp, part)
+		if i == len(parts)-1 {
+			break
+		}
+		st, err := os.Lstat(fp)
+		switch {
+		case os.IsNotExist(err):
+			continue
+		case err != nil:
+			return "", err
+		case st.Mode()&os.ModeSymlink != 0:
+			return "", &UnsafeEntryError{Name: name, Reason: "path traverses a symlink"}
+		case !st.IsDir():
+			return "", &UnsafeEntryError{Name: name, Reason: "parent is not a directory"}
+		}
+	}
+	return fp, nil
+}
+
+// clearPath removes any non-directory at `fp` so that it can be replaced.  This
+// avoids writing through a symlink, and lets us replace binaries which may be
+// running.
+func clearPath(fp string) error {
+	st, err := os.Lstat(fp)
+	switch {
+	case os.IsNotExist(err):
+		return nil
+	case err != nil:
+		return err
+	case st.IsDir():
+		return fmt.Errorf("%s already exists and is a directory", fp)
+	}
+	return os.Remove(fp)
+}
+
+// perm strips setuid/setgid/sticky bits from an archived mode.
+func perm(mode os.FileMode, def os.FileMode) os.FileMode {
+	if p := mode.Perm(); p != 0 {
+		return p
+	}
+	return def
+}
+
+func (aw *archiveWriter) dir(name string, mode os.FileMode, mtime time.Time) error {
+	fp, err := aw.target(name)
+	if err != nil {
+		return err
+	}
+	if st, err := os.Lstat(fp); err == nil && !st.IsDir() {
+		return &UnsafeEntryError{Name: name, Reason: "directory would replace a file or link"}
+	}
+
+	// Always keep the directory writable by us, we still need to fill it.
+	m := perm(mode, 0755) | 0700
+	if err := os.MkdirAll(fp, m); err != nil {
+		return err
+	}
+	if err := os.Chmod(fp, m); err != nil {
+		return err
+	}
+	if !mtime.IsZero() {
+		aw.dirTimes[fp] = mtime
+	}
+	return nil
+}
+
+func (aw *archiveWriter) file(name string, r io.Reader, mode os.FileMode, mtime time.Time) error {
+	fp, err := aw.target(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(fp), 0755); err != nil {
+		return err
+	}
+	if err := clearPath(fp); err != nil {
+		return err
+	}
+
+	m := perm(mode, 0644)
+	f, err := os.OpenFile(fp, os.O_CREATE|os.O_EXCL|os.O_WRONLY, m)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	// The umask may have masked off some of the archived bits.
+	if err := os.Chmod(fp, m); err != nil {
+		return err
+	}
+	if !mtime.IsZero() {
+		return os.Chtimes(fp, mtime, mtime)
+	}
+	return nil
+}
+
+// symlink creates a symlink at `name` pointing to `linkname`, which must be
+// relative and must resolve to a location within the root.  Any ".." in the
+// target must lead it, otherwise it could climb back out through another
+// symlink (ex: "dir/link/../..").
+func (aw *archiveWriter) symlink(name, linkname string) error {
+	fp, err := aw.target(name)
+	if err != nil {
+		return err
+	}
+
+	ln := filepath.FromSlash(linkname)
+	if len(ln) == 0 || filepath.IsAbs(ln) || strings.HasPrefix(linkname, "/") {
+		return &UnsafeEntryError{Name: name, Reason: "symlink to absolute path " + linkname}
+	}
+
+	rel, err := filepath.Rel(aw.root, filepath.Dir(fp))
+	if err != nil {
+		return err
+	}
+	depth := 0
+	if rel != "." {
+		depth = len(strings.Split(rel, string(filepath.Separator)))
+	}
+	ups, descended := 0, false
+	for _, part := range strings.Split(strings.Replace(linkname, `\`, "/", -1), "/") {
+		switch {
+		case part == "" || part == ".":
+			continue
+		case part == ".." && descended:
+			return &UnsafeEntryError{Name: name, Reason: "symlink target climbs after descending " + linkname}
+		case part == "..":
+			ups++
+		default:
+			descended = true
+		}
+	}
+	if ups > depth {
+		return &UnsafeEntryError{Name: name, Reason: "symlink escapes destination " + linkname}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(fp), 0755); err != nil {
+		return err
+	}
+	if err := clearPath(fp); err != nil {
+		return err
+	}
+	return os.Symlink(ln, fp)
+}
+
+// hardlink creates a hard link at `name` to the previously extracted regular
+// file `linkname` (relative to the root of the archive).
+func (aw *archiveWriter) hardlink(name, linkname string) error {
+	fp, err := aw.target(name)
+	if err != nil {
+		return err
+	}
+	src, err := aw.target(linkname)
+	if err != nil {
+		return &UnsafeEntryError{Name: name, Reason: "hardlink target: " + err.Error()}
+	}
+	st, err := os.Lstat(src)
+	if err != nil || !st.Mode().IsRegular() {
+		return &UnsafeEntryError{Name: name, Reason: "hardlink to missing or non-regular file " + linkname}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(fp), 0755); err != nil {
+		return err
+	}
+	if err := clearPath(fp); err != nil {
+		return err
+	}
+	return os.Link(src, fp)
+}
+
+// finish applies directory mtimes, this has to happen last since creating
+// entries within a directory updates its mtime.
+func (aw *archiveWriter) finish() error {
+	for fp, mtime := range aw.dirTimes {
+		if err := os.Chtimes(fp, mtime, mtime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// extractTar extracts a tar stream from `r` into `dstdp`.
+func extractTar(r io.Reader, dstdp string) error {
+	aw, err := newArchiveWriter(dstdp)
+	if err != nil {
+		return err
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		switch {
+		case err == io.EOF:
+			return aw.finish() // Done!
+		case err != nil:
+			return err // Actual error, bad news
+		}
+
+		mode := hdr.FileInfo().Mode()
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = aw.dir(hdr.Name, mode, hdr.ModTime)
+		case tar.TypeReg:
+			err = aw.file(hdr.Name, tr, mode, hdr.ModTime)
+		case tar.TypeSymlink:
+			err = aw.symlink(hdr.Name, hdr.Linkname)
+		case tar.TypeLink:
+			err = aw.hardlink(hdr.Name, hdr.Linkname)
+		case tar.TypeXGlobalHeader:
+			continue
+		default:
+			log.Printf("  Warning: Skipping unsupported tar entry %s (type %c)\n", hdr.Name, hdr.Typeflag)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// openDecompressed opens `srcfp` (downloaded as `name`) and wraps it with
+// `decompress`, progress is reported as the file is read.  The returned
+// closer closes everything, and reports how the extraction ended.
+func openDecompressed(srcfp, name string, decompress func(io.Reader) (io.Reader, error)) (io.Reader, func(error), error) {
+	srcf, err := os.Open(srcfp)
+	if err != nil {
+		return nil, nil, err
+	}
+	total := int64(-1)
+	if st, err := srcf.Stat(); err == nil {
+		total = st.Size()
+	}
+	pt := NewProgressTracker("extract", name, total, 0)
+
+	r, err := decompress(io.TeeReader(srcf, pt))
+	if err != nil {
+		pt.Finish(err)
+		srcf.Close()
+		return nil, nil, err
+	}
+	return r, func(err error) {
+		if c, ok := r.(io.Closer); ok {
+			c.Close()
+		}
+		srcf.Close()
+		pt.Finish(err)
+	}, nil
+}
+
+// tarExtractor returns an extractor for tar archives compressed with
+// `decompress`.
+func tarExtractor(decompress func(io.Reader) (io.Reader, error)) Extractor {
+	return ExtractorFunc(func(srcfp, dstdp, name string) error {
+		r, closer, err := openDecompressed(srcfp, name, decompress)
+		if err != nil {
+			return err
+		}
+		err = extractTar(r, dstdp)
+		closer(err)
+		return err
+	})
+}
+
+// fileExtractor returns an extractor for single (optionally compressed)
+// files, which are installed into `dstdp` as `name` minus `ext`.
+func fileExtractor(ext string, decompress func(io.Reader) (io.Reader, error)) Extractor {
+	return ExtractorFunc(func(srcfp, dstdp, name string) error {
+		r, closer, err := openDecompressed(srcfp, name, decompress)
+		if err != nil {
+			return err
+		}
+
+		if trimmed := strings.TrimSuffix(name, ext); len(trimmed) > 0 {
+			name = trimmed
+		}
+		aw, err := newArchiveWriter(dstdp)
+		if err == nil {
+			err = aw.file(filepath.Base(name), r, 0644, time.Time{})
+		}
+		closer(err)
+		return err
+	})
+}
+
+// extractZip extracts a given source file path into a destination path
+// provided that the input is a valid zip file.  Progress is reported in
+// uncompressed bytes.
+func extractZip(srcfp, dstdp, name string) error {
+	r, err := zip.OpenReader(srcfp)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	aw, err := newArchiveWriter(dstdp)
+	if err != nil {
+		return err
+	}
+
+	var total int64
+	for _, f := range r.File {
+		total += int64(f.UncompressedSize64)
+	}
+	pt := NewProgressTracker("extract", name, total, 0)
+	for _, f := range r.File {
+		if err := extractZipEntry(aw, f, pt); err != nil {
+			pt.Finish(err)
+			return err
+		}
+	}
+	err = aw.finish()
+	pt.Finish(err)
+	return err
+}
+
+// extractZipEntry writes a single zip entry, its reader is closed before we
+// move on to the next one.
+func extractZipEntry(aw *archiveWriter, f *zip.File, pt *ProgressTracker) error {
+	mode := f.Mode()
+	if mode.IsDir() {
+		return aw.dir(f.Name, mode, f.Modified)
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	if mode&os.ModeSymlink != 0 {
+		// Zip stores the link target as the entry's contents.
+		bs, err := ioutil.ReadAll(io.LimitReader(rc, 4096))
+		if err != nil {
+			return err
+		}
+		return aw.symlink(f.Name, string(bs))
+	}
+	if !mode.IsRegular() {
+		log.Printf("  Warning: Skipping unsupported zip entry %s (%s)\n", f.Name, mode.String())
+		return nil
+	}
+	return aw.file(f.Name, io.TeeReader(rc, pt), mode, f.Modified)
+}
+
+func gunzip(r io.Reader) (io.Reader, error) {
+	return gzip.NewReader(r)
+}
+
+func bunzip2(r io.Reader) (io.Reader, error) {
+	return bzip2.NewReader(r), nil
+}
+
+func unxz(r io.Reader) (io.Reader, error) {
+	return xz.NewReader(r)
+}
+
+func unzstd(r io.Reader) (io.Reader, error) {
+	d, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return d.IOReadCloser(), nil
+}
+
+func identity(r io.Reader) (io.Reader, error) {
+	return r, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Register the built-in archive formats, the most specific ones come first
+// since they are tried in order when detecting a file's format.
+func init() {
+	for _, f := range []struct {
+		name    string
+		aliases []string
+		match   MatchFunc
+		ext     Extractor
+	}{
+		{"tar.gz", []string{"tgz"}, compressedTar("\x1f\x8b", gunzip), tarExtractor(gunzip)},
+		{"tar.xz", []string{"txz"}, compressedTar("\xfd7zXZ\x00", unxz), tarExtractor(unxz)},
+		{"tar.bz2", []string{"tbz2", "tbz"}, compressedTar("BZh", bunzip2), tarExtractor(bunzip2)},
+		{"tar.zst", []string{"tzst", "tar.zstd"}, compressedTar("\x28\xb5\x2f\xfd", unzstd), tarExtractor(unzstd)},
+		{"tar", nil, isTar, tarExtractor(identity)},
+		{"zip", nil, magic("PK\x03\x04"), ExtractorFunc(extractZip)},
+		{"gz", nil, magic("\x1f\x8b"), fileExtractor(".gz", gunzip)},
+		{"none", []string{""}, nil, fileExtractor("", identity)},
+	} {
+		if err := RegisterExtractor(f.name, f.aliases, f.match, f.ext); err != nil {
+			panic(err.Error())
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,226 @@
+package coin
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/sabhiram/gomn/coin/cointest"
+	"github.com/ulikunitz/xz"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// archiveBuilders maps an extractor format to the cointest builder for it.
+var archiveBuilders = map[string]func([]cointest.Entry) ([]byte, error){
+	"tar.gz": cointest.TarGz,
+	"zip":    cointest.Zip,
+}
+
+// writeArchive builds an archive of `format` with `entries` under `dp`.
+func writeArchive(t *testing.T, dp, format string, entries []cointest.Entry) string {
+	bs, err := archiveBuilders[format](entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fp := filepath.Join(dp, "archive."+format)
+	if err := ioutil.WriteFile(fp, bs, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return fp
+}
+
+// snapshot returns the contents of `fp`, and false if it does not exist.
+func snapshot(fp string) ([]byte, bool) {
+	if _, err := os.Lstat(fp); os.IsNotExist(err) {
+		return nil, false
+	}
+	bs, _ := ioutil.ReadFile(fp)
+	return bs, true
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func TestExtractMaliciousArchives(t *testing.T) {
+	for format := range archiveBuilders {
+		for _, ma := range cointest.MaliciousArchives() {
+			entries := ma.Entries
+			if format == "zip" {
+				// Zip can not represent hardlinks, skip attacks made of them.
+				entries = []cointest.Entry{}
+				for _, e := range ma.Entries {
+					if !e.Hardlink {
+						entries = append(entries, e)
+					}
+				}
+				if len(entries) == 0 {
+					continue
+				}
+			}
+
+			base := t.TempDir()
+			dst := filepath.Join(base, "dst")
+			escape := filepath.Join(base, ma.Escape)
+			before, existed := snapshot(escape)
+
+			src := writeArchive(t, base, format, entries)
+			err := extractToPath(format, src, dst, filepath.Base(src))
+			if _, ok := err.(*UnsafeEntryError); !ok {
+				t.Errorf("%s / %s: err = %v, expected an UnsafeEntryError", format, ma.Name, err)
+			}
+
+			after, exists := snapshot(escape)
+			switch {
+			case !existed && exists:
+				os.Remove(escape)
+				t.Errorf("%s / %s: %s was created", format, ma.Name, escape)
+			case existed && string(before) != string(after):
+				t.Errorf("%s / %s: %s was modified", format, ma.Name, escape)
+			}
+		}
+	}
+}
+
+func TestExtractWalletEntries(t *testing.T) {
+	for format := range archiveBuilders {
+		base := t.TempDir()
+		dst := filepath.Join(base, "dst")
+		entries := cointest.WalletEntries("pivx-1.0.0", "pivxd", "pivx-cli")
+		src := writeArchive(t, base, format, entries)
+		if err := extractToPath(format, src, dst, filepath.Base(src)); err != nil {
+			t.Fatalf("%s: %s", format, err.Error())
+		}
+
+		for _, e := range entries {
+			fp := filepath.Join(dst, filepath.FromSlash(e.Name))
+			st, err := os.Lstat(fp)
+			if e.Hardlink && format == "zip" {
+				continue
+			} else if err != nil {
+				t.Errorf("%s: %s", format, err.Error())
+				continue
+			}
+
+			switch {
+			case e.Hardlink:
+				target, err := os.Stat(filepath.Join(dst, filepath.FromSlash(e.Linkname)))
+				if err != nil || !os.SameFile(st, target) {
+					t.Errorf("%s: %s is not a hardlink to %s", format, e.Name, e.Linkname)
+				}
+			case e.Mode&os.ModeSymlink != 0:
+				if link, err := os.Readlink(fp); err != nil || link != e.Linkname {
+					t.Errorf("%s: %s links to %q (%v), expected %q", format, e.Name, link, err, e.Linkname)
+				}
+			default:
+				if st.Mode() != e.Mode {
+					t.Errorf("%s: %s has mode %s, expected %s", format, e.Name, st.Mode(), e.Mode)
+				}
+				if !st.ModTime().Equal(cointest.ArchiveTime) {
+					t.Errorf("%s: %s has mtime %s, expected %s", format, e.Name, st.ModTime(), cointest.ArchiveTime)
+				}
+				if bs, _ := ioutil.ReadFile(fp); !e.Mode.IsDir() && string(bs) != e.Body {
+					t.Errorf("%s: %s contains %q, expected %q", format, e.Name, bs, e.Body)
+				}
+			}
+		}
+	}
+}
+
+// compress returns `bs` compressed with the writer returned by `fn`.
+func compress(t *testing.T, bs []byte, fn func(io.Writer) (io.WriteCloser, error)) []byte {
+	var buf bytes.Buffer
+	w, err := fn(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(bs)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestExtractFormats(t *testing.T) {
+	entries := cointest.WalletEntries("pivx-1.0.0", "pivxd", "pivx-cli")
+	tgz, err := cointest.TarGz(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(tgz))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tarball, _ := ioutil.ReadAll(zr)
+	zipball, err := cointest.Zip(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gzipW := func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriter(w), nil }
+	xzW := func(w io.Writer) (io.WriteCloser, error) { return xz.NewWriter(w) }
+	zstdW := func(w io.Writer) (io.WriteCloser, error) { return zstd.NewWriter(w) }
+
+	const bin = "pivx-1.0.0/bin/pivxd"
+	for _, tc := range []struct {
+		name     string // name of the download
+		declared string // declared compression type
+		body     []byte
+		detected string // format reported by DetectFormat, "" => unknown
+		file     string // file expected in the destination
+	}{
+		{"w.tar.gz", "tar.gz", tgz, "tar.gz", bin},
+		{"w.tgz", "tgz", tgz, "tar.gz", bin},
+		{"w.tar.xz", "tar.xz", compress(t, tarball, xzW), "tar.xz", bin},
+		{"w.tar.zst", "tar.zst", compress(t, tarball, zstdW), "tar.zst", bin},
+		{"w.tar", "tar", tarball, "tar", bin},
+		{"w.zip", "zip", zipball, "zip", bin},
+		{"w.zip", "", zipball, "zip", bin},
+		{"w.tar.xz", "zip", compress(t, tarball, xzW), "tar.xz", bin},
+		{"bootstrap.dat.gz", "gz", compress(t, []byte("blocks"), gzipW), "gz", "bootstrap.dat"},
+		{"bootstrap.dat.gz", "", compress(t, []byte("blocks"), gzipW), "gz", "bootstrap.dat"},
+		{"pivxd", "none", []byte("#!/bin/sh\n"), "", "pivxd"},
+		{"pivxd", "", []byte("#!/bin/sh\n"), "", "pivxd"},
+		{"pivxd", "tar.gz", []byte("#!/bin/sh\n"), "", "pivxd"},
+	} {
+		base := t.TempDir()
+		src := filepath.Join(base, tc.name)
+		if err := ioutil.WriteFile(src, tc.body, 0644); err != nil {
+			t.Fatal(err)
+		}
+		detected, err := DetectFormat(src)
+		if err == ErrUnknownFormat {
+			detected = ""
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if detected != tc.detected {
+			t.Errorf("%s: detected %q, expected %q", tc.name, detected, tc.detected)
+		}
+
+		dst := filepath.Join(base, "dst")
+		if err := extractToPath(tc.declared, src, dst, tc.name); err != nil {
+			t.Errorf("%s (%s): %s", tc.name, tc.declared, err.Error())
+			continue
+		}
+		if !FileExists(filepath.Join(dst, filepath.FromSlash(tc.file))) {
+			t.Errorf("%s (%s): %s was not extracted", tc.name, tc.declared, tc.file)
+		}
+	}
+
+	// Nothing to fall back on for a format we do not know, and can not
+	// detect.
+	src := filepath.Join(t.TempDir(), "w.rar")
+	ioutil.WriteFile(src, []byte("Rar!"), 0644)
+	if err := extractToPath("rar", src, t.TempDir(), "w.rar"); err == nil {
+		t.Error("extracted an unsupported format")
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,408 @@
+package coin
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+const (
+	downloadAttempts = 5 // number of tries before giving up
+)
+
+var (
+	downloadMinBackoff = time.Second      // initial wait between tries
+	downloadMaxBackoff = 30 * time.Second // maximum wait between tries
+
+	errPartialMismatch = errors.New("partial download no longer matches the remote file")
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// DownloadDir returns the directory where in-flight downloads are staged.
+// Partial files here survive restarts so that they can be resumed.
+func DownloadDir() string {
+	return filepath.Join(GomnDir(), "downloads")
+}
+
+// stagingPath returns a stable path in the download directory for `url`, the
+// same url always maps to the same file so that it can be resumed.
+func stagingPath(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(DownloadDir(), hex.EncodeToString(sum[:8])+"-"+baseName(url))
+}
+
+// claimStaging returns the path to download `url` to, and a function which
+// releases (and removes) it once the download is no longer needed.  The
+// stable stagingPath is used so that an interrupted download is resumed,
+// unless another gomn run is downloading to it right now, in which case a
+// unique path is used instead.
+func claimStaging(url string) (string, func(), error) {
+	if err := os.MkdirAll(DownloadDir(), 0755); err != nil {
+		return "", nil, err
+	}
+
+	fp := stagingPath(url)
+	lock := fp + ".lock"
+	for attempt := 0; attempt < 2; attempt++ {
+		f, err := os.OpenFile(lock, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			fmt.Fprintf(f, "%d\n", os.Getpid())
+			f.Close()
+			return fp, func() {
+				removeDownload(fp, false)
+				os.Remove(lock)
+			}, nil
+		}
+		if !os.IsExist(err) {
+			return "", nil, err
+		}
+
+		// A lock left behind by a run which died is taken over.
+		bs, _ := ioutil.ReadFile(lock)
+		if pid, err := strconv.Atoi(strings.TrimSpace(string(bs))); err == nil && processAlive(pid) {
+			break
+		}
+		os.Remove(lock)
+	}
+
+	f, err := ioutil.TempFile(DownloadDir(), filepath.Base(fp)+".")
+	if err != nil {
+		return "", nil, err
+	}
+	f.Close()
+	log.Printf("  %s is being downloaded by another gomn, using %s\n", baseName(url), f.Name())
+	return f.Name(), func() {
+		removeDownload(f.Name(), true)
+	}, nil
+}
+
+// removeDownload removes the download at `fp`, and its partial data if
+// `partial` is set.
+func removeDownload(fp string, partial bool) {
+	if err := os.Remove(fp); err != nil && !os.IsNotExist(err) {
+		log.Printf("Warning: Unable to cleanup temp file: %s\n", fp)
+	}
+	if partial {
+		os.Remove(fp + ".part")
+		os.Remove(fp + ".part.json")
+	}
+}
+
+// processAlive returns true if the process `pid` is still running.
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	return p.Signal(syscall.Signal(0)) == nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// partialMeta is persisted next to a partial download, it records what we
+// knew about the remote file so that we can tell if it changed underneath us.
+type partialMeta struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	Size         int64  `json:"size"` // total size of the remote file, -1 if unknown
+}
+
+func loadPartialMeta(fp string) *partialMeta {
+	bs, err := ioutil.ReadFile(fp)
+	if err != nil {
+		return nil
+	}
+	pm := &partialMeta{}
+	if err := json.Unmarshal(bs, pm); err != nil {
+		return nil
+	}
+	return pm
+}
+
+func (pm *partialMeta) save(fp string) error {
+	bs, err := json.Marshal(pm)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fp, bs, 0644)
+}
+
+// validator returns the value to send in an `If-Range` header.  Weak ETags
+// can not be used for range requests, fall back to Last-Modified for those.
+func (pm *partialMeta) validator() string {
+	if len(pm.ETag) > 0 && !strings.HasPrefix(pm.ETag, "W/") {
+		return pm.ETag
+	}
+	return pm.LastModified
+}
+
+// matches returns false if `rsp` describes a different version of the file.
+func (pm *partialMeta) matches(rsp *http.Response) bool {
+	if etag := rsp.Header.Get("ETag"); len(etag) > 0 && len(pm.ETag) > 0 && etag != pm.ETag {
+		return false
+	}
+	if lm := rsp.Header.Get("Last-Modified"); len(lm) > 0 && len(pm.LastModified) > 0 && lm != pm.LastModified {
+		return false
+	}
+	return true
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// retryableError wraps errors which are worth retrying (network errors,
+// truncated bodies, server side failures).
+type retryableError struct {
+	err error
+}
+
+func (e *retryableError) Error() string {
+	return e.err.Error()
+}
+
+func retryable(err error) error {
+	return &retryableError{err: err}
+}
+
+// downloadURLToPath fetches a file specified at `url` to `fp`.  The file is
+// downloaded to `fp`.part first, if that exists from a previous attempt the
+// download resumes from where it left off (provided that the server supports
+// range requests and the remote file has not changed).  Failed attempts are
+// retried with exponential backoff.  If `cs` is not nil, the download must
+// match it: such files are served from the download cache when it has them,
+// and added to it once they are verified (see CacheDir).
+func downloadURLToPath(url string, fp string, cs *Checksum) error {
+	if err := os.MkdirAll(filepath.Dir(fp), 0755); err != nil {
+		return err
+	}
+
+	var h, sha hash.Hash
+	if cs != nil {
+		if err := cacheLookup(cs, fp); err == nil {
+			log.Printf("  Using cached copy of %s\n", baseName(url))
+			return nil
+		}
+
+		// The cache is keyed by sha256, compute it alongside if the file is
+		// verified against something else.
+		h = cs.New()
+		if sha = h; cs.Algo != "sha256" {
+			sha = sha256.New()
+			h = multiHash{h, sha}
+		}
+	}
+
+	backoff := downloadMinBackoff
+	for attempt := 1; ; attempt++ {
+		err := fetchURLToPath(url, fp, h)
+		if err == nil {
+			break
+		}
+
+		if _, ok := err.(*retryableError); !ok || attempt == downloadAttempts {
+			return err
+		}
+		log.Printf("  Download failed (%s), retrying in %s (attempt %d of %d)\n",
+			err.Error(), backoff.String(), attempt+1, downloadAttempts)
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > downloadMaxBackoff {
+			backoff = downloadMaxBackoff
+		}
+	}
+
+	if cs == nil {
+		return nil
+	}
+	if err := cs.Verify(h); err != nil {
+		// A complete but bad file should not be resumed next time around.
+		os.Remove(fp)
+		return err
+	}
+	cacheStore(fp, url, hex.EncodeToString(sha.Sum(nil)), cs)
+	return nil
+}
+
+// fetchURLToPath makes a single attempt at completing the download of `url`
+// into `fp`, hashing the file into `h` (if not nil) along the way.
+func fetchURLToPath(url string, fp string, h hash.Hash) error {
+	partFile := fp + ".part"
+	metaFile := fp + ".part.json"
+
+	// Each attempt re-hashes from the start, data we already have on disk is
+	// streamed through the hash before resuming.
+	if h == nil {
+		h = nopHash{}
+	}
+	h.Reset()
+
+	// Figure out how much of the file we already have, discard partial data
+	// that belongs to a different url.
+	var offset int64
+	meta := loadPartialMeta(metaFile)
+	if st, err := os.Stat(partFile); err == nil && meta != nil && meta.URL == url {
+		offset = st.Size()
+	} else {
+		meta = nil
+		os.Remove(partFile)
+		os.Remove(metaFile)
+	}
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		if v := meta.validator(); len(v) > 0 {
+			req.Header.Set("If-Range", v)
+		}
+	}
+
+	resp, err := downloadClient().Do(req)
+	if err != nil {
+		return retryable(err)
+	}
+	defer resp.Body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		start, total, ok := parseContentRange(resp.Header.Get("Content-Range"))
+		if !ok || start != offset || !meta.matches(resp) {
+			discardPartial(partFile, metaFile)
+			return retryable(errPartialMismatch)
+		}
+		if total >= 0 {
+			meta.Size = total
+		}
+		if err := hashFile(partFile, h); err != nil {
+			return err
+		}
+		log.Printf("  Resuming download at %d bytes\n", offset)
+
+	case resp.StatusCode == http.StatusOK:
+		// Either a fresh download, or the server ignored our range request
+		// (unsupported, or the file changed), start over.
+		offset = 0
+		flags = os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+		meta = &partialMeta{
+			URL:          url,
+			ETag:         resp.Header.Get("ETag"),
+			LastModified: resp.Header.Get("Last-Modified"),
+			Size:         resp.ContentLength,
+		}
+
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		// We might already have the whole file, the server tells us how big
+		// it is now ("bytes */total").
+		size := meta.Size
+		var total int64
+		if _, err := fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes */%d", &total); err == nil {
+			size = total
+		}
+		if size == offset {
+			if err := hashFile(partFile, h); err != nil {
+				return err
+			}
+			return finishPartial(partFile, metaFile, fp)
+		}
+		discardPartial(partFile, metaFile)
+		return retryable(errPartialMismatch)
+
+	case resp.StatusCode >= 500,
+		resp.StatusCode == http.StatusRequestTimeout,
+		resp.StatusCode == http.StatusTooManyRequests:
+		return retryable(fmt.Errorf("server returned %s", resp.Status))
+
+	default:
+		return fmt.Errorf("unable to download %s: server returned %s", url, resp.Status)
+	}
+
+	if err := meta.save(metaFile); err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(partFile, flags, 0644)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	total := int64(-1)
+	if resp.ContentLength >= 0 {
+		total = offset + resp.ContentLength
+	}
+	pt := NewProgressTracker("download", baseName(url), total, offset)
+
+	n, err := io.Copy(io.MultiWriter(out, h), io.TeeReader(resp.Body, pt))
+	if err == nil && resp.ContentLength >= 0 && n != resp.ContentLength {
+		err = io.ErrUnexpectedEOF
+	}
+	pt.Finish(err)
+	if err != nil {
+		return retryable(err)
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return finishPartial(partFile, metaFile, fp)
+}
+
+// parseContentRange parses a "bytes start-end/total" header, total is -1 if
+// it is not known ("*").
+func parseContentRange(s string) (int64, int64, bool) {
+	var start, end int64
+	var total string
+	if _, err := fmt.Sscanf(s, "bytes %d-%d/%s", &start, &end, &total); err != nil {
+		return 0, 0, false
+	}
+	size := int64(-1)
+	if total != "*" {
+		if _, err := fmt.Sscanf(total, "%d", &size); err != nil {
+			return 0, 0, false
+		}
+	}
+	return start, size, true
+}
+
+// nopHash is used when the caller does not need a digest of the download.
+type nopHash struct{}
+
+func (nopHash) Write(bs []byte) (int, error) { return len(bs), nil }
+func (nopHash) Sum(b []byte) []byte          { return b }
+func (nopHash) Reset()                       {}
+func (nopHash) Size() int                    { return 0 }
+func (nopHash) BlockSize() int               { return 1 }
+
+func finishPartial(partFile, metaFile, fp string) error {
+	if err := os.Rename(partFile, fp); err != nil {
+		return err
+	}
+	os.Remove(metaFile)
+	return nil
+}
+
+func discardPartial(partFile, metaFile string) {
+	os.Remove(partFile)
+	os.Remove(metaFile)
+}
+
+////////////////////////////////////////////////////////////////////////////////
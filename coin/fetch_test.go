@@ -0,0 +1,298 @@
+package coin
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// fileServer serves `body` with range support.  Requests are recorded, and
+// `handle` (if set) gets the first say on each of them, it returns false to
+// let the file be served.
+type fileServer struct {
+	*httptest.Server
+
+	lock   sync.Mutex
+	body   []byte
+	etag   string
+	reqs   []*http.Request
+	handle func(w http.ResponseWriter, r *http.Request, n int) bool
+}
+
+func newFileServer(t *testing.T, body []byte, etag string) *fileServer {
+	fs := &fileServer{body: body, etag: etag}
+	fs.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fs.lock.Lock()
+		fs.reqs = append(fs.reqs, r)
+		n, body, etag, handle := len(fs.reqs), fs.body, fs.etag, fs.handle
+		fs.lock.Unlock()
+
+		if handle != nil && handle(w, r, n) {
+			return
+		}
+		if len(etag) > 0 {
+			w.Header().Set("ETag", etag)
+		}
+		http.ServeContent(w, r, "file", time.Time{}, bytes.NewReader(body))
+	}))
+	t.Cleanup(fs.Close)
+	return fs
+}
+
+func (fs *fileServer) requests() []*http.Request {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+	return append([]*http.Request{}, fs.reqs...)
+}
+
+// interrupt serves the first `n` bytes of the file and then drops the
+// connection, as if the network went away.
+func (fs *fileServer) interrupt(w http.ResponseWriter, n int) {
+	w.Header().Set("ETag", fs.etag)
+	w.Header().Set("Content-Length", strconv.Itoa(len(fs.body)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(fs.body[:n])
+	w.(http.Flusher).Flush()
+	panic(http.ErrAbortHandler)
+}
+
+func testBody(n int) []byte {
+	bs := make([]byte, n)
+	for i := range bs {
+		bs[i] = byte('a' + i%26)
+	}
+	return bs
+}
+
+func checkFile(t *testing.T, fp string, expected []byte) {
+	t.Helper()
+	bs, err := ioutil.ReadFile(fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(bs, expected) {
+		t.Errorf("%s has %d bytes, expected %d", fp, len(bs), len(expected))
+	}
+	if FileExists(fp+".part") || FileExists(fp+".part.json") {
+		t.Errorf("partial download of %s left behind", fp)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func TestFetchResume(t *testing.T) {
+	body := testBody(64 * 1024)
+	fs := newFileServer(t, body, `"v1"`)
+	fs.handle = func(w http.ResponseWriter, r *http.Request, n int) bool {
+		if n == 1 {
+			fs.interrupt(w, 1000)
+		}
+		return false
+	}
+
+	fp := filepath.Join(t.TempDir(), "wallet.tar.gz")
+	err := fetchURLToPath(fs.URL, fp, nil)
+	if _, ok := err.(*retryableError); !ok {
+		t.Fatalf("interrupted download: err = %v, expected a retryable error", err)
+	}
+	if bs, _ := ioutil.ReadFile(fp + ".part"); len(bs) != 1000 {
+		t.Fatalf("partial file has %d bytes, expected 1000", len(bs))
+	}
+
+	// The part we already have is hashed along with the rest of the file.
+	h := sha256.New()
+	if err := fetchURLToPath(fs.URL, fp, h); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, fp, body)
+	if sum := sha256.Sum256(body); !bytes.Equal(h.Sum(nil), sum[:]) {
+		t.Error("hash of the resumed download does not match the file")
+	}
+
+	reqs := fs.requests()
+	if len(reqs) != 2 {
+		t.Fatalf("%d requests, expected 2", len(reqs))
+	}
+	if r := reqs[1].Header.Get("Range"); r != "bytes=1000-" {
+		t.Errorf("Range = %q, expected %q", r, "bytes=1000-")
+	}
+	if ir := reqs[1].Header.Get("If-Range"); ir != `"v1"` {
+		t.Errorf("If-Range = %q, expected %q", ir, `"v1"`)
+	}
+}
+
+func TestFetchChangedFile(t *testing.T) {
+	old, body := testBody(2000), bytes.Repeat([]byte("new"), 1000)
+	fs := newFileServer(t, old, `"v1"`)
+	fs.handle = func(w http.ResponseWriter, r *http.Request, n int) bool {
+		if n == 1 {
+			fs.interrupt(w, 1000)
+		}
+		return false
+	}
+
+	fp := filepath.Join(t.TempDir(), "wallet.tar.gz")
+	if err := fetchURLToPath(fs.URL, fp, nil); err == nil {
+		t.Fatal("interrupted download succeeded")
+	}
+
+	// The file is replaced before we resume, the If-Range validator no
+	// longer matches, and the server sends all of the new file.
+	fs.lock.Lock()
+	fs.body, fs.etag = body, `"v2"`
+	fs.lock.Unlock()
+	if err := fetchURLToPath(fs.URL, fp, nil); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, fp, body)
+	if r := fs.requests()[1].Header.Get("Range"); len(r) == 0 {
+		t.Error("second request did not try to resume")
+	}
+}
+
+func TestFetchRangeNotSatisfiable(t *testing.T) {
+	body := testBody(3000)
+	fs := newFileServer(t, body, `"v1"`)
+	fp := filepath.Join(t.TempDir(), "wallet.tar.gz")
+
+	// All of the file made it, only the rename did not.
+	ioutil.WriteFile(fp+".part", body, 0644)
+	(&partialMeta{URL: fs.URL, ETag: `"v1"`, Size: int64(len(body))}).save(fp + ".part.json")
+	if err := fetchURLToPath(fs.URL, fp, nil); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, fp, body)
+
+	// More data than the remote file has, start over.
+	fp = filepath.Join(t.TempDir(), "wallet.tar.gz")
+	ioutil.WriteFile(fp+".part", append(body, body...), 0644)
+	(&partialMeta{URL: fs.URL, ETag: `"v1"`, Size: 2 * int64(len(body))}).save(fp + ".part.json")
+	err := fetchURLToPath(fs.URL, fp, nil)
+	if re, ok := err.(*retryableError); !ok || re.err != errPartialMismatch {
+		t.Fatalf("err = %v, expected %v", err, errPartialMismatch)
+	}
+	if FileExists(fp + ".part") {
+		t.Error("mismatched partial download was kept")
+	}
+	if err := fetchURLToPath(fs.URL, fp, nil); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, fp, body)
+}
+
+func TestDownloadRetry(t *testing.T) {
+	defer func(min, max time.Duration) {
+		downloadMinBackoff, downloadMaxBackoff = min, max
+	}(downloadMinBackoff, downloadMaxBackoff)
+	downloadMinBackoff, downloadMaxBackoff = 50*time.Millisecond, 80*time.Millisecond
+
+	body := testBody(10000)
+	fs := newFileServer(t, body, `"v1"`)
+	fs.handle = func(w http.ResponseWriter, r *http.Request, n int) bool {
+		switch n {
+		case 1:
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return true
+		case 2:
+			fs.interrupt(w, 5000)
+		}
+		return false
+	}
+
+	fp := filepath.Join(t.TempDir(), "sub", "wallet.tar.gz")
+	start := time.Now()
+	if err := downloadURLToPath(fs.URL, fp, nil); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, fp, body)
+
+	// Waits of 50ms, then 80ms (capped), between the three attempts.
+	if d := time.Since(start); d < 130*time.Millisecond {
+		t.Errorf("3 attempts took %s, expected backoff", d.String())
+	}
+	reqs := fs.requests()
+	if len(reqs) != 3 {
+		t.Fatalf("%d requests, expected 3", len(reqs))
+	}
+	if r := reqs[2].Header.Get("Range"); r != "bytes=5000-" {
+		t.Errorf("Range = %q, expected %q", r, "bytes=5000-")
+	}
+}
+
+func TestDownloadNoRetry(t *testing.T) {
+	fs := newFileServer(t, nil, "")
+	fs.handle = func(w http.ResponseWriter, r *http.Request, n int) bool {
+		http.NotFound(w, r)
+		return true
+	}
+
+	fp := filepath.Join(t.TempDir(), "wallet.tar.gz")
+	if err := downloadURLToPath(fs.URL, fp, nil); err == nil {
+		t.Fatal("download of a missing file succeeded")
+	}
+	if n := len(fs.requests()); n != 1 {
+		t.Errorf("%d requests for a missing file, expected 1", n)
+	}
+}
+
+func TestClaimStaging(t *testing.T) {
+	url := "https://example.com/" + t.Name() + "/pivx.tar.gz"
+	fp, release, err := claimStaging(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fp != stagingPath(url) {
+		t.Errorf("claimed %s, expected %s", fp, stagingPath(url))
+	}
+	if bs, _ := ioutil.ReadFile(fp + ".lock"); strings.TrimSpace(string(bs)) != strconv.Itoa(os.Getpid()) {
+		t.Errorf("lock holds %q, expected our pid", bs)
+	}
+
+	// While it is claimed, another download of the url goes elsewhere.
+	other, releaseOther, err := claimStaging(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == fp || filepath.Dir(other) != DownloadDir() {
+		t.Errorf("second claim got %s", other)
+	}
+	ioutil.WriteFile(other+".part", []byte("partial"), 0644)
+	releaseOther()
+	if FileExists(other) || FileExists(other+".part") {
+		t.Errorf("%s not cleaned up", other)
+	}
+
+	ioutil.WriteFile(fp, []byte("done"), 0644)
+	release()
+	if FileExists(fp) || FileExists(fp+".lock") {
+		t.Errorf("%s not cleaned up", fp)
+	}
+
+	// Locks left behind by runs which died are taken over.
+	for _, stale := range []string{"999999999\n", "garbage"} {
+		ioutil.WriteFile(fp+".lock", []byte(stale), 0644)
+		claimed, release, err := claimStaging(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if claimed != fp {
+			t.Errorf("lock %q: claimed %s, expected %s", stale, claimed, fp)
+		}
+		release()
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
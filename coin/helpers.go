@@ -3,8 +3,13 @@ package coin
 ////////////////////////////////////////////////////////////////////////////////
 
 import (
+	"io/ioutil"
 	"os"
 	"os/user"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
 )
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -17,6 +22,12 @@ func HomeDir() string {
 	return ""
 }
 
+// GomnDir returns the directory where gomn keeps its own state (downloads
+// etc).
+func GomnDir() string {
+	return filepath.Join(HomeDir(), ".gomn")
+}
+
 // DirExists returns true if `fp` is a directory and exists.
 func DirExists(fp string) bool {
 	if st, err := os.Stat(fp); err == nil && st.IsDir() {
@@ -33,4 +44,80 @@ func FileExists(fp string) bool {
 	return false
 }
 
+// fileOwner returns the uid and gid owning `fp`, ok is false if it does not
+// exist (or the platform has no owners).
+func fileOwner(fp string) (uid, gid int, ok bool) {
+	st, err := os.Stat(fp)
+	if err != nil {
+		return 0, 0, false
+	}
+	sys, ok := st.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return int(sys.Uid), int(sys.Gid), true
+}
+
+// writeFileAtomic writes `data` to `fp` with permissions `perm`, replacing it
+// atomically so that a crash can never leave it half written.  An existing
+// file keeps its owner (if we are allowed to give it away).
+func writeFileAtomic(fp string, data []byte, perm os.FileMode) error {
+	f, err := ioutil.TempFile(filepath.Dir(fp), "."+filepath.Base(fp)+".")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), perm)
+	}
+	if uid, gid, ok := fileOwner(fp); ok && err == nil && os.Geteuid() == 0 {
+		err = os.Chown(f.Name(), uid, gid)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), fp)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// BackupPath returns the timestamped path that `fp` is moved to when it is
+// backed up, ex: "blocks" -> "blocks.backup-20180102-030405".
+func BackupPath(fp string, t time.Time) string {
+	return fp + ".backup-" + t.Format("20060102-150405")
+}
+
+// MoveAside renames `fp` to a timestamped backup next to it, and returns the
+// backup's path.
+func MoveAside(fp string) (string, error) {
+	base := BackupPath(fp, time.Now())
+	bp := base
+	for i := 1; ; i++ {
+		_, err := os.Lstat(bp)
+		if os.IsNotExist(err) {
+			break
+		} else if err != nil {
+			return "", err
+		}
+		bp = base + "." + strconv.Itoa(i)
+	}
+	return bp, os.Rename(fp, bp)
+}
+
+// StagingDir creates a uniquely named directory next to `dst` to prepare its
+// replacement in.  Being on the same filesystem, it can then be renamed into
+// place in one step.
+func StagingDir(dst string) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return "", err
+	}
+	return ioutil.TempDir(filepath.Dir(dst), "."+filepath.Base(dst)+".staging-")
+}
+
 ////////////////////////////////////////////////////////////////////////////////
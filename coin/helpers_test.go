@@ -0,0 +1,57 @@
+package coin
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+func TestBackupPath(t *testing.T) {
+	ts := time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)
+	if bp := BackupPath("/data/blocks", ts); bp != "/data/blocks.backup-20180102-030405" {
+		t.Errorf("backup path = %s", bp)
+	}
+}
+
+func TestMoveAside(t *testing.T) {
+	dp := t.TempDir()
+	fp := filepath.Join(dp, "blocks")
+
+	// Backups made within the same second do not clobber each other.
+	backups := map[string]bool{}
+	for i := 0; i < 3; i++ {
+		body := []byte{byte('a' + i)}
+		if err := ioutil.WriteFile(fp, body, 0644); err != nil {
+			t.Fatal(err)
+		}
+		bp, err := MoveAside(fp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(filepath.Base(bp), "blocks.backup-") || filepath.Dir(bp) != dp {
+			t.Errorf("backup %s is not next to %s", bp, fp)
+		}
+		if FileExists(fp) {
+			t.Errorf("%s still exists after moving it aside", fp)
+		}
+		if bs, _ := ioutil.ReadFile(bp); string(bs) != string(body) {
+			t.Errorf("backup %s contains %q, expected %q", bp, bs, body)
+		}
+		backups[bp] = true
+	}
+	if len(backups) != 3 {
+		t.Errorf("%d distinct backups, expected 3", len(backups))
+	}
+
+	if _, err := MoveAside(filepath.Join(dp, "missing")); err == nil {
+		t.Error("moved aside a file that does not exist")
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
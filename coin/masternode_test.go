@@ -0,0 +1,229 @@
+package coin
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sabhiram/gomn/coin/cointest"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+var (
+	txA = strings.Repeat("ab", 32)
+	txB = strings.Repeat("cd", 32)
+)
+
+func testEntry(alias, txid string, idx int) *MasternodeEntry {
+	return &MasternodeEntry{Alias: alias, Addr: "1.2.3.4:51472", PrivKey: "privkey", TxID: txid, Index: idx}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func TestMasternodeEntry(t *testing.T) {
+	e := testEntry("mn1", txA, 1)
+	if s, expected := e.String(), "mn1 1.2.3.4:51472 privkey "+txA+" 1"; s != expected {
+		t.Errorf("entry = %q, expected %q", s, expected)
+	}
+	if err := e.Validate(); err != nil {
+		t.Error(err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		edit func(e *MasternodeEntry)
+	}{
+		{"no alias", func(e *MasternodeEntry) { e.Alias = "" }},
+		{"alias with a space", func(e *MasternodeEntry) { e.Alias = "mn 1" }},
+		{"commented alias", func(e *MasternodeEntry) { e.Alias = "#mn1" }},
+		{"no privkey", func(e *MasternodeEntry) { e.PrivKey = "" }},
+		{"no port", func(e *MasternodeEntry) { e.Addr = "1.2.3.4" }},
+		{"bad port", func(e *MasternodeEntry) { e.Addr = "1.2.3.4:0" }},
+		{"short txid", func(e *MasternodeEntry) { e.TxID = "abcd" }},
+		{"bad txid", func(e *MasternodeEntry) { e.TxID = strings.Repeat("zz", 32) }},
+		{"bad index", func(e *MasternodeEntry) { e.Index = -1 }},
+	} {
+		e := testEntry("mn1", txA, 1)
+		tc.edit(e)
+		if err := e.Validate(); err == nil {
+			t.Errorf("%s: entry validated", tc.name)
+		}
+	}
+}
+
+func TestParseMasternodeConf(t *testing.T) {
+	es, err := ParseMasternodeConf([]byte("# Masternode config file\n\nmn1 1.2.3.4:51472 privkey " + txA + " 1\n  mn2\t[::1]:51472 key2 " + txB + " 0  \n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(es) != 2 || *es[0] != *testEntry("mn1", txA, 1) || es[1].Alias != "mn2" || es[1].Addr != "[::1]:51472" {
+		t.Errorf("entries = %v", es)
+	}
+
+	for _, conf := range []string{
+		"mn1 1.2.3.4:51472 privkey " + txA + "\n",
+		"mn1 1.2.3.4:51472 privkey " + txA + " x\n",
+	} {
+		if _, err := ParseMasternodeConf([]byte(conf)); err == nil || !strings.Contains(err.Error(), "line 1") {
+			t.Errorf("%q: err = %v, expected an error on line 1", conf, err)
+		}
+	}
+}
+
+func TestAddMasternodeEntry(t *testing.T) {
+	fp := filepath.Join(t.TempDir(), "masternode.conf")
+	header := "# Masternode config file\n"
+	if err := ioutil.WriteFile(fp, []byte(header), 0644); err != nil {
+		t.Fatal(err)
+	}
+	check := func(what string, lines ...string) {
+		t.Helper()
+		bs, _ := ioutil.ReadFile(fp)
+		if expected := header + strings.Join(lines, "\n") + "\n"; string(bs) != expected {
+			t.Errorf("%s: masternode.conf is:\n%s\nexpected:\n%s", what, bs, expected)
+		}
+	}
+
+	mn1, mn2 := testEntry("mn1", txA, 0), testEntry("mn2", txB, 1)
+	for _, e := range []*MasternodeEntry{mn1, mn2} {
+		if added, err := AddMasternodeEntry(fp, e, false); err != nil || !added {
+			t.Fatalf("add %s: added = %v (%v)", e.Alias, added, err)
+		}
+	}
+	check("added", mn1.String(), mn2.String())
+	if st, _ := os.Stat(fp); st.Mode().Perm() != masternodeConfPerm {
+		t.Errorf("mode = %v, expected %v", st.Mode().Perm(), os.FileMode(masternodeConfPerm))
+	}
+
+	// The same entry again is already in, nothing changes.
+	if added, err := AddMasternodeEntry(fp, testEntry("mn1", txA, 0), false); err != nil || added {
+		t.Errorf("same entry again: added = %v (%v)", added, err)
+	}
+
+	// Another masternode by the same name needs --replace, and keeps its place.
+	other := testEntry("mn1", txA, 2)
+	if _, err := AddMasternodeEntry(fp, other, false); err == nil || !strings.Contains(err.Error(), "already has a masternode called mn1") {
+		t.Errorf("same alias: err = %v", err)
+	}
+	check("same alias", mn1.String(), mn2.String())
+	if added, err := AddMasternodeEntry(fp, other, true); err != nil || !added {
+		t.Fatalf("replace: added = %v (%v)", added, err)
+	}
+	check("replaced", other.String(), mn2.String())
+
+	// A collateral can only back one masternode.
+	if _, err := AddMasternodeEntry(fp, testEntry("mn3", txB, 1), false); err == nil || !strings.Contains(err.Error(), "already used by masternode mn2") {
+		t.Errorf("same collateral: err = %v", err)
+	}
+
+	// A new file is created, a broken one is left alone.
+	nfp := filepath.Join(filepath.Dir(fp), "new.conf")
+	if added, err := AddMasternodeEntry(nfp, mn1, false); err != nil || !added {
+		t.Errorf("new file: added = %v (%v)", added, err)
+	}
+	ioutil.WriteFile(fp, []byte("broken\n"), 0600)
+	if _, err := AddMasternodeEntry(fp, mn1, false); err == nil {
+		t.Error("added to a broken masternode.conf")
+	}
+}
+
+func TestGetMasternodeOutputs(t *testing.T) {
+	d, c := newTestDaemon(t)
+
+	outs, err := GetMasternodeOutputs(c.RPCClient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(outs) != 1 || outs[0].TxHash+":0" != d.State().CollateralOutputs[0] || outs[0].OutputIdx != 0 {
+		t.Errorf("outputs = %v, expected %v", outs, d.State().CollateralOutputs)
+	}
+
+	// A malformed output is an RPC error, not a crash of the fake daemon.
+	d.Update(func(s *cointest.State) { s.CollateralOutputs = []string{"nocolon"} })
+	if _, err := GetMasternodeOutputs(c.RPCClient()); err == nil {
+		t.Error("expected an error for a malformed collateral output")
+	}
+	if err := c.daemonReady(); err != nil {
+		t.Errorf("daemonReady: %s", err.Error())
+	}
+}
+
+func TestFindCollateral(t *testing.T) {
+	d, c := newTestDaemon(t)
+	d.Update(func(s *cointest.State) {
+		s.CollateralOutputs = []string{txA + ":0", txA + ":1", txB + ":0"}
+	})
+	used := []*MasternodeEntry{testEntry("mn1", txA, 0)}
+
+	for _, tc := range []struct {
+		name     string
+		txid     string
+		index    int
+		used     []*MasternodeEntry
+		expected string // collateral found, empty => an error
+	}{
+		{"several", "", -1, nil, ""},
+		{"by txid", txB, -1, nil, txB + ":0"},
+		{"by txid and index", txA, 1, nil, txA + ":1"},
+		{"others in use", txA, -1, used, txA + ":1"},
+		{"in use by another", txA, 0, used, ""},
+		{"none matching", txB, 1, nil, ""},
+	} {
+		e := testEntry("mn2", tc.txid, tc.index)
+		err := findCollateral(c.RPCClient(), e, tc.used)
+		switch {
+		case len(tc.expected) == 0 && err == nil:
+			t.Errorf("%s: found %s, expected an error", tc.name, e.Collateral())
+		case len(tc.expected) > 0 && err != nil:
+			t.Errorf("%s: %s", tc.name, err.Error())
+		case len(tc.expected) > 0 && e.Collateral() != tc.expected:
+			t.Errorf("%s: found %s, expected %s", tc.name, e.Collateral(), tc.expected)
+		}
+	}
+
+	// The entry being replaced does not hold on to its own collateral.
+	e := testEntry("mn1", txA, 0)
+	if err := findCollateral(c.RPCClient(), e, used); err != nil || e.Collateral() != txA+":0" {
+		t.Errorf("replaced entry: found %s (%v)", e.Collateral(), err)
+	}
+}
+
+func TestMasternodeConfCommand(t *testing.T) {
+	d, c := newTestDaemon(t)
+	fp := filepath.Join(t.TempDir(), "masternode.conf")
+	rpc := "http://" + d.User + ":" + d.Password + "@" + d.Addr
+	args := []string{"--alias", "mn1", "--addr", "1.2.3.4:51472", "--privkey", "privkey", "--out", fp}
+
+	if err := c.MasternodeConf(append(args, "--rpc", rpc)); err != nil {
+		t.Fatal(err)
+	}
+	bs, _ := ioutil.ReadFile(fp)
+	if expected := testEntry("mn1", txA, 0).String() + "\n"; string(bs) != expected {
+		t.Errorf("masternode.conf is %q, expected %q", bs, expected)
+	}
+	// Again is fine, the entry is already in.
+	if err := c.MasternodeConf(append(args, "--rpc", rpc)); err != nil {
+		t.Error(err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		args []string
+	}{
+		{"no collateral", []string{"--alias", "mn2", "--addr", "1.2.3.4:51472", "--privkey", "k"}},
+		{"no address", []string{"--alias", "mn2", "--privkey", "k", "--txid", txB, "--index", "0"}},
+		{"wrong mainnet port", []string{"--alias", "mn2", "--addr", "1.2.3.4:1234", "--privkey", "k", "--txid", txB, "--index", "0"}},
+		{"collateral in use", append(args[2:], "--alias", "mn2", "--rpc", rpc)},
+	} {
+		if err := c.MasternodeConf(tc.args); err == nil {
+			t.Errorf("%s: masternode-conf succeeded", tc.name)
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,217 @@
+package coin
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+const (
+	probeSize    = 64 << 10         // bytes fetched from each mirror to rank them
+	probeTimeout = 10 * time.Second // mirrors slower than this are ranked last
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// source is a single place a download can be fetched from: a url, or a file
+// on the local filesystem (for `file://` urls and local paths).
+type source struct {
+	url   string // http(s) url of the file
+	local string // path of the file on the local filesystem
+}
+
+func (s source) String() string {
+	if len(s.local) > 0 {
+		return s.local
+	}
+	return s.url
+}
+
+// parseSource returns the source for the file called `name` on `mirror`.  A
+// mirror is either the full url (or path) of the file, or, if it ends in "/"
+// or is a local directory, the location of a directory containing it.
+func parseSource(mirror, name string) source {
+	local := ""
+	switch {
+	case strings.HasPrefix(mirror, "file://"):
+		if u, err := url.Parse(mirror); err == nil {
+			local = u.Path
+		}
+	case !strings.Contains(mirror, "://"):
+		local = mirror
+	}
+
+	if len(local) > 0 {
+		if strings.HasSuffix(local, "/") || DirExists(local) {
+			local = filepath.Join(local, name)
+		}
+		return source{local: local}
+	}
+	if strings.HasSuffix(mirror, "/") {
+		mirror += url.PathEscape(name)
+	}
+	return source{url: mirror}
+}
+
+// sources returns the sources to try for a download from `primary`, followed
+// by its `mirrors`.  If `fastest` is set, they are ranked by how quickly they
+// respond rather than tried in order.
+func sources(primary string, mirrors []string, fastest bool) []source {
+	name := baseName(primary)
+	ret := []source{}
+	seen := map[source]bool{}
+	for _, m := range append([]string{primary}, mirrors...) {
+		m = strings.TrimSpace(m)
+		if len(m) == 0 {
+			continue
+		}
+		if s := parseSource(m, name); !seen[s] {
+			seen[s] = true
+			ret = append(ret, s)
+		}
+	}
+	if fastest && len(ret) > 1 {
+		ret = rankSources(ret)
+	}
+	return ret
+}
+
+// rankSources orders `srcs` by the time it takes to fetch the first
+// `probeSize` bytes from each of them.  Local files are always fastest, and
+// sources which fail to respond go last.
+func rankSources(srcs []source) []source {
+	times := make([]time.Duration, len(srcs))
+	var wg sync.WaitGroup
+	for i, s := range srcs {
+		wg.Add(1)
+		go func(i int, s source) {
+			defer wg.Done()
+			times[i] = probeSource(s)
+		}(i, s)
+	}
+	wg.Wait()
+
+	idx := make([]int, len(srcs))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(a, b int) bool {
+		return times[idx[a]] < times[idx[b]]
+	})
+
+	ret := []source{}
+	for _, i := range idx {
+		if times[i] < probeTimeout {
+			log.Printf("  Mirror %s responded in %s\n", srcs[i], times[i].Round(time.Millisecond))
+		} else {
+			log.Printf("  Mirror %s did not respond\n", srcs[i])
+		}
+		ret = append(ret, srcs[i])
+	}
+	return ret
+}
+
+// probeSource returns how long it takes to start fetching from `s`, or
+// `probeTimeout` if that fails.
+func probeSource(s source) time.Duration {
+	if len(s.local) > 0 {
+		if FileExists(s.local) {
+			return 0
+		}
+		return probeTimeout
+	}
+
+	req, err := http.NewRequest("GET", s.url, nil)
+	if err != nil {
+		return probeTimeout
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=0-%d", probeSize-1))
+	client := &http.Client{Transport: downloadClient().Transport, Timeout: probeTimeout}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return probeTimeout
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		return probeTimeout
+	}
+	if _, err := io.Copy(ioutil.Discard, io.LimitReader(resp.Body, probeSize)); err != nil {
+		return probeTimeout
+	}
+	return time.Since(start)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// fetchFromMirrors fetches the file at `primary`, falling back to each of its
+// `mirrors` in turn (see sources).  Whichever source serves the file, it must
+// match `checksum`.  Returns the path of the verified file and a function to
+// clean it up once it is no longer needed (local files are used in place and
+// are left alone).
+func fetchFromMirrors(primary string, mirrors []string, fastest bool, checksum string) (string, func(), error) {
+	cs, err := ParseChecksum(checksum)
+	if err != nil {
+		return "", nil, err
+	}
+
+	errs := []string{}
+	for _, s := range sources(primary, mirrors, fastest) {
+		var err error
+		if len(s.local) > 0 {
+			log.Printf("  Using local file %s\n", s.local)
+			if err = verifyLocal(s.local, cs); err == nil {
+				return s.local, func() {}, nil
+			}
+		} else {
+			log.Printf("  Fetching %s\n", s.url)
+			// Fetch the file into the download staging area, if a previous
+			// attempt was interrupted this will resume it.
+			fp, release, cerr := claimStaging(s.url)
+			if cerr != nil {
+				return "", nil, cerr
+			}
+			if err = fetchAndVerify(s.url, fp, checksum); err == nil {
+				return fp, release, nil
+			}
+			release()
+		}
+		log.Printf("  Unable to fetch from %s: %s\n", s, err.Error())
+		errs = append(errs, fmt.Sprintf("%s: %s", s, err.Error()))
+	}
+	if len(errs) == 1 {
+		return "", nil, fmt.Errorf("unable to fetch %s", errs[0])
+	}
+	return "", nil, fmt.Errorf("unable to fetch %s from any source (%s)", baseName(primary), strings.Join(errs, "; "))
+}
+
+// verifyLocal checks the local file at `fp` against `cs` (if not nil).
+func verifyLocal(fp string, cs *Checksum) error {
+	if !FileExists(fp) {
+		return fmt.Errorf("%s does not exist", fp)
+	}
+	if cs == nil {
+		log.Printf("  Warning: No checksum specified, %s will not be verified\n", fp)
+		return nil
+	}
+	h := cs.New()
+	if err := hashFile(fp, h); err != nil {
+		return err
+	}
+	return cs.Verify(h)
+}
+
+////////////////////////////////////////////////////////////////////////////////
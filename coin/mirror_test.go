@@ -0,0 +1,170 @@
+package coin
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// missingServer is a file server which 404s everything.
+func missingServer(t *testing.T) *fileServer {
+	fs := newFileServer(t, nil, "")
+	fs.handle = func(w http.ResponseWriter, r *http.Request, n int) bool {
+		http.NotFound(w, r)
+		return true
+	}
+	return fs
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func TestParseSource(t *testing.T) {
+	dir := t.TempDir()
+	for _, tc := range []struct {
+		mirror   string
+		expected source
+	}{
+		{"https://example.com/pivx/pivx.tar.gz", source{url: "https://example.com/pivx/pivx.tar.gz"}},
+		{"https://example.com/pivx/", source{url: "https://example.com/pivx/pivx%201.0.tar.gz"}},
+		{"file:///srv/mirror/pivx.tar.gz", source{local: "/srv/mirror/pivx.tar.gz"}},
+		{"file:///srv/mirror/", source{local: "/srv/mirror/pivx 1.0.tar.gz"}},
+		{"/srv/mirror/other.tar.gz", source{local: "/srv/mirror/other.tar.gz"}},
+		{"/srv/mirror/", source{local: "/srv/mirror/pivx 1.0.tar.gz"}},
+		{dir, source{local: filepath.Join(dir, "pivx 1.0.tar.gz")}},
+	} {
+		if s := parseSource(tc.mirror, "pivx 1.0.tar.gz"); s != tc.expected {
+			t.Errorf("%s: source = %+v, expected %+v", tc.mirror, s, tc.expected)
+		}
+	}
+}
+
+func TestSources(t *testing.T) {
+	srcs := sources("https://a.com/pivx.tar.gz", []string{
+		" https://b.com/dl/ ",
+		"",
+		"https://a.com/pivx.tar.gz",
+		"/srv/mirror/",
+		"https://b.com/dl/pivx.tar.gz",
+	}, false)
+	names := []string{}
+	for _, s := range srcs {
+		names = append(names, s.String())
+	}
+	expected := "https://a.com/pivx.tar.gz,https://b.com/dl/pivx.tar.gz,/srv/mirror/pivx.tar.gz"
+	if strings.Join(names, ",") != expected {
+		t.Errorf("sources = %v, expected the primary then each mirror once (%s)", names, expected)
+	}
+}
+
+func TestFetchFromMirrors(t *testing.T) {
+	emptyCache(t)
+	body := testBody(5000)
+	checksum := sha256Hex(body)
+	primary, bad, good, unused := missingServer(t), newFileServer(t, []byte("evil"), ""),
+		newFileServer(t, body, ""), newFileServer(t, body, "")
+
+	// All sources failing reports each of them.
+	_, _, err := fetchFromMirrors(primary.URL+"/pivx.tar.gz", []string{bad.URL + "/pivx.tar.gz"}, false, checksum)
+	if err == nil || !strings.Contains(err.Error(), primary.URL) || !strings.Contains(err.Error(), bad.URL) {
+		t.Errorf("err = %v, expected both sources to be reported", err)
+	}
+
+	// The primary is missing the file, and the first mirror has the wrong
+	// one, the second mirror is used and the third never asked.
+	fp, cleanup, err := fetchFromMirrors(primary.URL+"/pivx.tar.gz",
+		[]string{bad.URL + "/pivx.tar.gz", good.URL + "/dl/", unused.URL + "/pivx.tar.gz"}, false, checksum)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bs, _ := ioutil.ReadFile(fp); string(bs) != string(body) {
+		t.Errorf("fetched %d bytes, expected %d", len(bs), len(body))
+	}
+	cleanup()
+	if FileExists(fp) {
+		t.Errorf("%s not cleaned up", fp)
+	}
+
+	for _, tc := range []struct {
+		name string
+		fs   *fileServer
+		reqs int
+	}{
+		{"primary", primary, 2},
+		{"bad mirror", bad, 2},
+		{"good mirror", good, 1},
+		{"unused mirror", unused, 0},
+	} {
+		if reqs := tc.fs.requests(); len(reqs) != tc.reqs {
+			t.Errorf("%s: %d requests, expected %d", tc.name, len(reqs), tc.reqs)
+		}
+	}
+	if p := good.requests()[0].URL.Path; p != "/dl/pivx.tar.gz" {
+		t.Errorf("directory mirror was asked for %s", p)
+	}
+}
+
+func TestFetchFromLocalMirrors(t *testing.T) {
+	emptyCache(t)
+	body := testBody(5000)
+	dir := t.TempDir()
+	local := filepath.Join(dir, "pivx.tar.gz")
+	if err := ioutil.WriteFile(local, body, 0644); err != nil {
+		t.Fatal(err)
+	}
+	primary := missingServer(t)
+
+	for _, mirror := range []string{local, dir, dir + "/", "file://" + local, "file://" + dir + "/"} {
+		fp, cleanup, err := fetchFromMirrors(primary.URL+"/pivx.tar.gz", []string{mirror}, false, sha256Hex(body))
+		if err != nil {
+			t.Errorf("%s: %s", mirror, err.Error())
+			continue
+		}
+		cleanup()
+		if fp != local || !FileExists(local) {
+			t.Errorf("%s: fetched %s, expected %s to be used in place", mirror, fp, local)
+		}
+	}
+
+	// Local files are verified like any other.
+	if _, _, err := fetchFromMirrors(local, nil, false, sha256Hex([]byte("evil"))); err == nil {
+		t.Error("local file with the wrong checksum was used")
+	}
+	if _, _, err := fetchFromMirrors(filepath.Join(dir, "missing.tar.gz"), nil, false, ""); err == nil {
+		t.Error("missing local file was used")
+	}
+}
+
+func TestRankSources(t *testing.T) {
+	body := testBody(1000)
+	slow, fast, down := newFileServer(t, body, ""), newFileServer(t, body, ""), newFileServer(t, body, "")
+	slow.handle = func(w http.ResponseWriter, r *http.Request, n int) bool {
+		time.Sleep(200 * time.Millisecond)
+		return false
+	}
+	down.Close()
+	local := filepath.Join(t.TempDir(), "pivx.tar.gz")
+	ioutil.WriteFile(local, body, 0644)
+	missing := filepath.Join(t.TempDir(), "pivx.tar.gz")
+
+	srcs := sources(slow.URL+"/pivx.tar.gz", []string{down.URL + "/", missing, fast.URL + "/", local}, true)
+	names := []string{}
+	for _, s := range srcs {
+		names = append(names, s.String())
+	}
+	expected := []string{local, fast.URL + "/pivx.tar.gz", slow.URL + "/pivx.tar.gz", down.URL + "/pivx.tar.gz", missing}
+	if strings.Join(names, ",") != strings.Join(expected, ",") {
+		t.Errorf("ranked sources = %v, expected %v", names, expected)
+	}
+	if r := fast.requests()[0].Header.Get("Range"); r != "bytes=0-65535" {
+		t.Errorf("probe Range = %q", r)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -7,7 +7,9 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"net"
 	"path/filepath"
+	"strconv"
 
 	"github.com/sabhiram/gomn/coin"
 	"github.com/sabhiram/gomn/types"
@@ -15,7 +17,83 @@ import (
 
 ////////////////////////////////////////////////////////////////////////////////
 
-var ()
+const (
+	// mainnetPort is the port masternodes must be reachable on, on mainnet.
+	mainnetPort = 51472
+)
+
+// mergeKeep are the settings 'configure --merge' leaves alone if the conf file
+// has them (ex: "masternode=0" while the node waits for activation), only the
+// masternode's address and key are updated.
+var mergeKeep = []string{
+	"rpcuser", "rpcpassword", "rpcallowip", "listen", "server", "daemon", "maxconnections",
+	"bind", "masternode",
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// confSchema describes the pivx.conf keys gomn (and masternodes) care about,
+// the daemon accepts many more.
+var confSchema = &coin.ConfSchema{
+	Keys: []*coin.ConfKey{
+		{Name: "rpcuser", Type: coin.ConfString, Required: true, Help: "user for RPC connections"},
+		{Name: "rpcpassword", Type: coin.ConfString, Required: true, Secret: true, Help: "password for RPC connections"},
+		{Name: "rpcport", Type: coin.ConfPort, Help: "port for RPC connections"},
+		{Name: "rpcallowip", Type: coin.ConfString, Multi: true, Help: "IP (or subnet) allowed to connect to RPC"},
+		{Name: "rpcbind", Type: coin.ConfHost, Multi: true, Help: "address to listen for RPC on"},
+		{Name: "port", Type: coin.ConfPort, Help: "port to listen for peers on"},
+		{Name: "listen", Type: coin.ConfBool, Help: "accept connections from peers"},
+		{Name: "server", Type: coin.ConfBool, Help: "accept RPC commands"},
+		{Name: "daemon", Type: coin.ConfBool, Help: "run in the background"},
+		{Name: "testnet", Type: coin.ConfBool, Help: "use the test network"},
+		{Name: "regtest", Type: coin.ConfBool, Help: "use a regression test network"},
+		{Name: "txindex", Type: coin.ConfBool, Help: "keep an index of all transactions"},
+		{Name: "staking", Type: coin.ConfBool, Help: "stake the wallet's coins"},
+		{Name: "maxconnections", Type: coin.ConfInt, Min: 1, Max: 1000, Help: "maximum number of peers"},
+		{Name: "dbcache", Type: coin.ConfInt, Min: 4, Max: 16384, Help: "database cache size in MiB"},
+		{Name: "bind", Type: coin.ConfHost, Multi: true, Help: "address to listen for peers on"},
+		{Name: "externalip", Type: coin.ConfHost, Multi: true, Help: "public address of the node"},
+		{Name: "addnode", Type: coin.ConfHost, Multi: true, Help: "peer to connect to"},
+		{Name: "connect", Type: coin.ConfHost, Multi: true, Help: "only connect to these peers"},
+		{Name: "masternode", Type: coin.ConfBool, Help: "run as a masternode"},
+		{Name: "masternodeprivkey", Type: coin.ConfString, Secret: true, Help: "masternode's private key (see 'createmasternodekey')"},
+		{Name: "masternodeaddr", Type: coin.ConfHostPort, Help: "public address of the masternode"},
+		{Name: "includeconf", Type: coin.ConfString, Multi: true, Help: "conf file to read as well"},
+		{Name: "zmqpubhashblock", Type: coin.ConfString, Help: "zmq endpoint for new block notifications"},
+		{Name: "zmqpubrawtx", Type: coin.ConfString, Help: "zmq endpoint for new transaction notifications"},
+		{Name: "debug", Type: coin.ConfString, Multi: true, Help: "debug logging category"},
+		{Name: "logtimestamps", Type: coin.ConfBool, Help: "prepend log lines with a timestamp"},
+	},
+	Rules: []coin.ConfRule{
+		coin.Exclusive("testnet", "regtest"),
+		coin.Requires("masternode", "1", "masternodeprivkey"),
+		masternodeRule,
+	},
+}
+
+// masternodeRule checks that a masternode can be reached: it must listen, have
+// a public address and use the mainnet port on mainnet.
+func masternodeRule(d *coin.ConfDoc, network string) []string {
+	ret := []string{}
+	if v, _ := d.NetworkGet(network, "masternode"); v != "1" {
+		return ret
+	}
+	if v, _ := d.NetworkGet(network, "listen"); v == "0" {
+		ret = append(ret, "masternode=1 requires listen=1")
+	}
+
+	addr, ok := d.NetworkGet(network, "masternodeaddr")
+	if !ok {
+		if _, ok := d.NetworkGet(network, "externalip"); !ok {
+			ret = append(ret, "masternode=1 requires masternodeaddr (or externalip) to be set")
+		}
+		return ret
+	}
+	if _, p, err := net.SplitHostPort(addr); err == nil && network == coin.NetworkMain && p != strconv.Itoa(mainnetPort) {
+		ret = append(ret, fmt.Sprintf("masternodeaddr must use port %d on mainnet, not %s", mainnetPort, p))
+	}
+	return ret
+}
 
 ////////////////////////////////////////////////////////////////////////////////
 
@@ -53,7 +131,14 @@ func download(c *coin.Coin, args []string) error {
 	cargs := &types.Download{}
 	fs.StringVar(&cargs.URL, "url", "", "override the wallet download URL")
 	fs.StringVar(&cargs.Type, "type", "", "override the wallet download type (compression)")
-	fs.StringVar(&cargs.ShaSum, "shasum", "", "override the wallet's sha256sum")
+	fs.StringVar(&cargs.ShaSum, "shasum", "", "override the wallet's checksum (sha256 or sha512)")
+	fs.StringVar(&cargs.SumsURL, "sums", "", "url of a signed checksum manifest to verify the wallet against")
+	fs.StringVar(&cargs.Keyring, "keyring", "", "file with armored public keys of the release signers")
+	fs.StringVar(&cargs.Version, "version", "", "install a released version instead ('latest' or X.Y.Z)")
+	fs.BoolVar(&cargs.Force, "force", false, "reinstall the version, moving the existing install aside")
+	fs.StringVar(&cargs.Mirrors, "mirrors", "", "comma separated mirrors (urls, file:// urls or directories) to fall back to")
+	fs.BoolVar(&cargs.Fastest, "fastest", false, "try the fastest mirror first, rather than in order")
+	fs.StringVar(&cargs.Arch, "arch", "", "install the wallet for this platform (GOARCH or GOOS/GOARCH) instead")
 	if err := fs.Parse(args); err != nil {
 		return err
 	}
@@ -68,6 +153,12 @@ func bootstrap(c *coin.Coin, args []string) error {
 	cargs := &types.Bootstrap{}
 	fs.StringVar(&cargs.URL, "url", "", "override the bootstrap URL")
 	fs.StringVar(&cargs.Type, "type", "", "override the bootstrap type (compression)")
+	fs.StringVar(&cargs.ShaSum, "shasum", "", "override the bootstrap's checksum (sha256 or sha512)")
+	fs.BoolVar(&cargs.Force, "force", false, "re-bootstrap, moving existing chain data aside")
+	fs.StringVar(&cargs.Mode, "mode", "", "override the bootstrap type ('bootstrap.dat' or 'snapshot')")
+	fs.BoolVar(&cargs.Watch, "watch", false, "start the daemon and watch it import the bootstrap.dat")
+	fs.StringVar(&cargs.Mirrors, "mirrors", "", "comma separated mirrors (urls, file:// urls or directories) to fall back to")
+	fs.BoolVar(&cargs.Fastest, "fastest", false, "try the fastest mirror first, rather than in order")
 	if err := fs.Parse(args); err != nil {
 		return err
 	}
@@ -82,6 +173,8 @@ func configure(c *coin.Coin, args []string) error {
 	cargs := &types.Configure{}
 	fs.StringVar(&cargs.IP, "ip", "", "masternode's fixed IP (required)")
 	fs.StringVar(&cargs.MnPK, "mnpkey", "", "masternode's private key (required)")
+	fs.BoolVar(&cargs.DryRun, "dry-run", false, "print the changes to the conf file as a diff, without writing them")
+	fs.BoolVar(&cargs.Merge, "merge", false, "only update the masternode settings, keeping the credentials and other settings")
 	if err := fs.Parse(args); err != nil {
 		return err
 	}
@@ -94,9 +187,10 @@ func configure(c *coin.Coin, args []string) error {
 		return errors.New("no masternode privatekey specified")
 	}
 
-	return coin.CreateConfFile(c.GetConfFilePath(), map[string]string{
-		"rpcuser":            coin.GetRandomHex(32),
-		"rpcpassword":        coin.GetRandomHex(64),
+	rpcuser, rpcpassword := coin.NewRPCCredentials()
+	return c.ApplyConf(map[string]string{
+		"rpcuser":            rpcuser,
+		"rpcpassword":        rpcpassword,
 		"rpcallowip":         "127.0.0.1",
 		"listen":             "1",
 		"server":             "1",
@@ -107,7 +201,7 @@ func configure(c *coin.Coin, args []string) error {
 		"externalip":         cargs.IP,
 		"masternodeaddr":     fmt.Sprintf("%s:%d", cargs.IP, c.GetPort()),
 		"#masternodeprivkey": cargs.MnPK,
-	})
+	}, mergeKeep, cargs)
 }
 
 func getinfo(c *coin.Coin, args []string) error {
@@ -139,7 +233,7 @@ func init() {
 		////////////////////////////////////////////////////////////
 		// Register coin constants.
 		"pivx",      // Name of the coin
-		51472,       // PIVX port
+		mainnetPort, // PIVX port
 		51473,       // RPC port
 		"pivxd",     // Daemon binaries
 		"pivx-cli",  // Status binaries
@@ -154,9 +248,44 @@ func init() {
 		// Additionally, if the shasum is not set, it will not be checked.
 		&coin.WalletDownloader{
 			Version:         "2.2.1",
-			DownloadURL:     "https://github.com/PIVX-Project/PIVX/releases/download/v2.2.1/pivx-2.2.1-x86_64-linux-gnu.tar.gz",
 			CompressionType: "tar.gz",
-			Sha256sum:       "401e238e1989b2efdc6d2ac0af3944f1277b2807f79319ad1366248e870e8fcf",
+
+			// One build per platform, only the x86_64 checksum is pinned:
+			// the others are refused unless '--shasum' (or '--sums') is
+			// given to verify them with.
+			Assets: map[string]*coin.WalletAsset{
+				"linux/amd64": {
+					DownloadURL: "https://github.com/PIVX-Project/PIVX/releases/download/v2.2.1/pivx-2.2.1-x86_64-linux-gnu.tar.gz",
+					Sha256sum:   "401e238e1989b2efdc6d2ac0af3944f1277b2807f79319ad1366248e870e8fcf",
+					PathToBins:  filepath.Join("pivx-2.2.1", "bin"),
+				},
+				"linux/arm64": {
+					DownloadURL: "https://github.com/PIVX-Project/PIVX/releases/download/v2.2.1/pivx-2.2.1-aarch64-linux-gnu.tar.gz",
+					PathToBins:  filepath.Join("pivx-2.2.1", "bin"),
+				},
+				"linux/arm": {
+					DownloadURL: "https://github.com/PIVX-Project/PIVX/releases/download/v2.2.1/pivx-2.2.1-arm-linux-gnueabihf.tar.gz",
+					PathToBins:  filepath.Join("pivx-2.2.1", "bin"),
+				},
+				"linux/386": {
+					DownloadURL: "https://github.com/PIVX-Project/PIVX/releases/download/v2.2.1/pivx-2.2.1-i686-pc-linux-gnu.tar.gz",
+					PathToBins:  filepath.Join("pivx-2.2.1", "bin"),
+				},
+			},
+
+			// Other versions are discovered from the github releases.
+			Releases: &coin.ReleaseSource{
+				APIURL: "https://api.github.com/repos/PIVX-Project/PIVX/releases",
+				Assets: map[string]string{
+					"linux/amd64":  "pivx-{version}-x86_64-linux-gnu.tar.gz",
+					"linux/arm64":  "pivx-{version}-aarch64-linux-gnu.tar.gz",
+					"linux/arm":    "pivx-{version}-arm-linux-gnueabihf.tar.gz",
+					"linux/386":    "pivx-{version}-i686-pc-linux-gnu.tar.gz",
+					"darwin/amd64": "pivx-{version}-osx*.tar.gz",
+				},
+				SumsAsset:  "SHA256SUMS.asc",
+				PathToBins: filepath.Join("pivx-{version}", "bin"),
+			},
 		},
 
 		////////////////////////////////////////////////////////////
@@ -164,6 +293,7 @@ func init() {
 		&coin.BootstrapDownloader{
 			DownloadURL:     "https://github.com/PIVX-Project/PIVX/releases/download/v2.2.1/pivx-chain-721000-bootstrap.dat.zip",
 			CompressionType: "zip",
+			Type:            coin.BootstrapDat,
 		},
 
 		////////////////////////////////////////////////////////////
@@ -182,6 +312,11 @@ func init() {
 	if err != nil {
 		panic(err.Error())
 	}
+
+	// Register the schema that pivx.conf is validated against.
+	if err := coin.RegisterConfSchema("pivx", confSchema); err != nil {
+		panic(err.Error())
+	}
 }
 
 ////////////////////////////////////////////////////////////////////////////////
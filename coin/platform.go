@@ -0,0 +1,62 @@
+package coin
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"runtime"
+	"strings"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// archAliases maps the names architectures go by in release file names (and
+// `uname -m`) to their GOARCH.
+var archAliases = map[string]string{
+	"x86_64":  "amd64",
+	"x64":     "amd64",
+	"aarch64": "arm64",
+	"armv8":   "arm64",
+	"i386":    "386",
+	"i686":    "386",
+	"x86":     "386",
+	"armhf":   "arm",
+	"armv7":   "arm",
+	"armv7l":  "arm",
+}
+
+// osAliases maps other names for operating systems to their GOOS.
+var osAliases = map[string]string{
+	"macos": "darwin",
+	"osx":   "darwin",
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// HostPlatform returns the platform gomn is running on, as "GOOS/GOARCH".
+func HostPlatform() string {
+	return runtime.GOOS + "/" + runtime.GOARCH
+}
+
+// ParsePlatform returns the "GOOS/GOARCH" platform described by `s`, which is
+// either a "GOOS/GOARCH" pair or just an architecture for the host's OS (ex:
+// "arm64", "aarch64", "i686").  An empty `s` is the host platform.
+func ParsePlatform(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if len(s) == 0 {
+		return HostPlatform()
+	}
+
+	goos, goarch := runtime.GOOS, s
+	if idx := strings.IndexByte(s, '/'); idx >= 0 {
+		goos, goarch = s[:idx], s[idx+1:]
+	}
+	if v, ok := osAliases[goos]; ok {
+		goos = v
+	}
+	if v, ok := archAliases[goarch]; ok {
+		goarch = v
+	}
+	return goos + "/" + goarch
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,437 @@
+package coin
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// ProgressReporter is told how a long running operation (a download, an
+// extraction) is getting along.  A new reporter is made for each operation.
+type ProgressReporter interface {
+	// Start begins the operation `op` (ex: "download") on `name`, `total` is
+	// the number of bytes it will process or < 1 if that is not known.
+	Start(op, name string, total int64)
+
+	// Update reports that `done` bytes have been processed so far.
+	Update(done int64)
+
+	// Finish ends the operation, `err` is nil if it succeeded.
+	Finish(err error)
+}
+
+// ProgressFunc makes a new ProgressReporter.
+type ProgressFunc func() ProgressReporter
+
+////////////////////////////////////////////////////////////////////////////////
+
+const (
+	ProgressAuto = "auto" // a bar on a terminal, log lines otherwise
+)
+
+var (
+	// How often each reporter prints an update, the final state is always
+	// reported.
+	progressBarInterval  = 200 * time.Millisecond
+	progressLogInterval  = 10 * time.Second
+	progressJSONInterval = time.Second
+)
+
+// reporters stores the registered progress reporters by name, and the name
+// of the one in use.  JSON events go to `progressOut`, apart from the
+// commands' own output on stdout.
+var (
+	reportersLock = sync.RWMutex{}
+	reporters     = map[string]ProgressFunc{}
+	progressMode  = ProgressAuto
+	progressOut   = io.Writer(os.Stderr)
+)
+
+// RegisterProgressReporter registers a progress reporter which can be
+// selected by `name` (see SetProgressMode).
+func RegisterProgressReporter(name string, fn ProgressFunc) error {
+	reportersLock.Lock()
+	defer reportersLock.Unlock()
+
+	if _, ok := reporters[name]; ok || name == ProgressAuto {
+		return fmt.Errorf("progress reporter with name=%s already registered", name)
+	}
+	reporters[name] = fn
+	return nil
+}
+
+// RegisteredProgressReporters returns the names of the registered reporters.
+func RegisteredProgressReporters() []string {
+	reportersLock.RLock()
+	defer reportersLock.RUnlock()
+
+	ret := []string{}
+	for name := range reporters {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// SetProgressMode selects the registered progress reporter called `mode`, or
+// "auto" (also for an empty `mode`) for a bar when stdout is a terminal and
+// log lines when it is not.
+func SetProgressMode(mode string) error {
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	if len(mode) == 0 {
+		mode = ProgressAuto
+	}
+
+	reportersLock.Lock()
+	defer reportersLock.Unlock()
+
+	if _, ok := reporters[mode]; !ok && mode != ProgressAuto {
+		return fmt.Errorf("unknown progress mode (%s)", mode)
+	}
+	progressMode = mode
+	return nil
+}
+
+// SetProgressOutput sets where JSON progress events are written (default
+// stderr).
+func SetProgressOutput(w io.Writer) {
+	reportersLock.Lock()
+	defer reportersLock.Unlock()
+
+	progressOut = w
+}
+
+// SetProgressFD writes JSON progress events to the open file descriptor `fd`
+// (ex: 3, for a stream of events with nothing else in it).
+func SetProgressFD(fd int) error {
+	f := os.NewFile(uintptr(fd), fmt.Sprintf("fd%d", fd))
+	if f == nil {
+		return fmt.Errorf("invalid progress file descriptor (%d)", fd)
+	}
+	if _, err := f.Stat(); err != nil {
+		return fmt.Errorf("invalid progress file descriptor (%d): %s", fd, err.Error())
+	}
+	SetProgressOutput(f)
+	return nil
+}
+
+// newProgress returns a reporter for a new operation.
+func newProgress() ProgressReporter {
+	reportersLock.RLock()
+	defer reportersLock.RUnlock()
+
+	mode := progressMode
+	if mode == ProgressAuto {
+		mode = "log"
+		if isTerminal(os.Stdout) {
+			mode = "bar"
+		}
+	}
+	if fn, ok := reporters[mode]; ok {
+		return fn()
+	}
+	return nopProgress{}
+}
+
+// isTerminal returns true if `f` is a terminal (character device).
+func isTerminal(f *os.File) bool {
+	st, err := f.Stat()
+	return err == nil && st.Mode()&os.ModeCharDevice != 0
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// ProgressTracker implements the Write function so we can have it track the
+// number of bytes being written, and tell a ProgressReporter about them.
+type ProgressTracker struct {
+	reporter ProgressReporter
+	count    int64 // Number of bytes seen so far
+}
+
+// NewProgressTracker returns a instance that implements a writer interface so
+// we can track progress of operation `op` on `name` via a tee reader in the
+// caller.  `total` is < 1 if the size is not known.  `offset` bytes (ex: of a
+// resumed download) have already been processed.
+func NewProgressTracker(op, name string, total, offset int64) *ProgressTracker {
+	pt := &ProgressTracker{
+		reporter: newProgress(),
+		count:    offset,
+	}
+	pt.reporter.Start(op, name, total)
+	if offset > 0 {
+		pt.reporter.Update(offset)
+	}
+	return pt
+}
+
+// Write implements the Write function needed to satisfy the Writer interface.
+func (pt *ProgressTracker) Write(bs []byte) (int, error) {
+	n := len(bs)
+	pt.count += int64(n)
+	pt.reporter.Update(pt.count)
+	return n, nil
+}
+
+// Finish reports the end of the operation, `err` is nil if it succeeded.
+func (pt *ProgressTracker) Finish(err error) {
+	pt.reporter.Finish(err)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// progressState is the bookkeeping shared by the built in reporters.
+type progressState struct {
+	op, name string
+	total    int64 // < 1 if unknown
+	done     int64
+	base     int64 // bytes done before we started (ex: resumed downloads)
+	started  time.Time
+	last     time.Time // last time the reporter printed something
+}
+
+func (ps *progressState) Start(op, name string, total int64) {
+	ps.op, ps.name, ps.total = op, name, total
+	ps.base = -1
+	ps.started = time.Now()
+}
+
+// update records `done`, and returns true if it has been at least `every`
+// since the last report.
+func (ps *progressState) update(done int64, every time.Duration) bool {
+	if ps.base < 0 {
+		ps.base = done
+	}
+	ps.done = done
+	if time.Since(ps.last) < every {
+		return false
+	}
+	ps.last = time.Now()
+	return true
+}
+
+func (ps *progressState) known() bool {
+	return ps.total > 0
+}
+
+// percent returns how far along we are, only valid if the total is known.
+func (ps *progressState) percent() float64 {
+	p := float64(ps.done) * 100 / float64(ps.total)
+	if p > 100 {
+		p = 100
+	}
+	return p
+}
+
+// speed returns the average rate in bytes per second since we started.
+func (ps *progressState) speed() float64 {
+	secs := time.Since(ps.started).Seconds()
+	if secs <= 0 || ps.base < 0 {
+		return 0
+	}
+	return float64(ps.done-ps.base) / secs
+}
+
+// eta returns the estimated time left, or -1 if it can not be estimated.
+func (ps *progressState) eta() time.Duration {
+	speed := ps.speed()
+	if !ps.known() || speed <= 0 || ps.done >= ps.total {
+		return -1
+	}
+	return time.Duration(float64(ps.total-ps.done) / speed * float64(time.Second))
+}
+
+// summary returns ex: "12.3M of 27.1M, 1.2M/s, ETA 12s".
+func (ps *progressState) summary() string {
+	parts := []string{FormatSize(ps.done)}
+	if ps.known() {
+		parts[0] += " of " + FormatSize(ps.total)
+	}
+	parts = append(parts, FormatSize(int64(ps.speed()))+"/s")
+	if eta := ps.eta(); eta >= 0 {
+		parts = append(parts, "ETA "+eta.Round(time.Second).String())
+	}
+	return strings.Join(parts, ", ")
+}
+
+// label returns ex: "Downloading pivx.tar.gz".
+func (ps *progressState) label() string {
+	op := strings.ToUpper(ps.op[:1]) + ps.op[1:]
+	if strings.HasSuffix(op, "e") {
+		op = op[:len(op)-1]
+	}
+	return op + "ing " + ps.name
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// barProgress draws a bar on a terminal, redrawing it in place.
+type barProgress struct {
+	progressState
+	out   io.Writer
+	width int // characters in the bar
+}
+
+func (bp *barProgress) Update(done int64) {
+	if bp.update(done, progressBarInterval) {
+		bp.draw()
+	}
+}
+
+func (bp *barProgress) Finish(err error) {
+	if err == nil && bp.known() {
+		bp.done = bp.total
+	}
+	bp.draw()
+	fmt.Fprintf(bp.out, "\n")
+}
+
+func (bp *barProgress) draw() {
+	if !bp.known() {
+		fmt.Fprintf(bp.out, "\r%s  %s\x1b[K", bp.label(), bp.summary())
+		return
+	}
+	n := int(bp.percent() * float64(bp.width) / 100)
+	bar := strings.Repeat("=", n)
+	if n < bp.width {
+		bar += ">" + strings.Repeat(" ", bp.width-n-1)
+	}
+	fmt.Fprintf(bp.out, "\r%s [%s] %5.1f%%  %s\x1b[K", bp.label(), bar, bp.percent(), bp.summary())
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// logProgress prints a log line every so often, for output which is not a
+// terminal (ex: a log file).
+type logProgress struct {
+	progressState
+}
+
+func (lp *logProgress) Update(done int64) {
+	// The first update sets the clock, there is nothing to say yet.
+	if lp.last.IsZero() {
+		lp.update(done, 0)
+		return
+	}
+	if !lp.update(done, progressLogInterval) {
+		return
+	}
+	if lp.known() {
+		log.Printf("  %s: %.1f%% (%s)\n", lp.label(), lp.percent(), lp.summary())
+	} else {
+		log.Printf("  %s: %s\n", lp.label(), lp.summary())
+	}
+}
+
+func (lp *logProgress) Finish(err error) {
+	if err != nil || lp.last.IsZero() {
+		// Failures are reported by the caller, and quick operations are not
+		// worth a line of their own.
+		return
+	}
+	log.Printf("  %s: done, %s in %s\n", lp.label(), FormatSize(lp.done),
+		time.Since(lp.started).Round(time.Second).String())
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// progressEvent is a single line of JSON output.
+type progressEvent struct {
+	Event string  `json:"event"` // "start", "progress" or "finish"
+	Op    string  `json:"op"`
+	Name  string  `json:"name"`
+	Total int64   `json:"total"` // -1 if unknown
+	Done  int64   `json:"done"`
+	Speed float64 `json:"bytes_per_sec"`
+	ETA   float64 `json:"eta_secs"` // -1 if unknown
+	Error string  `json:"error,omitempty"`
+	Time  string  `json:"time"`
+}
+
+// jsonProgress prints JSON events, one per line, for automation.
+type jsonProgress struct {
+	progressState
+	enc *json.Encoder
+}
+
+func (jp *jsonProgress) Start(op, name string, total int64) {
+	jp.progressState.Start(op, name, total)
+	jp.emit("start", nil)
+}
+
+func (jp *jsonProgress) Update(done int64) {
+	if jp.update(done, progressJSONInterval) {
+		jp.emit("progress", nil)
+	}
+}
+
+func (jp *jsonProgress) Finish(err error) {
+	jp.emit("finish", err)
+}
+
+func (jp *jsonProgress) emit(event string, err error) {
+	ev := &progressEvent{
+		Event: event,
+		Op:    jp.op,
+		Name:  jp.name,
+		Total: jp.total,
+		Done:  jp.done,
+		Speed: jp.speed(),
+		ETA:   jp.eta().Seconds(),
+		Time:  time.Now().UTC().Format(time.RFC3339),
+	}
+	if !jp.known() {
+		ev.Total = -1
+	}
+	if ev.ETA < 0 {
+		ev.ETA = -1
+	}
+	if err != nil {
+		ev.Error = err.Error()
+	}
+	jp.enc.Encode(ev)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// nopProgress reports nothing.
+type nopProgress struct{}
+
+func (nopProgress) Start(op, name string, total int64) {}
+func (nopProgress) Update(done int64)                  {}
+func (nopProgress) Finish(err error)                   {}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func init() {
+	for name, fn := range map[string]ProgressFunc{
+		"bar": func() ProgressReporter {
+			return &barProgress{out: os.Stdout, width: 30}
+		},
+		"log": func() ProgressReporter {
+			return &logProgress{}
+		},
+		"json": func() ProgressReporter {
+			// Reporters are made with the lock held.
+			return &jsonProgress{enc: json.NewEncoder(progressOut)}
+		},
+		"none": func() ProgressReporter {
+			return nopProgress{}
+		},
+	} {
+		if err := RegisterProgressReporter(name, fn); err != nil {
+			panic(err)
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
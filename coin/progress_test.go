@@ -0,0 +1,142 @@
+package coin
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// jsonEvents selects the json reporter for the test, and returns the buffer
+// its events are written to.
+func jsonEvents(t *testing.T) *bytes.Buffer {
+	defer func(mode string, out io.Writer, every time.Duration) {
+		t.Cleanup(func() {
+			SetProgressMode(mode)
+			SetProgressOutput(out)
+			progressJSONInterval = every
+		})
+	}(progressMode, progressOut, progressJSONInterval)
+
+	var buf bytes.Buffer
+	SetProgressOutput(&buf)
+	progressJSONInterval = 0
+	if err := SetProgressMode("json"); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+// parseEvents parses the events in `buf`, every line must be one.
+func parseEvents(t *testing.T, buf *bytes.Buffer) []progressEvent {
+	t.Helper()
+	evs := []progressEvent{}
+	sc := bufio.NewScanner(buf)
+	for sc.Scan() {
+		ev := progressEvent{}
+		if err := json.Unmarshal(sc.Bytes(), &ev); err != nil {
+			t.Fatalf("%q is not an event: %s", sc.Text(), err.Error())
+		}
+		if _, err := time.Parse(time.RFC3339, ev.Time); err != nil {
+			t.Errorf("event time: %s", err.Error())
+		}
+		evs = append(evs, ev)
+	}
+	return evs
+}
+
+// checkEvents checks that `evs` is a start, progress that only goes forward
+// and a finish, for operation `op` on `name`.
+func checkEvents(t *testing.T, evs []progressEvent, op, name string, total int64) {
+	t.Helper()
+	if len(evs) < 2 || evs[0].Event != "start" || evs[len(evs)-1].Event != "finish" {
+		t.Fatalf("events = %+v, expected a start, then a finish", evs)
+	}
+	last := int64(-1)
+	for i, ev := range evs {
+		if ev.Op != op || ev.Name != name || ev.Total != total {
+			t.Errorf("event %d: %s of %s (%d bytes), expected %s of %s (%d bytes)",
+				i, ev.Op, ev.Name, ev.Total, op, name, total)
+		}
+		if i > 0 && i < len(evs)-1 && ev.Event != "progress" {
+			t.Errorf("event %d: %s, expected progress", i, ev.Event)
+		}
+		if ev.Done < last {
+			t.Errorf("event %d: done went back from %d to %d", i, last, ev.Done)
+		}
+		last = ev.Done
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func TestJSONProgress(t *testing.T) {
+	buf := jsonEvents(t)
+
+	pt := NewProgressTracker("download", "pivx.tar.gz", 300, 100)
+	pt.Write(make([]byte, 100))
+	pt.Write(make([]byte, 100))
+	pt.Finish(nil)
+	evs := parseEvents(t, buf)
+	checkEvents(t, evs, "download", "pivx.tar.gz", 300)
+	if len(evs) != 5 || evs[1].Done != 100 || evs[4].Done != 300 {
+		t.Errorf("events = %+v, expected progress from the offset to the total", evs)
+	}
+
+	// An unknown size, and a failure.
+	pt = NewProgressTracker("extract", "pivx.zip", 0, 0)
+	pt.Write(make([]byte, 10))
+	pt.Finish(errors.New("corrupt archive"))
+	evs = parseEvents(t, buf)
+	checkEvents(t, evs, "extract", "pivx.zip", -1)
+	if last := evs[len(evs)-1]; last.Error != "corrupt archive" || last.ETA != -1 {
+		t.Errorf("finish = %+v, expected the error and no ETA", last)
+	}
+}
+
+func TestJSONProgressDownload(t *testing.T) {
+	buf := jsonEvents(t)
+	body := testBody(64 * 1024)
+	fs := newFileServer(t, body, "")
+
+	fp := filepath.Join(t.TempDir(), "pivx.tar.gz")
+	if err := fetchURLToPath(fs.URL+"/pivx.tar.gz", fp, nil); err != nil {
+		t.Fatal(err)
+	}
+	evs := parseEvents(t, buf)
+	checkEvents(t, evs, "download", "pivx.tar.gz", int64(len(body)))
+	if last := evs[len(evs)-1]; last.Done != int64(len(body)) || len(last.Error) > 0 {
+		t.Errorf("finish = %+v", last)
+	}
+}
+
+func TestSetProgressMode(t *testing.T) {
+	defer SetProgressMode(progressMode)
+	for mode, ok := range map[string]bool{
+		"":      true,
+		"auto":  true,
+		" JSON": true,
+		"none":  true,
+		"fancy": false,
+	} {
+		if err := SetProgressMode(mode); (err == nil) != ok {
+			t.Errorf("%q: err = %v", mode, err)
+		}
+	}
+	if err := RegisterProgressReporter("json", nil); err == nil {
+		t.Error("registered json twice")
+	}
+	if err := SetProgressFD(-1); err == nil {
+		t.Error("set an invalid progress file descriptor")
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
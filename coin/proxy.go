@@ -0,0 +1,178 @@
+package coin
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+const (
+	// TorProxy is the SOCKS5 proxy of a local Tor client, selected with
+	// "--proxy tor".  Host names are resolved by the proxy, so .onion
+	// addresses work too.
+	TorProxy = "socks5://127.0.0.1:9050"
+
+	noProxy = "none" // connect directly, even if a default proxy is set
+)
+
+var (
+	// rpcTimeout bounds a whole RPC request, daemons answer even while they
+	// are warming up so a slow one is as good as down.
+	rpcTimeout = 30 * time.Second
+
+	// idleTimeout bounds how long any request waits to connect or for data.
+	// Downloads are not bounded as a whole, so that large files on slow links
+	// complete as long as they keep making progress.
+	idleTimeout = time.Minute
+)
+
+// proxies stores the default proxy, and the transports built for each proxy
+// so that their connections are reused.
+var (
+	proxyLock       = sync.RWMutex{}
+	defaultProxy    = ""
+	proxyTransports = map[string]*http.Transport{}
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// ParseProxy parses a proxy specification: an "http://", "https://" (HTTP
+// CONNECT) or "socks5://" url, optionally with "user:pass@" credentials, or
+// "tor" for the local Tor client.  "none" (or "direct") returns nil, as does
+// an empty string.
+func ParseProxy(s string) (*url.URL, error) {
+	s = strings.TrimSpace(s)
+	switch strings.ToLower(s) {
+	case "", noProxy, "direct":
+		return nil, nil
+	case "tor":
+		s = TorProxy
+	}
+
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy (%s): %s", s, err.Error())
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme (%s), expected http, https or socks5", u.Scheme)
+	}
+	if len(u.Host) == 0 {
+		return nil, fmt.Errorf("invalid proxy (%s), no host specified", s)
+	}
+	return u, nil
+}
+
+// SetProxy sets the proxy that downloads and remote RPC go through unless
+// they select their own (see ParseProxy).  Without one, the environment's
+// proxy settings (HTTP_PROXY etc) apply as usual.
+func SetProxy(s string) error {
+	if _, err := ParseProxy(s); err != nil {
+		return err
+	}
+
+	proxyLock.Lock()
+	defer proxyLock.Unlock()
+	defaultProxy = s
+	return nil
+}
+
+// httpClient returns the client to use for a request through `proxy`, an
+// empty `proxy` selects the default set by SetProxy.  Requests which take
+// longer than `timeout` as a whole are cancelled (0 => no limit), and all
+// of them fail once the connection is idle for `idleTimeout`.
+func httpClient(proxy string, timeout time.Duration) (*http.Client, error) {
+	proxyLock.Lock()
+	defer proxyLock.Unlock()
+
+	if len(proxy) == 0 {
+		proxy = defaultProxy
+	}
+	if t, ok := proxyTransports[proxy]; ok {
+		return &http.Client{Transport: t, Timeout: timeout}, nil
+	}
+
+	u, err := ParseProxy(proxy)
+	if err != nil {
+		return nil, err
+	}
+	t := newTransport(idleTimeout)
+	if u != nil {
+		t.Proxy = proxyFunc(u)
+	} else if len(proxy) > 0 {
+		// Explicitly direct, do not pick up the environment's proxy either.
+		t.Proxy = nil
+	}
+	proxyTransports[proxy] = t
+	return &http.Client{Transport: t, Timeout: timeout}, nil
+}
+
+// rpcClient returns the client RPC requests through `proxy` go through.
+func rpcClient(proxy string) (*http.Client, error) {
+	return httpClient(proxy, rpcTimeout)
+}
+
+// downloadClient returns the client downloads go through.
+func downloadClient() *http.Client {
+	c, err := httpClient("", 0)
+	if err != nil {
+		// SetProxy validated the default proxy already.
+		return &http.Client{Transport: newTransport(idleTimeout)}
+	}
+	return c
+}
+
+// newTransport returns a transport (using the environment's proxy settings)
+// whose connections fail if they do not make progress for `idle`.
+func newTransport(idle time.Duration) *http.Transport {
+	d := &net.Dialer{Timeout: idle, KeepAlive: 30 * time.Second}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		c, err := d.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return &idleConn{Conn: c, idle: idle}, nil
+	}
+	t.ResponseHeaderTimeout = idle
+	return t
+}
+
+// idleConn is a connection whose reads fail if no data arrives for `idle`,
+// the deadline is pushed back on every read.
+type idleConn struct {
+	net.Conn
+	idle time.Duration
+}
+
+func (c *idleConn) Read(bs []byte) (int, error) {
+	c.Conn.SetReadDeadline(time.Now().Add(c.idle))
+	return c.Conn.Read(bs)
+}
+
+// proxyFunc routes requests through `u`, except for those to the local host
+// (ex: our own daemon's RPC) which can not be reached through a proxy.
+func proxyFunc(u *url.URL) func(*http.Request) (*url.URL, error) {
+	return func(req *http.Request) (*url.URL, error) {
+		host := req.URL.Hostname()
+		if host == "localhost" {
+			return nil, nil
+		}
+		if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+			return nil, nil
+		}
+		return u, nil
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,85 @@
+package coin
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// trickleServer serves `n` bytes, one every `every`, then stalls for `stall`.
+func trickleServer(t *testing.T, n int, every, stall time.Duration) *httptest.Server {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		for i := 0; i < n; i++ {
+			w.Write([]byte{'x'})
+			w.(http.Flusher).Flush()
+			select {
+			case <-time.After(every):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		select {
+		case <-time.After(stall):
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestRPCTimeout(t *testing.T) {
+	defer func(d time.Duration) { rpcTimeout = d }(rpcTimeout)
+	rpcTimeout = 200 * time.Millisecond
+
+	// Headers are sent right away, the result never is.
+	s := trickleServer(t, 1, 0, 10*time.Second)
+	start := time.Now()
+	_, err := (&RPCClient{URL: s.URL}).Do("getinfo", nil)
+	if err == nil {
+		t.Fatal("RPC to a hung daemon succeeded")
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("RPC took %s to time out", d.String())
+	}
+}
+
+func TestDownloadIdleTimeout(t *testing.T) {
+	client := &http.Client{Transport: newTransport(300 * time.Millisecond)}
+
+	// A transfer which keeps making progress is not cut off, however long.
+	s := trickleServer(t, 10, 100*time.Millisecond, 0)
+	resp, err := client.Get(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil || len(bs) != 10 {
+		t.Errorf("slow transfer: read %d bytes (%v), expected 10", len(bs), err)
+	}
+
+	// One which stalls is.
+	s = trickleServer(t, 2, 0, 10*time.Second)
+	resp, err = client.Get(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	_, err = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err == nil {
+		t.Error("stalled transfer completed")
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("stalled transfer took %s to fail", d.String())
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -156,6 +156,16 @@ func Command(cli *types.CLI, cmd string, opts []string) error {
 		return c.FnMap.ConfigureFn(c, opts)
 	case "getinfo":
 		return c.FnMap.GetInfoFn(c, opts)
+	case "versions":
+		return c.Versions(opts)
+	case "upgrade":
+		return c.Upgrade(opts)
+	case "config":
+		return c.Config(opts)
+	case "rotate-rpc-creds":
+		return c.RotateRPCCreds(opts)
+	case "masternode-conf":
+		return c.MasternodeConf(opts)
 	default:
 		return fmt.Errorf("invalid command specified (%s)", cmd)
 	}
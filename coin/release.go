@@ -0,0 +1,214 @@
+package coin
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+const (
+	LatestVersion = "latest"
+)
+
+var (
+	ErrNoReleaseSource = errors.New("coin does not support release discovery")
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// ReleaseSource discovers wallet releases using a GitHub-releases-style JSON
+// API (ex: https://api.github.com/repos/<owner>/<repo>/releases).  Asset names
+// are glob patterns (see path.Match) in which "{version}" is replaced by the
+// release's version.
+type ReleaseSource struct {
+	APIURL     string            // url listing the releases
+	Assets     map[string]string // "GOOS/GOARCH" -> wallet asset name pattern
+	SumsAsset  string            // name pattern of the signed checksum manifest (optional)
+	PathToBins string            // path from destination -> binary directory (pattern)
+}
+
+// Release is a single release as returned by the releases API.
+type Release struct {
+	TagName    string         `json:"tag_name"`
+	Name       string         `json:"name"`
+	Draft      bool           `json:"draft"`
+	Prerelease bool           `json:"prerelease"`
+	Assets     []ReleaseAsset `json:"assets"`
+}
+
+// ReleaseAsset is a file attached to a release.
+type ReleaseAsset struct {
+	Name   string `json:"name"`
+	URL    string `json:"browser_download_url"`
+	Size   int64  `json:"size"`
+	Digest string `json:"digest,omitempty"` // "sha256:<hex>" if known
+}
+
+// Version returns the release's version, its tag without a leading "v".
+func (r *Release) Version() string {
+	return strings.TrimPrefix(r.TagName, "v")
+}
+
+// Asset returns the first asset which matches `pattern` (after substituting
+// the release version), or nil if there are none.
+func (r *Release) Asset(pattern string) *ReleaseAsset {
+	pattern = strings.Replace(pattern, "{version}", r.Version(), -1)
+	for i, a := range r.Assets {
+		if ok, _ := path.Match(pattern, a.Name); ok {
+			return &r.Assets[i]
+		}
+	}
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Releases fetches the published releases, drafts are skipped.
+func (rs *ReleaseSource) Releases() ([]*Release, error) {
+	url := rs.APIURL
+	if !strings.Contains(url, "?") {
+		url += "?per_page=100"
+	}
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := downloadClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to list releases from %s: server returned %s", rs.APIURL, resp.Status)
+	}
+
+	all := []*Release{}
+	if err := json.NewDecoder(resp.Body).Decode(&all); err != nil {
+		return nil, fmt.Errorf("invalid release list from %s: %s", rs.APIURL, err.Error())
+	}
+	ret := []*Release{}
+	for _, r := range all {
+		if !r.Draft {
+			ret = append(ret, r)
+		}
+	}
+	return ret, nil
+}
+
+// Find returns the release for `version` ("X.Y.Z", "vX.Y.Z" or "latest").
+// The latest release is the highest versioned one that is not a pre-release.
+func (rs *ReleaseSource) Find(version string) (*Release, error) {
+	releases, err := rs.Releases()
+	if err != nil {
+		return nil, err
+	}
+
+	version = strings.TrimPrefix(strings.ToLower(version), "v")
+	var found *Release
+	for _, r := range releases {
+		switch {
+		case version == LatestVersion:
+			if !r.Prerelease && (found == nil || compareVersions(r.Version(), found.Version()) > 0) {
+				found = r
+			}
+		case r.Version() == version:
+			return r, nil
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("no release found for version %s", version)
+	}
+	return found, nil
+}
+
+// Resolve finds the release for `version` and returns a downloader for the
+// asset matching `platform` ("GOOS/GOARCH", empty => this machine).
+func (rs *ReleaseSource) Resolve(version, platform string) (*WalletDownloader, error) {
+	if len(platform) == 0 {
+		platform = HostPlatform()
+	}
+	pattern, ok := rs.Assets[platform]
+	if !ok {
+		return nil, fmt.Errorf("no wallet release available for %s", platform)
+	}
+
+	r, err := rs.Find(version)
+	if err != nil {
+		return nil, err
+	}
+	asset := r.Asset(pattern)
+	if asset == nil {
+		return nil, fmt.Errorf("release %s has no asset matching %s", r.TagName, pattern)
+	}
+
+	w := &WalletDownloader{
+		Version:     r.Version(),
+		DownloadURL: asset.URL,
+		PathToBins:  strings.Replace(rs.PathToBins, "{version}", r.Version(), -1),
+	}
+	if strings.HasPrefix(asset.Digest, "sha256:") || strings.HasPrefix(asset.Digest, "sha512:") {
+		w.Sha256sum = asset.Digest
+	}
+	if len(rs.SumsAsset) > 0 {
+		if sums := r.Asset(rs.SumsAsset); sums != nil {
+			w.SignedSumsURL = sums.URL
+		}
+	}
+	return w, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// compareVersions compares two dotted version strings numerically, returning
+// -1, 0 or 1.  Non-numeric suffixes (ex: "-rc1") sort before the release.
+func compareVersions(a, b string) int {
+	split := func(v string) ([]string, string) {
+		suffix := ""
+		if idx := strings.IndexAny(v, "-+"); idx >= 0 {
+			v, suffix = v[:idx], v[idx:]
+		}
+		return strings.Split(v, "."), suffix
+	}
+	as, asuf := split(a)
+	bs, bsuf := split(b)
+
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+
+	switch {
+	case asuf == bsuf:
+		return 0
+	case len(asuf) == 0:
+		return 1
+	case len(bsuf) == 0:
+		return -1
+	case asuf < bsuf:
+		return -1
+	}
+	return 1
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,174 @@
+package coin
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sabhiram/gomn/coin/cointest"
+	"github.com/sabhiram/gomn/types"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// newReleaseSource starts a release server publishing a few pivx releases, and
+// returns a release source for it.
+func newReleaseSource(t *testing.T) (*cointest.ReleaseServer, *ReleaseSource) {
+	wallet := func(version string) map[string][]byte {
+		return map[string][]byte{
+			"pivx-" + version + "-x86_64-linux-gnu.tar.gz": []byte("linux " + version),
+			"pivx-" + version + "-win64.zip":               []byte("windows " + version),
+			"SHA256SUMS.asc":                               []byte("sums " + version),
+		}
+	}
+	s := cointest.NewReleaseServer(
+		cointest.Release{Tag: "v1.2.0", Assets: wallet("1.2.0")},
+		cointest.Release{Tag: "v1.10.0", Assets: wallet("1.10.0")},
+		cointest.Release{Tag: "v1.9.0", Assets: wallet("1.9.0")},
+		cointest.Release{Tag: "v2.0.0-rc1", Prerelease: true, Assets: wallet("2.0.0-rc1")},
+		cointest.Release{Tag: "v3.0.0", Draft: true, Assets: wallet("3.0.0")},
+	)
+	t.Cleanup(s.Close)
+	return s, &ReleaseSource{
+		APIURL: s.APIURL(),
+		Assets: map[string]string{
+			"linux/amd64":   "pivx-{version}-x86_64-linux-gnu.tar.gz",
+			"windows/amd64": "pivx-{version}-win64.zip",
+			"darwin/arm64":  "pivx-{version}-osx-arm64.dmg",
+		},
+		SumsAsset:  "SHA256SUMS.asc",
+		PathToBins: "pivx-{version}/bin",
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func TestCompareVersions(t *testing.T) {
+	for _, tc := range []struct {
+		a, b string
+		cmp  int
+	}{
+		{"1.2.0", "1.2.0", 0},
+		{"1.10.0", "1.9.0", 1},
+		{"1.2", "1.2.1", -1},
+		{"2.0.0-rc1", "2.0.0", -1},
+		{"2.0.0-rc2", "2.0.0-rc1", 1},
+		{"2.0.0-rc1", "1.10.0", 1},
+	} {
+		if cmp := compareVersions(tc.a, tc.b); cmp != tc.cmp {
+			t.Errorf("compareVersions(%s, %s) = %d, expected %d", tc.a, tc.b, cmp, tc.cmp)
+		}
+		if cmp := compareVersions(tc.b, tc.a); cmp != -tc.cmp {
+			t.Errorf("compareVersions(%s, %s) = %d, expected %d", tc.b, tc.a, cmp, -tc.cmp)
+		}
+	}
+}
+
+func TestReleaseSourceFind(t *testing.T) {
+	_, rs := newReleaseSource(t)
+	for version, expected := range map[string]string{
+		"latest":    "1.10.0", // not the most recent, nor the pre-release
+		"1.2.0":     "1.2.0",
+		"v1.9.0":    "1.9.0",
+		"2.0.0-rc1": "2.0.0-rc1",
+		"3.0.0":     "", // drafts are never installed
+		"9.9.9":     "",
+	} {
+		r, err := rs.Find(version)
+		switch {
+		case len(expected) == 0 && err == nil:
+			t.Errorf("%s: found %s, expected an error", version, r.TagName)
+		case len(expected) > 0 && err != nil:
+			t.Errorf("%s: %s", version, err.Error())
+		case len(expected) > 0 && r.Version() != expected:
+			t.Errorf("%s: found %s, expected %s", version, r.Version(), expected)
+		}
+	}
+}
+
+func TestReleaseSourceResolve(t *testing.T) {
+	s, rs := newReleaseSource(t)
+
+	w, err := rs.Resolve("latest", "linux/amd64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := "pivx-1.10.0-x86_64-linux-gnu.tar.gz"
+	if w.Version != "1.10.0" || w.DownloadURL != s.AssetURL("v1.10.0", name) {
+		t.Errorf("resolved to %s at %s", w.Version, w.DownloadURL)
+	}
+	if expected := "sha256:" + sha256Hex([]byte("linux 1.10.0")); w.Sha256sum != expected {
+		t.Errorf("checksum = %q, expected the asset digest %q", w.Sha256sum, expected)
+	}
+	if w.SignedSumsURL != s.AssetURL("v1.10.0", "SHA256SUMS.asc") {
+		t.Errorf("sums url = %q, expected the release's SHA256SUMS.asc", w.SignedSumsURL)
+	}
+	if w.PathToBins != "pivx-1.10.0/bin" {
+		t.Errorf("path to bins = %q", w.PathToBins)
+	}
+
+	w, err = rs.Resolve("v1.2.0", "windows/amd64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.DownloadURL != s.AssetURL("v1.2.0", "pivx-1.2.0-win64.zip") {
+		t.Errorf("resolved 1.2.0 for windows to %s", w.DownloadURL)
+	}
+
+	// A platform the coin does not publish wallets for, and one missing from
+	// the release.
+	if _, err := rs.Resolve("latest", "freebsd/amd64"); err == nil || !strings.Contains(err.Error(), "no wallet release") {
+		t.Errorf("freebsd: err = %v, expected no wallet release", err)
+	}
+	if _, err := rs.Resolve("latest", "darwin/arm64"); err == nil || !strings.Contains(err.Error(), "no asset matching") {
+		t.Errorf("darwin: err = %v, expected no matching asset", err)
+	}
+
+	// Without digests, nothing is pinned.
+	s.NoDigests = true
+	if w, err := rs.Resolve("latest", "linux/amd64"); err != nil || len(w.Sha256sum) > 0 {
+		t.Errorf("without digests: checksum = %q (%v), expected none", w.Sha256sum, err)
+	}
+}
+
+func TestResolveSignedSums(t *testing.T) {
+	_, rs := newReleaseSource(t)
+	_, pub := newSigner(t, "PIVX Release Team")
+	sum := sha256Hex([]byte("linux 1.10.0"))
+
+	for _, tc := range []struct {
+		name     string
+		keyring  string // keyring bundled with the coin
+		override types.Download
+		sums     bool // manifest is used to verify the download
+		ok       bool
+	}{
+		{"bundled keyring", pub, types.Download{}, true, true},
+		{"--keyring", "", types.Download{Keyring: "/keys/pivx.asc"}, true, true},
+		{"no keyring", "", types.Download{}, false, false},
+		{"no keyring with --shasum", "", types.Download{ShaSum: sum}, false, true},
+	} {
+		w := &WalletDownloader{Keyring: tc.keyring, Releases: rs}
+		rw, err := w.resolve("latest", "linux/amd64", &tc.override)
+		switch {
+		case !tc.ok && err == nil:
+			t.Errorf("%s: resolved, expected an error", tc.name)
+		case !tc.ok && !strings.Contains(err.Error(), "--shasum"):
+			t.Errorf("%s: error does not say how to proceed: %s", tc.name, err.Error())
+		case !tc.ok:
+		case err != nil:
+			t.Errorf("%s: %s", tc.name, err.Error())
+		case tc.sums != (len(rw.SignedSumsURL) > 0):
+			t.Errorf("%s: sums url = %q", tc.name, rw.SignedSumsURL)
+		case rw.Keyring != tc.keyring || rw.Releases != rs:
+			t.Errorf("%s: keyring and release source not carried over", tc.name)
+		}
+	}
+
+	if _, err := (&WalletDownloader{}).resolve("latest", "linux/amd64", &types.Download{}); err != ErrNoReleaseSource {
+		t.Errorf("without a release source: err = %v, expected %v", err, ErrNoReleaseSource)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,161 @@
+package coin
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sabhiram/gomn/coin/cointest"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// freePort returns a TCP port nothing is listening on.
+func freePort(t *testing.T) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// newTestCoin returns a pivx-like coin whose wallet and data live in temporary
+// directories, with a conf file pointing at `rpcPort`.
+func newTestCoin(t *testing.T, user, password string, rpcPort int) *Coin {
+	wp, dp := t.TempDir(), t.TempDir()
+	if err := cointest.WriteConf(filepath.Join(dp, "pivx.conf"), user, password, rpcPort, nil); err != nil {
+		t.Fatal(err)
+	}
+	c := &Coin{
+		name:              "pivx",
+		port:              51472,
+		rpcPort:           51473,
+		daemonBin:         "pivxd",
+		statusBin:         "pivx-cli",
+		configFile:        "pivx.conf",
+		defaultWalletPath: wp,
+		defaultDataPath:   dp,
+		state:             &CoinState{},
+	}
+	if err := c.UpdateDynamic("", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// newTestDaemon starts a fake daemon, and a coin configured to talk to it.
+func newTestDaemon(t *testing.T) (*cointest.Daemon, *Coin) {
+	d, err := cointest.NewDaemon("127.0.0.1:0", "user", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { d.Close() })
+	return d, newTestCoin(t, d.User, d.Password, d.Port())
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func TestDoJSONRPCCommandGetinfo(t *testing.T) {
+	d, c := newTestDaemon(t)
+	d.Update(func(s *cointest.State) { s.Blocks = 1234 })
+
+	rsp, err := c.DoJSONRPCCommand("getinfo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rsp.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if blocks, _ := rsp.Result["blocks"].(float64); blocks != 1234 {
+		t.Errorf("blocks = %v, expected 1234", rsp.Result["blocks"])
+	}
+	if n := d.Calls("getinfo"); n != 1 {
+		t.Errorf("getinfo called %d times, expected 1", n)
+	}
+	if err := c.daemonReady(); err != nil {
+		t.Errorf("daemonReady: %s", err.Error())
+	}
+
+	var count int64
+	rsp, err = c.DoJSONRPCCommand("getblockcount", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rsp.Decode(&count); err != nil || count != 1234 {
+		t.Errorf("getblockcount = %d (%v), expected 1234", count, err)
+	}
+}
+
+func TestDoJSONRPCCommandAuthFailure(t *testing.T) {
+	d, err := cointest.NewDaemon("127.0.0.1:0", "user", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	c := newTestCoin(t, "user", "wrong", d.Port())
+
+	if _, err := c.DoJSONRPCCommand("getinfo", nil); err != ErrAuthorizationFailed {
+		t.Errorf("err = %v, expected %v", err, ErrAuthorizationFailed)
+	}
+	if n := d.Calls("getinfo"); n != 0 {
+		t.Errorf("getinfo dispatched %d times without auth", n)
+	}
+}
+
+func TestDoJSONRPCCommandWarmup(t *testing.T) {
+	d, c := newTestDaemon(t)
+	d.Update(func(s *cointest.State) { s.Warmup = true })
+
+	rsp, err := c.DoJSONRPCCommand("getinfo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rsp.Error.Code != cointest.ErrCodeInWarmup {
+		t.Errorf("error code = %d, expected %d", rsp.Error.Code, cointest.ErrCodeInWarmup)
+	}
+	if rsp.Error.Message != d.State().WarmupMessage {
+		t.Errorf("error message = %q, expected %q", rsp.Error.Message, d.State().WarmupMessage)
+	}
+	if c.daemonReady() == nil {
+		t.Error("daemonReady succeeded while warming up")
+	}
+
+	d.Update(func(s *cointest.State) { s.Warmup = false })
+	if err := c.daemonReady(); err != nil {
+		t.Errorf("daemonReady after warmup: %s", err.Error())
+	}
+}
+
+func TestDoJSONRPCCommandStop(t *testing.T) {
+	d, c := newTestDaemon(t)
+
+	rsp, err := c.DoJSONRPCCommand("stop", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rsp.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-d.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("daemon did not stop")
+	}
+	if _, err := c.DoJSONRPCCommand("getinfo", nil); err != ErrCouldNotConnectToServer {
+		t.Errorf("err = %v, expected %v", err, ErrCouldNotConnectToServer)
+	}
+}
+
+func TestDoJSONRPCCommandNoServer(t *testing.T) {
+	c := newTestCoin(t, "user", "secret", freePort(t))
+	if _, err := c.DoJSONRPCCommand("getinfo", nil); err != ErrCouldNotConnectToServer {
+		t.Errorf("err = %v, expected %v", err, ErrCouldNotConnectToServer)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,277 @@
+package coin
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// ConfType is the type of a conf file value.
+type ConfType string
+
+const (
+	ConfString   ConfType = "string"   // anything
+	ConfBool     ConfType = "bool"     // "0" or "1"
+	ConfInt      ConfType = "int"      // a (signed) integer
+	ConfPort     ConfType = "port"     // 1 - 65535
+	ConfHost     ConfType = "host"     // a host or IP, with an optional port
+	ConfHostPort ConfType = "hostport" // a host or IP, with a port
+)
+
+// ConfSeverity is how bad a problem with a conf file is.
+type ConfSeverity string
+
+const (
+	ConfError   ConfSeverity = "error"   // the daemon will not work as intended
+	ConfWarning ConfSeverity = "warning" // probably a mistake
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// ConfKey describes a single conf file key.
+type ConfKey struct {
+	Name     string
+	Type     ConfType
+	Allowed  []string // values the key may have (empty => any of its type)
+	Min, Max int64    // range of a ConfInt (both 0 => any)
+	Required bool     // the key must be set
+	Multi    bool     // the key may be set more than once (ex: "addnode")
+	Secret   bool     // the value is a credential, never printed
+	Help     string   // what the key is for
+}
+
+// ConfRule checks the settings of a conf file as a whole (ex: a key which
+// requires another), for the `network` the file selects.  It returns a
+// message for each problem it finds.
+type ConfRule func(d *ConfDoc, network string) []string
+
+// ConfSchema describes the conf file of a coin.
+type ConfSchema struct {
+	Keys  []*ConfKey
+	Rules []ConfRule
+
+	// Strict schemas warn about keys they do not know, which are often typos.
+	Strict bool
+}
+
+// ConfProblem is a problem found while validating a conf file.
+type ConfProblem struct {
+	Severity ConfSeverity
+	Key      string // the key at fault, empty for rules
+	Message  string
+}
+
+func (p *ConfProblem) String() string {
+	if len(p.Key) == 0 {
+		return fmt.Sprintf("%s: %s", p.Severity, p.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", p.Severity, p.Key, p.Message)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// schemas stores the conf schemas registered by coins.
+var (
+	schemasLock = sync.RWMutex{}
+	schemas     = map[string]*ConfSchema{}
+)
+
+// RegisterConfSchema registers the conf file schema for the coin `name`.
+func RegisterConfSchema(name string, s *ConfSchema) error {
+	schemasLock.Lock()
+	defer schemasLock.Unlock()
+
+	if _, ok := schemas[name]; ok {
+		return fmt.Errorf("conf schema for coin=%s already registered", name)
+	}
+	schemas[name] = s
+	return nil
+}
+
+// GetConfSchema returns the conf schema for the coin `name`, or nil if it did
+// not register one.
+func GetConfSchema(name string) *ConfSchema {
+	schemasLock.RLock()
+	defer schemasLock.RUnlock()
+
+	return schemas[name]
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Key returns the description of `name`, or nil if the schema does not know it.
+func (s *ConfSchema) Key(name string) *ConfKey {
+	for _, k := range s.Keys {
+		if k.Name == name {
+			return k
+		}
+	}
+	return nil
+}
+
+// Validate checks `d` against the schema, and returns the problems it finds
+// (errors first).  Values in network sections are checked like the others,
+// requirements and rules apply to the network the file selects.
+func (s *ConfSchema) Validate(d *ConfDoc) []*ConfProblem {
+	ret := []*ConfProblem{}
+	add := func(sev ConfSeverity, key, format string, args ...interface{}) {
+		ret = append(ret, &ConfProblem{Severity: sev, Key: key, Message: fmt.Sprintf(format, args...)})
+	}
+
+	network := d.Network()
+	for _, key := range d.Keys() {
+		_, name := splitKey(key)
+		k := s.Key(name)
+		if k == nil {
+			if s.Strict {
+				add(ConfWarning, key, "unknown key")
+			}
+			continue
+		}
+
+		values := d.Values(key)
+		if len(values) > 1 && !k.Multi {
+			add(ConfWarning, key, "set %d times, only the first value (%s) is used", len(values), values[0])
+		}
+		for _, v := range values {
+			if err := k.check(v); err != nil {
+				add(ConfError, key, "%s", err.Error())
+			}
+		}
+	}
+
+	for _, k := range s.Keys {
+		if k.Required && len(d.NetworkValues(network, k.Name)) == 0 {
+			add(ConfError, k.Name, "required, but not set")
+		}
+	}
+
+	for _, rule := range s.Rules {
+		for _, msg := range rule(d, network) {
+			add(ConfError, "", "%s", msg)
+		}
+	}
+
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Severity == ConfError && ret[j].Severity != ConfError
+	})
+	return ret
+}
+
+// check returns an error if `v` is not a valid value for the key.
+func (k *ConfKey) check(v string) error {
+	if len(k.Allowed) > 0 && !contains(k.Allowed, v) {
+		return fmt.Errorf("invalid value (%s), expected one of: %s", v, strings.Join(k.Allowed, ", "))
+	}
+
+	switch k.Type {
+	case ConfBool:
+		if v != "0" && v != "1" {
+			return fmt.Errorf("invalid value (%s), expected 0 or 1", v)
+		}
+	case ConfInt:
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid value (%s), expected an integer", v)
+		}
+		if (k.Min != 0 || k.Max != 0) && (n < k.Min || n > k.Max) {
+			return fmt.Errorf("invalid value (%s), expected %d - %d", v, k.Min, k.Max)
+		}
+	case ConfPort:
+		return checkPort(v)
+	case ConfHost:
+		host := v
+		if h, p, err := net.SplitHostPort(v); err == nil {
+			if err := checkPort(p); err != nil {
+				return err
+			}
+			host = h
+		}
+		if len(host) == 0 || strings.ContainsAny(host, " /") {
+			return fmt.Errorf("invalid host (%s)", v)
+		}
+	case ConfHostPort:
+		h, p, err := net.SplitHostPort(v)
+		if err != nil || len(h) == 0 {
+			return fmt.Errorf("invalid value (%s), expected HOST:PORT", v)
+		}
+		return checkPort(p)
+	}
+	return nil
+}
+
+func checkPort(v string) error {
+	if n, err := strconv.Atoi(v); err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("invalid port (%s)", v)
+	}
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Requires returns a rule for keys which need others: if `key` is `value`,
+// each of `keys` must be set.
+func Requires(key, value string, keys ...string) ConfRule {
+	return func(d *ConfDoc, network string) []string {
+		ret := []string{}
+		if v, _ := d.NetworkGet(network, key); v != value {
+			return ret
+		}
+		for _, k := range keys {
+			if len(d.NetworkValues(network, k)) == 0 {
+				ret = append(ret, fmt.Sprintf("%s=%s requires %s to be set", key, value, k))
+			}
+		}
+		return ret
+	}
+}
+
+// Exclusive returns a rule for bool keys which can not be set together.
+func Exclusive(keys ...string) ConfRule {
+	return func(d *ConfDoc, network string) []string {
+		set := []string{}
+		for _, k := range keys {
+			if v, _ := d.NetworkGet(network, k); v == "1" {
+				set = append(set, k)
+			}
+		}
+		if len(set) < 2 {
+			return []string{}
+		}
+		return []string{fmt.Sprintf("only one of %s can be set, not %s", strings.Join(keys, ", "), strings.Join(set, " and "))}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// secretKeys returns the keys whose values must not be printed: those the
+// coin's schema marks as secret, and the usual credentials.
+func (c *Coin) secretKeys() []string {
+	ret := append([]string{}, defaultSecretKeys...)
+	if s := GetConfSchema(c.name); s != nil {
+		for _, k := range s.Keys {
+			if k.Secret && !contains(ret, k.Name) {
+				ret = append(ret, k.Name)
+			}
+		}
+	}
+	return ret
+}
+
+// ValidateConf checks the coin's conf file against its schema (if it has one).
+func (c *Coin) ValidateConf() []*ConfProblem {
+	s := GetConfSchema(c.name)
+	if s == nil || c.state.conf == nil {
+		return []*ConfProblem{}
+	}
+	return s.Validate(c.state.conf)
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,117 @@
+package coin
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"strings"
+	"testing"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// testSchema is a small conf schema with a key of each type.
+var testSchema = &ConfSchema{
+	Keys: []*ConfKey{
+		{Name: "rpcuser", Type: ConfString, Required: true},
+		{Name: "rpcport", Type: ConfPort},
+		{Name: "testnet", Type: ConfBool},
+		{Name: "regtest", Type: ConfBool},
+		{Name: "maxconnections", Type: ConfInt, Min: 1, Max: 125},
+		{Name: "dbcache", Type: ConfInt},
+		{Name: "debug", Type: ConfString, Allowed: []string{"net", "rpc"}, Multi: true},
+		{Name: "bind", Type: ConfHost},
+		{Name: "externalip", Type: ConfHost},
+		{Name: "masternodeaddr", Type: ConfHostPort},
+		{Name: "masternode", Type: ConfBool},
+		{Name: "masternodeprivkey", Type: ConfString},
+	},
+	Rules: []ConfRule{
+		Exclusive("testnet", "regtest"),
+		Requires("masternode", "1", "masternodeprivkey", "masternodeaddr"),
+	},
+}
+
+// problems returns `ps` as strings, for easy comparison.
+func problems(ps []*ConfProblem) []string {
+	ret := []string{}
+	for _, p := range ps {
+		ret = append(ret, p.String())
+	}
+	return ret
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func TestValidateConf(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		conf     string
+		strict   bool
+		expected []string // problems, in order
+	}{
+		{"valid", "rpcuser=u\nrpcport=51473\ntestnet=0\nmaxconnections=125\ndbcache=-1\ndebug=net\ndebug=rpc\n" +
+			"bind=0.0.0.0\nexternalip=[::1]:51472\nmasternodeaddr=1.2.3.4:51472\n", false, nil},
+		{"required", "rpcport=51473\n", false, []string{"error: rpcuser: required, but not set"}},
+		{"required in the network section", "testnet=1\n[test]\nrpcuser=u\n", false, nil},
+		{"required, but only for another network", "testnet=1\n[main]\nrpcuser=u\n", false,
+			[]string{"error: rpcuser: required, but not set"}},
+		{"bool", "rpcuser=u\ntestnet=yes\n", false, []string{"error: testnet: invalid value (yes), expected 0 or 1"}},
+		{"int", "rpcuser=u\ndbcache=lots\n", false, []string{"error: dbcache: invalid value (lots), expected an integer"}},
+		{"int range", "rpcuser=u\nmaxconnections=0\n", false,
+			[]string{"error: maxconnections: invalid value (0), expected 1 - 125"}},
+		{"port", "rpcuser=u\nrpcport=65536\n", false, []string{"error: rpcport: invalid port (65536)"}},
+		{"port in a section", "rpcuser=u\n[test]\nrpcport=x\n", false, []string{"error: test.rpcport: invalid port (x)"}},
+		{"allowed", "rpcuser=u\ndebug=net\ndebug=all\n", false,
+			[]string{"error: debug: invalid value (all), expected one of: net, rpc"}},
+		{"host", "rpcuser=u\nbind=a b\nexternalip=1.2.3.4:0\n", false,
+			[]string{"error: bind: invalid host (a b)", "error: externalip: invalid port (0)"}},
+		{"hostport", "rpcuser=u\nmasternodeaddr=1.2.3.4\n", false,
+			[]string{"error: masternodeaddr: invalid value (1.2.3.4), expected HOST:PORT"}},
+		{"repeated", "rpcuser=u\nrpcport=1\nrpcport=2\n", false,
+			[]string{"warning: rpcport: set 2 times, only the first value (1) is used"}},
+		{"exclusive", "rpcuser=u\ntestnet=1\nregtest=1\n", false,
+			[]string{"error: only one of testnet, regtest can be set, not testnet and regtest"}},
+		{"exclusive, one unset", "rpcuser=u\ntestnet=1\nregtest=0\n", false, nil},
+		{"requires", "rpcuser=u\nmasternode=1\nmasternodeaddr=1.2.3.4:51472\n", false,
+			[]string{"error: masternode=1 requires masternodeprivkey to be set"}},
+		{"requires, not enabled", "rpcuser=u\nmasternode=0\n", false, nil},
+		{"requires, set for the network", "rpcuser=u\ntestnet=1\nmasternode=1\n[test]\nmasternodeprivkey=k\n" +
+			"masternodeaddr=1.2.3.4:51474\n", false, nil},
+		{"unknown, not strict", "rpcuser=u\nrpcpasword=p\n", false, nil},
+		{"unknown, strict", "rpcuser=u\nrpcpasword=p\n[test]\nfoo=1\n", true,
+			[]string{"warning: rpcpasword: unknown key", "warning: test.foo: unknown key"}},
+		{"errors first", "rpcport=1\nrpcport=2\nrpcpasword=p\ntestnet=2\n", true, []string{
+			"error: testnet: invalid value (2), expected 0 or 1",
+			"error: rpcuser: required, but not set",
+			"warning: rpcport: set 2 times, only the first value (1) is used",
+			"warning: rpcpasword: unknown key",
+		}},
+	} {
+		s := *testSchema
+		s.Strict = tc.strict
+		ps := problems(s.Validate(ParseConf([]byte(tc.conf))))
+		if strings.Join(ps, "\n") != strings.Join(tc.expected, "\n") {
+			t.Errorf("%s: problems:\n  %s\nexpected:\n  %s", tc.name, strings.Join(ps, "\n  "), strings.Join(tc.expected, "\n  "))
+		}
+	}
+}
+
+func TestRegisterConfSchema(t *testing.T) {
+	if err := RegisterConfSchema(t.Name(), testSchema); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterConfSchema(t.Name(), testSchema); err == nil {
+		t.Error("registered a second schema for the coin")
+	}
+	if GetConfSchema(t.Name()) != testSchema || GetConfSchema("nocoin") != nil {
+		t.Error("wrong schemas returned")
+	}
+	if k := testSchema.Key("rpcport"); k == nil || k.Type != ConfPort {
+		t.Errorf("rpcport = %+v", k)
+	}
+	if testSchema.Key("rpcpasword") != nil {
+		t.Error("found a key which is not in the schema")
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,202 @@
+package coin
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/clearsign"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+const (
+	maxManifestSize = 1 << 20 // checksum manifests are small, refuse anything larger
+)
+
+var (
+	ErrNoKeyring = errors.New("signed checksum manifest specified but no keyring to verify it with")
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// KeyringDir returns the directory where users can drop armored public keys
+// for a coin's release signers (as "<coin>.asc").
+func KeyringDir() string {
+	return filepath.Join(GomnDir(), "keyrings")
+}
+
+// ReadKeyring parses one or more armored OpenPGP public key blocks.
+func ReadKeyring(armored string) (openpgp.EntityList, error) {
+	var keyring openpgp.EntityList
+	rest := strings.TrimSpace(armored)
+	for len(rest) > 0 {
+		// ReadArmoredKeyRing only reads the first armored block, release keys
+		// are frequently distributed as several concatenated blocks.
+		end := strings.Index(rest, "-----END PGP PUBLIC KEY BLOCK-----")
+		if end < 0 {
+			return nil, errors.New("invalid keyring, missing end of public key block")
+		}
+		end += len("-----END PGP PUBLIC KEY BLOCK-----")
+
+		el, err := openpgp.ReadArmoredKeyRing(strings.NewReader(rest[:end]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid keyring: %s", err.Error())
+		}
+		keyring = append(keyring, el...)
+		rest = strings.TrimSpace(rest[end:])
+	}
+	if len(keyring) == 0 {
+		return nil, errors.New("keyring contains no public keys")
+	}
+	return keyring, nil
+}
+
+// ReadKeyringFile parses the armored public keys in the file at `fp`.
+func ReadKeyringFile(fp string) (openpgp.EntityList, error) {
+	bs, err := ioutil.ReadFile(fp)
+	if err != nil {
+		return nil, err
+	}
+	return ReadKeyring(string(bs))
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// SignedManifest is a release checksum manifest (ex: SHA256SUMS.asc) whose
+// signature has been verified against a keyring.
+type SignedManifest struct {
+	Signer string            // identity of the key that signed the manifest
+	sums   map[string]string // file name -> hex digest
+}
+
+// VerifyManifest checks the clearsigned manifest in `data` against `keyring`
+// and parses its "<hexdigest>  <filename>" lines.  If `data` is not
+// clearsigned, `signed` must hold the manifest that `data` is a detached
+// armored signature for.
+func VerifyManifest(data, signed []byte, keyring openpgp.EntityList) (*SignedManifest, error) {
+	var (
+		signer *openpgp.Entity
+		err    error
+	)
+	if block, _ := clearsign.Decode(data); block != nil {
+		signer, err = block.VerifySignature(keyring, nil)
+		// Only the signed portion of the manifest can be trusted.
+		signed = block.Plaintext
+	} else if signed != nil {
+		signer, err = openpgp.CheckArmoredDetachedSignature(keyring, bytes.NewReader(signed), bytes.NewReader(data), nil)
+	} else {
+		return nil, errors.New("checksum manifest is not signed")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("checksum manifest signature verification failed: %s", err.Error())
+	}
+
+	m := &SignedManifest{
+		Signer: signerName(signer),
+		sums:   map[string]string{},
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(signed))
+	for scanner.Scan() {
+		// sha256sum output is "<digest>  <name>", or "<digest> *<name>" for
+		// files hashed in binary mode.
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		sum, name := strings.ToLower(fields[0]), strings.TrimPrefix(fields[1], "*")
+		if _, err := ParseChecksum(sum); err != nil {
+			continue
+		}
+		m.sums[name] = sum
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Checksum returns the manifest's checksum for the file called `name`.
+func (m *SignedManifest) Checksum(name string) (*Checksum, error) {
+	sum, ok := m.sums[name]
+	if !ok {
+		// Some manifests list files relative to the release directory.
+		for k, v := range m.sums {
+			if path.Base(k) == name {
+				sum, ok = v, true
+				break
+			}
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("%s is not listed in the signed checksum manifest", name)
+	}
+	return ParseChecksum(sum)
+}
+
+func signerName(e *openpgp.Entity) string {
+	if e == nil || e.PrimaryKey == nil {
+		return "unknown"
+	}
+	for name := range e.Identities {
+		return fmt.Sprintf("%s (%s)", name, e.PrimaryKey.KeyIdString())
+	}
+	return e.PrimaryKey.KeyIdString()
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// fetchManifest downloads and verifies the checksum manifest at `url`.  A
+// manifest ending in ".asc" or ".sig" which is not clearsigned is treated as a
+// detached signature for the file of the same name without the extension.
+func fetchManifest(url string, keyring openpgp.EntityList) (*SignedManifest, error) {
+	data, err := fetchSmall(url)
+	if err != nil {
+		return nil, err
+	}
+
+	var signed []byte
+	if block, _ := clearsign.Decode(data); block == nil {
+		ext := path.Ext(baseName(url))
+		if ext != ".asc" && ext != ".sig" {
+			return nil, fmt.Errorf("checksum manifest (%s) is not signed", url)
+		}
+		if signed, err = fetchSmall(strings.TrimSuffix(url, ext)); err != nil {
+			return nil, err
+		}
+	}
+	return VerifyManifest(data, signed, keyring)
+}
+
+// fetchSmall fetches the (small) file at `url` into memory.
+func fetchSmall(url string) ([]byte, error) {
+	resp, err := downloadClient().Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to download %s: server returned %s", url, resp.Status)
+	}
+	bs, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxManifestSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(bs) > maxManifestSize {
+		return nil, fmt.Errorf("%s is too large to be a checksum manifest", url)
+	}
+	return bs, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,212 @@
+package coin
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/sabhiram/gomn/coin/cointest"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// serveFiles serves `files` (url path -> contents), anything else is a 404.
+func serveFiles(t *testing.T, files map[string][]byte) *httptest.Server {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bs, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(bs)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// newSigner returns a release signer and its armored public key.
+func newSigner(t *testing.T, name string) (*cointest.Signer, string) {
+	s, err := cointest.NewSigner(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := s.PublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, pub
+}
+
+func sha256Hex(bs []byte) string {
+	sum := sha256.Sum256(bs)
+	return hex.EncodeToString(sum[:])
+}
+
+// testManifest is a sha256sum style manifest for a release.
+var (
+	walletBody   = []byte("wallet")
+	testManifest = []byte(sha256Hex(walletBody) + "  pivx-1.0.0-x86_64-linux-gnu.tar.gz\n" +
+		sha256Hex([]byte("other")) + " *release/pivx-1.0.0-win64.zip\n" +
+		"not a checksum line\n")
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+func TestVerifyManifest(t *testing.T) {
+	signer, pub := newSigner(t, "PIVX Release Team")
+	_, otherPub := newSigner(t, "Mallory")
+	keyring, err := ReadKeyring(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKeyring, err := ReadKeyring(otherPub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	both, err := ReadKeyring(otherPub + "\n" + pub)
+	if err != nil || len(both) != 2 {
+		t.Fatalf("concatenated keyring: %d keys (%v), expected 2", len(both), err)
+	}
+
+	clear, err := signer.ClearSign(testManifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := signer.DetachSign(testManifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tamperedClear := bytes.Replace(clear, []byte(sha256Hex(walletBody)), []byte(sha256Hex([]byte("evil"))), 1)
+	tampered := bytes.Replace(testManifest, []byte(sha256Hex(walletBody)), []byte(sha256Hex([]byte("evil"))), 1)
+
+	for _, tc := range []struct {
+		name    string
+		data    []byte
+		signed  []byte
+		keyring openpgp.EntityList
+		ok      bool
+	}{
+		{"clearsigned", clear, nil, keyring, true},
+		{"clearsigned, any key in the keyring", clear, nil, both, true},
+		{"clearsigned, wrong key", clear, nil, otherKeyring, false},
+		{"clearsigned, tampered body", tamperedClear, nil, keyring, false},
+		{"detached", sig, testManifest, keyring, true},
+		{"detached, wrong key", sig, testManifest, otherKeyring, false},
+		{"detached, tampered body", sig, tampered, keyring, false},
+		{"not signed", testManifest, nil, keyring, false},
+	} {
+		m, err := VerifyManifest(tc.data, tc.signed, tc.keyring)
+		switch {
+		case tc.ok && err != nil:
+			t.Errorf("%s: %s", tc.name, err.Error())
+			continue
+		case !tc.ok && err == nil:
+			t.Errorf("%s: manifest verified", tc.name)
+			continue
+		case !tc.ok:
+			continue
+		}
+
+		if !strings.HasPrefix(m.Signer, "PIVX Release Team") {
+			t.Errorf("%s: signer = %q", tc.name, m.Signer)
+		}
+		cs, err := m.Checksum("pivx-1.0.0-x86_64-linux-gnu.tar.gz")
+		if err != nil || cs.Sum != sha256Hex(walletBody) {
+			t.Errorf("%s: checksum = %v (%v), expected %s", tc.name, cs, err, sha256Hex(walletBody))
+		}
+		if cs, err := m.Checksum("pivx-1.0.0-win64.zip"); err != nil || cs.Sum != sha256Hex([]byte("other")) {
+			t.Errorf("%s: relative checksum = %v (%v)", tc.name, cs, err)
+		}
+		if _, err := m.Checksum("pivx-1.0.0-osx64.tar.gz"); err == nil {
+			t.Errorf("%s: found a checksum for a file not in the manifest", tc.name)
+		}
+	}
+}
+
+func TestFetchManifest(t *testing.T) {
+	signer, pub := newSigner(t, "PIVX Release Team")
+	keyring, err := ReadKeyring(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clear, _ := signer.ClearSign(testManifest)
+	sig, _ := signer.DetachSign(testManifest)
+	s := serveFiles(t, map[string][]byte{
+		"/clear/SHA256SUMS.asc":    clear,
+		"/detached/SHA256SUMS":     testManifest,
+		"/detached/SHA256SUMS.sig": sig,
+		"/tampered/SHA256SUMS":     []byte(strings.ToUpper(string(testManifest))),
+		"/tampered/SHA256SUMS.asc": sig,
+		"/unsigned/SHA256SUMS":     testManifest,
+		"/missing/SHA256SUMS.asc":  sig,
+	})
+
+	for path, ok := range map[string]bool{
+		"/clear/SHA256SUMS.asc":    true,
+		"/detached/SHA256SUMS.sig": true,
+		"/tampered/SHA256SUMS.asc": false,
+		"/unsigned/SHA256SUMS":     false,
+		"/missing/SHA256SUMS.asc":  false,
+		"/nothing/SHA256SUMS.asc":  false,
+	} {
+		_, err := fetchManifest(s.URL+path, keyring)
+		if ok && err != nil {
+			t.Errorf("%s: %s", path, err.Error())
+		} else if !ok && err == nil {
+			t.Errorf("%s: manifest verified", path)
+		}
+	}
+}
+
+func TestSignedChecksum(t *testing.T) {
+	signer, pub := newSigner(t, "PIVX Release Team")
+	_, otherPub := newSigner(t, "Mallory")
+	clear, _ := signer.ClearSign(testManifest)
+	s := serveFiles(t, map[string][]byte{"/SHA256SUMS.asc": clear})
+	sumsURL := s.URL + "/SHA256SUMS.asc"
+	name := "pivx-1.0.0-x86_64-linux-gnu.tar.gz"
+
+	keyringFile := filepath.Join(t.TempDir(), "pivx.asc")
+	if err := ioutil.WriteFile(keyringFile, []byte(otherPub), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	w := &WalletDownloader{Keyring: pub}
+	for _, tc := range []struct {
+		name        string
+		expected    string
+		keyringFile string
+		ok          bool
+	}{
+		{"no pinned checksum", "", "", true},
+		{"pinned checksum agrees", sha256Hex(walletBody), "", true},
+		{"pinned checksum disagrees", sha256Hex([]byte("evil")), "", false},
+		{"pinned checksum of another algo", "sha512:" + strings.Repeat("ab", 64), "", true},
+		{"--keyring with the wrong key", "", keyringFile, false},
+	} {
+		sum, err := w.signedChecksum(sumsURL, name, tc.expected, tc.keyringFile)
+		switch {
+		case tc.ok && err != nil:
+			t.Errorf("%s: %s", tc.name, err.Error())
+		case !tc.ok && err == nil:
+			t.Errorf("%s: got checksum %s, expected an error", tc.name, sum)
+		case tc.ok && sum != "sha256:"+sha256Hex(walletBody):
+			t.Errorf("%s: checksum = %s, expected the manifest's", tc.name, sum)
+		}
+	}
+
+	if _, err := (&WalletDownloader{}).signedChecksum(sumsURL, name, "", ""); err != ErrNoKeyring {
+		t.Errorf("without a keyring: err = %v, expected %v", err, ErrNoKeyring)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
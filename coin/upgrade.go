@@ -0,0 +1,231 @@
+package coin
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"path/filepath"
+	"time"
+
+	"github.com/sabhiram/gomn/types"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+var (
+	// upgradePollInterval is how often the daemon is polled while waiting for
+	// it to stop or become healthy.
+	upgradePollInterval = 2 * time.Second
+
+	ErrDaemonStopTimeout = errors.New("timed out waiting for the daemon to stop")
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+func parseUpgradeArgs(args []string) (*types.Upgrade, error) {
+	uargs := &types.Upgrade{}
+	fs := flag.NewFlagSet("upgrade", flag.ContinueOnError)
+	fs.StringVar(&uargs.Version, "version", LatestVersion, "version to upgrade to ('latest' or X.Y.Z)")
+	fs.StringVar(&uargs.URL, "url", "", "upgrade to the wallet at this url instead")
+	fs.StringVar(&uargs.Type, "type", "", "override the wallet download type (compression)")
+	fs.StringVar(&uargs.ShaSum, "shasum", "", "override the wallet's checksum (sha256 or sha512)")
+	fs.StringVar(&uargs.SumsURL, "sums", "", "url of a signed checksum manifest to verify the wallet against")
+	fs.StringVar(&uargs.Keyring, "keyring", "", "file with armored public keys of the release signers")
+	fs.StringVar(&uargs.Mirrors, "mirrors", "", "comma separated mirrors (urls, file:// urls or directories) to fall back to")
+	fs.BoolVar(&uargs.Fastest, "fastest", false, "try the fastest mirror first, rather than in order")
+	fs.StringVar(&uargs.Arch, "arch", "", "install the wallet for this platform (GOARCH or GOOS/GOARCH) instead")
+	fs.StringVar(&uargs.Timeout, "timeout", "10m", "how long to wait for the upgraded node to become healthy")
+	fs.StringVar(&uargs.Settle, "settle", "1m", "how long the upgraded node must stay healthy")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	// An explicit url is a version of its own.
+	if len(uargs.URL) > 0 {
+		uargs.Version = ""
+	}
+	return uargs, nil
+}
+
+// Upgrade implements the "upgrade" command: install a new wallet version,
+// restart the daemon on it and wait for the node to become healthy.  If it
+// does not, the previous version is restored and restarted.
+func (c *Coin) Upgrade(args []string) error {
+	uargs, err := parseUpgradeArgs(args)
+	if err != nil {
+		return err
+	}
+	timeout, err := time.ParseDuration(uargs.Timeout)
+	if err != nil {
+		return err
+	}
+	settle, err := time.ParseDuration(uargs.Settle)
+	if err != nil {
+		return err
+	}
+
+	wv, err := LoadWalletVersions(c.state.walletPath)
+	if err != nil {
+		return err
+	}
+	prev := wv.Current
+	if len(prev) == 0 {
+		return ErrNoActiveVersion
+	}
+
+	// Download and verify the new version before touching the running node.
+	log.Printf("Upgrading %s wallet from %s\n", c.name, prev)
+	version, err := c.installWallet(wv, &uargs.Download, true)
+	if err != nil {
+		return err
+	}
+	if version == prev {
+		log.Printf("  %s wallet %s is already active, nothing to do\n", c.name, version)
+		return nil
+	}
+
+	// Remember how healthy the node was, the new version must get back there.
+	wasRunning := c.daemonReady() == nil
+	wasMasternode := wasRunning && c.masternodeStarted() == nil
+	log.Printf("  Daemon running: %t, masternode started: %t\n", wasRunning, wasMasternode)
+
+	if wasRunning {
+		if err := c.StopDaemon(timeout); err != nil {
+			return err
+		}
+	}
+
+	err = c.switchAndStart(wv, version, wasMasternode, timeout, settle)
+	if err == nil {
+		log.Printf("Upgraded %s wallet to %s\n", c.name, version)
+		return nil
+	}
+
+	// Roll back, the old version was good before so it should be again.
+	log.Printf("  Upgrade to %s failed (%s), rolling back to %s\n", version, err.Error(), prev)
+	if c.daemonReady() == nil {
+		if serr := c.StopDaemon(timeout); serr != nil {
+			return fmt.Errorf("upgrade to %s failed (%s), unable to roll back: %s", version, err.Error(), serr.Error())
+		}
+	}
+	if !wasRunning {
+		if rerr := c.useVersion(wv, prev); rerr != nil {
+			return fmt.Errorf("upgrade to %s failed (%s), unable to roll back: %s", version, err.Error(), rerr.Error())
+		}
+	} else if rerr := c.switchAndStart(wv, prev, wasMasternode, timeout, settle); rerr != nil {
+		return fmt.Errorf("upgrade to %s failed (%s), rollback to %s failed: %s", version, err.Error(), prev, rerr.Error())
+	}
+	return fmt.Errorf("upgrade to %s failed (%s), rolled back to %s", version, err.Error(), prev)
+}
+
+// switchAndStart makes `version` the active wallet, starts the daemon on it
+// and waits for it to become healthy (see waitHealthy).
+func (c *Coin) switchAndStart(wv *WalletVersions, version string, masternode bool, timeout, settle time.Duration) error {
+	if err := c.useVersion(wv, version); err != nil {
+		return err
+	}
+	log.Printf("  Starting %s (%s)\n", c.GetDaemonBinPath(), version)
+	if err := c.StartDaemon(); err != nil {
+		return err
+	}
+	return c.waitHealthy(masternode, timeout, settle)
+}
+
+// useVersion makes `version` active and re-resolves the bin paths.
+func (c *Coin) useVersion(wv *WalletVersions, version string) error {
+	if err := wv.Use(version); err != nil {
+		return err
+	}
+	return c.UpdateDynamic(c.state.walletPath, "", c.state.dataPath)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// StopDaemon asks the daemon to shut down via RPC and waits (up to `timeout`)
+// for it to stop responding and to remove its pidfile.
+func (c *Coin) StopDaemon(timeout time.Duration) error {
+	log.Printf("  Stopping %s daemon\n", c.name)
+	rsp, err := c.DoJSONRPCCommand("stop", nil)
+	if err != nil {
+		return err
+	}
+	if err := rsp.Err(); err != nil {
+		return err
+	}
+
+	pidFile := filepath.Join(c.state.dataPath, c.daemonBin+".pid")
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if _, err := c.DoJSONRPCCommand("getinfo", nil); err == ErrCouldNotConnectToServer && !FileExists(pidFile) {
+			return nil
+		}
+		time.Sleep(upgradePollInterval)
+	}
+	return ErrDaemonStopTimeout
+}
+
+// daemonReady returns nil if the daemon answers `getinfo` (and is done warming
+// up).
+func (c *Coin) daemonReady() error {
+	rsp, err := c.DoJSONRPCCommand("getinfo", nil)
+	if err != nil {
+		return err
+	}
+	return rsp.Err()
+}
+
+// masternodeStarted returns nil if `getmasternodestatus` reports that the
+// masternode has been successfully started.
+func (c *Coin) masternodeStarted() error {
+	const statusStarted = 4
+
+	rsp, err := c.DoJSONRPCCommand("getmasternodestatus", nil)
+	if err != nil {
+		return err
+	}
+	if err := rsp.Err(); err != nil {
+		return err
+	}
+	if status, ok := rsp.Result["status"].(float64); !ok || int(status) != statusStarted {
+		return fmt.Errorf("masternode not started (%v)", rsp.Result["message"])
+	}
+	return nil
+}
+
+// waitHealthy waits (up to `timeout`) for the daemon to answer RPCs and, if
+// `masternode` is set, for the masternode to be started again.  The node must
+// then stay healthy for `settle`, so that one which crashes shortly after it
+// starts is not mistaken for a healthy one.
+func (c *Coin) waitHealthy(masternode bool, timeout, settle time.Duration) error {
+	var (
+		err          error
+		healthySince time.Time
+	)
+	deadline := time.Now().Add(timeout + settle)
+	for time.Now().Before(deadline) {
+		time.Sleep(upgradePollInterval)
+
+		err = c.daemonReady()
+		if err == nil && masternode {
+			err = c.masternodeStarted()
+		}
+		switch {
+		case err != nil:
+			healthySince = time.Time{}
+		case healthySince.IsZero():
+			healthySince = time.Now()
+		}
+		if !healthySince.IsZero() && time.Since(healthySince) >= settle {
+			return nil
+		}
+	}
+	if err == nil {
+		err = errors.New("did not stay healthy")
+	}
+	return fmt.Errorf("node not healthy after %s: %s", timeout.String(), err.Error())
+}
+
+////////////////////////////////////////////////////////////////////////////////
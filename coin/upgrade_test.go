@@ -0,0 +1,91 @@
+package coin
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sabhiram/gomn/types"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+func TestParseUpgradeArgs(t *testing.T) {
+	uargs, err := parseUpgradeArgs(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uargs.Version != LatestVersion || uargs.Timeout != "10m" || uargs.Settle != "1m" {
+		t.Errorf("defaults = %+v", *uargs)
+	}
+
+	// An explicit url is a version of its own.
+	uargs, err = parseUpgradeArgs([]string{"--version", "1.2.0", "--url", "https://example.com/w.tar.gz"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(uargs.Version) > 0 || uargs.URL != "https://example.com/w.tar.gz" {
+		t.Errorf("with --url: %+v", *uargs)
+	}
+}
+
+func TestUpgrade(t *testing.T) {
+	bin := fakeDaemonBin(t)
+	defer func(d time.Duration) { upgradePollInterval = d }(upgradePollInterval)
+	upgradePollInterval = 100 * time.Millisecond
+
+	// 1.1.0 ships a daemon which never comes up.
+	_, c := newWalletCoin(t,
+		walletRelease(t, "1.0.0", bin),
+		walletRelease(t, "1.1.0", []byte("#!/bin/sh\nexit 1\n")),
+		walletRelease(t, "1.2.0", bin),
+	)
+	if err := c.Upgrade(nil); err != ErrNoActiveVersion {
+		t.Errorf("upgrade without a wallet: err = %v, expected %v", err, ErrNoActiveVersion)
+	}
+	if err := c.DownloadWallet(nil, &types.Download{Version: "1.0.0"}); err != nil {
+		t.Fatal(err)
+	}
+	if activeVersion(t, c) != "1.0.0" {
+		t.Fatal("1.0.0 is not active")
+	}
+	if err := c.StartDaemon(); err != nil {
+		t.Fatal(err)
+	}
+	stopOnCleanup(t, c)
+	if err := c.waitHealthy(true, 10*time.Second, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// The new version fails its health check, the previous one comes back.
+	err := c.Upgrade([]string{"--version", "1.1.0", "--timeout", "1s", "--settle", "0s"})
+	if err == nil || !strings.Contains(err.Error(), "rolled back to 1.0.0") {
+		t.Fatalf("upgrade to a broken version: err = %v, expected a rollback", err)
+	}
+	if v := activeVersion(t, c); v != "1.0.0" {
+		t.Errorf("active version = %q after the rollback, expected 1.0.0", v)
+	}
+	if err := c.daemonReady(); err != nil {
+		t.Errorf("daemon not running after the rollback: %s", err.Error())
+	}
+
+	// A good version sticks.
+	if err := c.Upgrade([]string{"--timeout", "10s", "--settle", "200ms"}); err != nil {
+		t.Fatal(err)
+	}
+	if v := activeVersion(t, c); v != "1.2.0" {
+		t.Errorf("active version = %q after the upgrade, expected 1.2.0", v)
+	}
+	if err := c.daemonReady(); err != nil {
+		t.Errorf("daemon not running after the upgrade: %s", err.Error())
+	}
+
+	// Upgrading to the active version is a no-op.
+	if err := c.Upgrade([]string{"--version", "1.2.0"}); err != nil {
+		t.Error(err)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
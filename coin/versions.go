@@ -0,0 +1,238 @@
+package coin
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+const (
+	versionsDir  = "versions"      // wallets are installed in <wallet>/versions/<version>
+	versionsFile = "versions.json" // state file in <wallet> tracking the installs
+)
+
+var (
+	ErrNoActiveVersion = errors.New("no wallet version is active (see 'gomn versions use')")
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// WalletVersion is a single installed version of a coin's wallet.
+type WalletVersion struct {
+	Version    string    `json:"version"`
+	BinSubPath string    `json:"bin_subpath"` // relative to the version's directory
+	Source     string    `json:"source,omitempty"`
+	Installed  time.Time `json:"installed"`
+}
+
+// WalletVersions tracks the wallet versions installed side by side under a
+// wallet path, and which one of them is active.
+type WalletVersions struct {
+	Current  string                    `json:"current"`
+	Versions map[string]*WalletVersion `json:"versions"`
+
+	walletPath string
+}
+
+// LoadWalletVersions reads the versions installed under `walletPath`.  A
+// wallet path without a state file has no versions installed.
+func LoadWalletVersions(walletPath string) (*WalletVersions, error) {
+	wv := &WalletVersions{
+		Versions:   map[string]*WalletVersion{},
+		walletPath: walletPath,
+	}
+	bs, err := ioutil.ReadFile(filepath.Join(walletPath, versionsFile))
+	if os.IsNotExist(err) {
+		return wv, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(bs, wv); err != nil {
+		return nil, fmt.Errorf("invalid wallet state file (%s): %s", versionsFile, err.Error())
+	}
+	if wv.Versions == nil {
+		wv.Versions = map[string]*WalletVersion{}
+	}
+	return wv, nil
+}
+
+// Save persists the state file, it is replaced atomically so that a crash
+// can never leave it half written.
+func (wv *WalletVersions) Save() error {
+	bs, err := json.MarshalIndent(wv, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(wv.walletPath, versionsFile+".")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(bs)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filepath.Join(wv.walletPath, versionsFile))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// Dir returns the directory `version` is (or will be) installed in.
+func (wv *WalletVersions) Dir(version string) string {
+	return filepath.Join(wv.walletPath, versionsDir, version)
+}
+
+// BinPath returns the binary directory of an installed `version`.
+func (wv *WalletVersions) BinPath(version string) (string, error) {
+	v, ok := wv.Versions[version]
+	if !ok {
+		return "", fmt.Errorf("wallet version %s is not installed", version)
+	}
+	return filepath.Join(wv.Dir(version), v.BinSubPath), nil
+}
+
+// Sorted returns the installed versions, oldest version first.
+func (wv *WalletVersions) Sorted() []*WalletVersion {
+	ret := []*WalletVersion{}
+	for _, v := range wv.Versions {
+		ret = append(ret, v)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return compareVersions(ret[i].Version, ret[j].Version) < 0
+	})
+	return ret
+}
+
+// Add records an installed version, it does not change the active version.
+func (wv *WalletVersions) Add(v *WalletVersion) error {
+	wv.Versions[v.Version] = v
+	return wv.Save()
+}
+
+// Use makes `version` the active version.
+func (wv *WalletVersions) Use(version string) error {
+	if _, ok := wv.Versions[version]; !ok {
+		return fmt.Errorf("wallet version %s is not installed", version)
+	}
+	wv.Current = version
+	return wv.Save()
+}
+
+// Remove deletes an installed version, the active version can not be removed.
+func (wv *WalletVersions) Remove(version string) error {
+	if _, ok := wv.Versions[version]; !ok {
+		return fmt.Errorf("wallet version %s is not installed", version)
+	}
+	if version == wv.Current {
+		return fmt.Errorf("wallet version %s is active, switch to another version first", version)
+	}
+	if err := os.RemoveAll(wv.Dir(version)); err != nil {
+		return err
+	}
+	delete(wv.Versions, version)
+	return wv.Save()
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// findBinDir returns the directory (relative to `root`) which contains the
+// file `bin`, preferring `hint` if the file is there.
+func findBinDir(root, bin, hint string) (string, error) {
+	if len(hint) > 0 && FileExists(filepath.Join(root, hint, bin)) {
+		return hint, nil
+	}
+
+	found := ""
+	err := filepath.Walk(root, func(fp string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if len(found) == 0 && !info.IsDir() && info.Name() == bin {
+			found = filepath.Dir(fp)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(found) == 0 {
+		return "", fmt.Errorf("unable to find %s in the installed wallet", bin)
+	}
+	return filepath.Rel(root, found)
+}
+
+// versionLabel returns a version name for a wallet downloaded from `url` when
+// no version is known, ex: "pivx-2.2.1-x86_64-linux-gnu".
+func versionLabel(url string) string {
+	name := baseName(url)
+	if idx := strings.Index(name, ".tar"); idx > 0 {
+		return name[:idx]
+	}
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Versions implements the "versions" command: list, use or remove the wallet
+// versions installed for the coin.
+func (c *Coin) Versions(args []string) error {
+	wv, err := LoadWalletVersions(c.state.walletPath)
+	if err != nil {
+		return err
+	}
+
+	sub := "list"
+	if len(args) > 0 {
+		sub = strings.ToLower(args[0])
+	}
+	switch {
+	case sub == "list":
+		if len(wv.Versions) == 0 {
+			fmt.Printf("No wallet versions installed in %s\n", c.state.walletPath)
+			return nil
+		}
+		fmt.Printf("Wallet versions installed in %s:\n", c.state.walletPath)
+		for _, v := range wv.Sorted() {
+			active := " "
+			if v.Version == wv.Current {
+				active = "*"
+			}
+			fmt.Printf("  %s %-20s installed %s  (%s)\n", active, v.Version,
+				v.Installed.Format("2006-01-02 15:04"), filepath.Join(wv.Dir(v.Version), v.BinSubPath))
+		}
+		return nil
+
+	case sub == "use" && len(args) == 2:
+		if err := wv.Use(args[1]); err != nil {
+			return err
+		}
+		fmt.Printf("Now using %s wallet version %s\n", c.name, args[1])
+		return nil
+
+	case sub == "remove" && len(args) == 2:
+		if err := wv.Remove(args[1]); err != nil {
+			return err
+		}
+		fmt.Printf("Removed %s wallet version %s\n", c.name, args[1])
+		return nil
+	}
+	return fmt.Errorf("invalid versions command, expected 'list', 'use VERSION' or 'remove VERSION'")
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,203 @@
+package coin
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/sabhiram/gomn/coin/cointest"
+	"github.com/sabhiram/gomn/types"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// walletRelease returns a release of the pivx wallet `version` for this
+// platform, its daemon is `pivxd` (nil => a stub script).
+func walletRelease(t *testing.T, version string, pivxd []byte) cointest.Release {
+	root := "pivx-" + version
+	entries := cointest.WalletEntries(root, "pivxd", "pivx-cli")
+	if pivxd != nil {
+		for i, e := range entries {
+			if e.Name == root+"/bin/pivxd" {
+				entries[i].Body = string(pivxd)
+			}
+		}
+	}
+	bs, err := cointest.TarGz(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cointest.Release{
+		Tag:    "v" + version,
+		Assets: map[string][]byte{root + "-" + runtime.GOOS + ".tar.gz": bs},
+	}
+}
+
+// newWalletCoin returns a test coin which installs its wallet from a release
+// server publishing `releases`.
+func newWalletCoin(t *testing.T, releases ...cointest.Release) (*cointest.ReleaseServer, *Coin) {
+	s := cointest.NewReleaseServer(releases...)
+	t.Cleanup(s.Close)
+
+	c := newTestCoin(t, "user", "secret", freePort(t))
+	c.walletDownloader = &WalletDownloader{
+		CompressionType: "tar.gz",
+		Releases: &ReleaseSource{
+			APIURL:     s.APIURL(),
+			Assets:     map[string]string{runtime.GOOS + "/" + runtime.GOARCH: "pivx-{version}-" + runtime.GOOS + ".tar.gz"},
+			PathToBins: "pivx-{version}/bin",
+		},
+	}
+	return s, c
+}
+
+// activeVersion returns the version the coin's binaries are used from.
+func activeVersion(t *testing.T, c *Coin) string {
+	t.Helper()
+	if err := c.UpdateDynamic(c.state.walletPath, "", ""); err != nil {
+		t.Fatal(err)
+	}
+	return c.state.walletVersion
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func TestInstallWalletVersions(t *testing.T) {
+	_, c := newWalletCoin(t, walletRelease(t, "1.0.0", nil), walletRelease(t, "1.1.0", nil))
+
+	// The first version installed becomes the active one.
+	if err := c.DownloadWallet(nil, &types.Download{Version: "1.0.0"}); err != nil {
+		t.Fatal(err)
+	}
+	if v := activeVersion(t, c); v != "1.0.0" {
+		t.Fatalf("active version = %q, expected 1.0.0", v)
+	}
+	expected := filepath.Join(c.state.walletPath, "versions", "1.0.0", "pivx-1.0.0", "bin", "pivxd")
+	if c.GetDaemonBinPath() != expected || !c.state.daemonBinExists {
+		t.Errorf("daemon = %s (exists %v), expected %s", c.GetDaemonBinPath(), c.state.daemonBinExists, expected)
+	}
+
+	// Others are installed alongside it.
+	if err := c.DownloadWallet(nil, &types.Download{Version: "latest"}); err != nil {
+		t.Fatal(err)
+	}
+	if v := activeVersion(t, c); v != "1.0.0" {
+		t.Errorf("active version = %q after installing another, expected 1.0.0", v)
+	}
+	if err := c.DownloadWallet(nil, &types.Download{Version: "1.0.0"}); err == nil {
+		t.Error("installed 1.0.0 twice")
+	}
+
+	wv, err := LoadWalletVersions(c.state.walletPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sorted := []string{}
+	for _, v := range wv.Sorted() {
+		sorted = append(sorted, v.Version+":"+v.BinSubPath)
+	}
+	if s := strings.Join(sorted, ","); s != "1.0.0:pivx-1.0.0/bin,1.1.0:pivx-1.1.0/bin" {
+		t.Errorf("installed versions = %s", s)
+	}
+}
+
+func TestVersionsCommand(t *testing.T) {
+	_, c := newWalletCoin(t, walletRelease(t, "1.0.0", nil), walletRelease(t, "1.1.0", nil))
+	for _, v := range []string{"1.0.0", "1.1.0"} {
+		if err := c.DownloadWallet(nil, &types.Download{Version: v}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := c.Versions([]string{"use", "1.1.0"}); err != nil {
+		t.Fatal(err)
+	}
+	if v := activeVersion(t, c); v != "1.1.0" {
+		t.Fatalf("active version = %q, expected 1.1.0", v)
+	}
+	if !strings.Contains(c.GetDaemonBinPath(), "pivx-1.1.0") {
+		t.Errorf("daemon %s is not from 1.1.0", c.GetDaemonBinPath())
+	}
+
+	// A --bins subpath overrides the active version.
+	if err := c.UpdateDynamic(c.state.walletPath, "custom/bin", ""); err != nil {
+		t.Fatal(err)
+	}
+	if c.GetBinPath() != filepath.Join(c.state.walletPath, "custom", "bin") || len(c.state.walletVersion) > 0 {
+		t.Errorf("bin path = %s (version %q) with --bins", c.GetBinPath(), c.state.walletVersion)
+	}
+
+	for _, args := range [][]string{
+		{"use", "2.0.0"},
+		{"remove", "1.1.0"}, // active
+		{"remove", "2.0.0"},
+		{"frobnicate"},
+	} {
+		if err := c.Versions(args); err == nil {
+			t.Errorf("versions %s succeeded", strings.Join(args, " "))
+		}
+	}
+
+	if err := c.Versions([]string{"remove", "1.0.0"}); err != nil {
+		t.Fatal(err)
+	}
+	wv, _ := LoadWalletVersions(c.state.walletPath)
+	if _, ok := wv.Versions["1.0.0"]; ok || DirExists(wv.Dir("1.0.0")) {
+		t.Error("1.0.0 still installed after removing it")
+	}
+	if err := c.Versions([]string{"list"}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestInstallWalletURL(t *testing.T) {
+	s, c := newWalletCoin(t, walletRelease(t, "1.0.0", nil))
+	url := s.AssetURL("v1.0.0", "pivx-1.0.0-"+runtime.GOOS+".tar.gz")
+
+	// Without a version, one is made up from the download, and the bins are
+	// found wherever the archive put them.
+	if err := c.DownloadWallet(nil, &types.Download{URL: url}); err != nil {
+		t.Fatal(err)
+	}
+	if v, expected := activeVersion(t, c), "pivx-1.0.0-"+runtime.GOOS; v != expected {
+		t.Errorf("version = %q, expected %q", v, expected)
+	}
+	if !c.state.daemonBinExists {
+		t.Errorf("daemon %s not found", c.GetDaemonBinPath())
+	}
+}
+
+func TestInstallWalletVerifyFails(t *testing.T) {
+	_, c := newWalletCoin(t, walletRelease(t, "1.0.0", nil))
+	if err := c.DownloadWallet(nil, &types.Download{Version: "1.0.0"}); err != nil {
+		t.Fatal(err)
+	}
+	wv, _ := LoadWalletVersions(c.state.walletPath)
+	dst := wv.Dir("1.0.0")
+	writeFiles(t, dst, map[string]string{"marker": "old install"})
+	pivxd, _ := ioutil.ReadFile(c.GetDaemonBinPath())
+
+	// A forced reinstall which fails verification leaves the existing
+	// install as it was, and nothing else behind.
+	err := c.DownloadWallet(nil, &types.Download{Version: "1.0.0", Force: true, ShaSum: sha256Hex([]byte("evil"))})
+	if err == nil {
+		t.Fatal("installed a wallet which does not match its checksum")
+	}
+	checkFiles(t, dst, map[string]string{"marker": "old install"})
+	if bs, _ := ioutil.ReadFile(c.GetDaemonBinPath()); string(bs) != string(pivxd) {
+		t.Error("daemon binary changed")
+	}
+	leftovers, _ := filepath.Glob(filepath.Join(filepath.Dir(dst), "*"))
+	if len(leftovers) != 1 {
+		t.Errorf("versions directory holds %v, expected only 1.0.0", leftovers)
+	}
+	if v := activeVersion(t, c); v != "1.0.0" {
+		t.Errorf("active version = %q, expected 1.0.0", v)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,15 @@
+module github.com/sabhiram/gomn
+
+go 1.22
+
+require (
+	github.com/ProtonMail/go-crypto v1.1.6
+	github.com/klauspost/compress v1.18.0
+	github.com/ulikunitz/xz v0.5.12
+)
+
+require (
+	github.com/cloudflare/circl v1.3.7 // indirect
+	golang.org/x/crypto v0.17.0 // indirect
+	golang.org/x/sys v0.16.0 // indirect
+)
@@ -0,0 +1,66 @@
+package monitor
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"sync"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// chainState tracks how the node is following the chain.  It is updated both
+// by the periodic `getinfo` poll and by zmq notifications (if enabled).
+type chainState struct {
+	lock sync.Mutex
+
+	height        int64     // best block height seen so far
+	hash          string    // best block hash (only known via zmq)
+	lastBlockTime time.Time // when the best block was first seen by us
+	lastTxTime    time.Time // when the last mempool tx was seen (zmq only)
+	txCount       int64     // number of txs seen via zmq
+}
+
+// updateBlock records `height` (and `hash` if known) as the node's best block.
+// Returns true if this is a new block.
+func (cs *chainState) updateBlock(height int64, hash string) bool {
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+
+	switch {
+	case height < cs.height:
+		return false
+	case height == cs.height && (len(hash) == 0 || hash == cs.hash):
+		return false
+	case height == cs.height && len(cs.hash) == 0:
+		cs.hash = hash // same block we polled, now with a hash
+		return false
+	}
+	cs.height = height
+	cs.hash = hash
+	cs.lastBlockTime = time.Now()
+	return true
+}
+
+// updateTx records that a new transaction was relayed by the node.
+func (cs *chainState) updateTx() {
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+
+	cs.txCount++
+	cs.lastTxTime = time.Now()
+}
+
+// sinceLastBlock returns the time elapsed since the last new block was seen,
+// and false if no block has been seen yet.
+func (cs *chainState) sinceLastBlock() (time.Duration, bool) {
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+
+	if cs.lastBlockTime.IsZero() {
+		return 0, false
+	}
+	return time.Since(cs.lastBlockTime), true
+}
+
+////////////////////////////////////////////////////////////////////////////////
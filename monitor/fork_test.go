@@ -0,0 +1,148 @@
+package monitor
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sabhiram/gomn/coin"
+	"github.com/sabhiram/gomn/coin/cointest"
+	_ "github.com/sabhiram/gomn/coin/pivx"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// newDaemon starts a fake daemon at `blocks` whose chain forks at `forkHeight`
+// (0 => never).
+func newDaemon(t *testing.T, blocks, forkHeight int64) *cointest.Daemon {
+	d, err := cointest.NewDaemon("127.0.0.1:0", "user", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { d.Close() })
+	d.Update(func(s *cointest.State) {
+		s.Blocks = blocks
+		s.ForkHeight = forkHeight
+	})
+	return d
+}
+
+// refURL returns the reference node URL (with credentials) for `d`.
+func refURL(d *cointest.Daemon) string {
+	return strings.Replace(d.URL, "http://", "http://"+d.User+":"+d.Password+"@", 1)
+}
+
+// newForkMonitor returns a pivx monitor talking to `ours`, which compares its
+// chain against `refs`.
+func newForkMonitor(t *testing.T, ours *cointest.Daemon, refs ...string) *Monitor {
+	dp := t.TempDir()
+	if err := cointest.WriteConf(filepath.Join(dp, "pivx.conf"), ours.User, ours.Password, ours.Port(), nil); err != nil {
+		t.Fatal(err)
+	}
+	c, err := coin.GetCoinByName("pivx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.UpdateDynamic(t.TempDir(), "", dp); err != nil {
+		t.Fatal(err)
+	}
+
+	nodes, err := parseRefNodes(strings.Join(refs, ","))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Monitor{
+		Coin:  c,
+		Opts:  &monitorOpts{forkLag: 6, forkConfs: 2},
+		chain: &chainState{},
+		refs:  nodes,
+		state: cStateMasternodeRunning,
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func TestParseRefNodes(t *testing.T) {
+	refs, err := parseRefNodes(" http://u:p@10.0.0.2:51473, ,https://10.0.0.3:51473")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(refs) != 2 {
+		t.Fatalf("parsed %d reference nodes, expected 2", len(refs))
+	}
+	if refs[0].name != "10.0.0.2:51473" || refs[0].rpc.User != "u" || refs[0].rpc.Password != "p" {
+		t.Errorf("first reference node = %s %+v", refs[0].name, *refs[0].rpc)
+	}
+	if strings.Contains(refs[0].rpc.URL, "u:p@") {
+		t.Errorf("credentials left in the URL %s", refs[0].rpc.URL)
+	}
+
+	if _, err := parseRefNodes("ftp://10.0.0.2"); err == nil {
+		t.Error("expected an error for an ftp reference node")
+	}
+}
+
+func TestCheckFork(t *testing.T) {
+	ours := newDaemon(t, 1000, 0)
+	down := newDaemon(t, 1000, 0)
+	down.Close()
+
+	for _, tc := range []struct {
+		name   string
+		ref    *cointest.Daemon
+		reason string // substring of the reason, "" => no fork
+	}{
+		{"same chain", newDaemon(t, 1000, 0), ""},
+		{"ref a few blocks ahead", newDaemon(t, 1004, 0), ""},
+		{"ref far ahead", newDaemon(t, 1010, 0), "lags reference node"},
+		{"ref behind", newDaemon(t, 990, 0), ""},
+		{"fork below the tip", newDaemon(t, 1000, 990), "block 998 is"},
+		{"fork within the confirmations", newDaemon(t, 1000, 999), ""},
+		{"ref down", down, ""},
+	} {
+		m := newForkMonitor(t, ours, refURL(tc.ref))
+		reason, err := m.checkFork()
+		switch {
+		case err != nil:
+			t.Errorf("%s: %s", tc.name, err.Error())
+		case len(tc.reason) == 0 && len(reason) > 0:
+			t.Errorf("%s: fork reported: %s", tc.name, reason)
+		case !strings.Contains(reason, tc.reason):
+			t.Errorf("%s: reason = %q, expected %q", tc.name, reason, tc.reason)
+		}
+	}
+}
+
+func TestUpdateForkState(t *testing.T) {
+	ours := newDaemon(t, 1000, 0)
+	ref := newDaemon(t, 1000, 0)
+	m := newForkMonitor(t, ours, refURL(ref))
+
+	m.updateForkState()
+	if m.state != cStateMasternodeRunning {
+		t.Fatalf("state = %s before the fork", stateNames[m.state])
+	}
+
+	// Both daemons keep mining, but the reference node's chain diverges.
+	ref.Update(func(s *cointest.State) { s.ForkHeight = 1001 })
+	for i := 0; i < 5; i++ {
+		ours.MineBlock()
+		ref.MineBlock()
+	}
+	m.updateForkState()
+	if m.state != cStateForked {
+		t.Fatalf("state = %s, expected %s", stateNames[m.state], stateNames[cStateForked])
+	}
+
+	// Once the reference node reorgs onto our chain, the previous state is
+	// restored.
+	ref.Update(func(s *cointest.State) { s.ForkHeight = 0 })
+	m.updateForkState()
+	if m.state != cStateMasternodeRunning {
+		t.Errorf("state = %s after the fork resolved", stateNames[m.state])
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,110 @@
+package monitor
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/sabhiram/gomn/zmq"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+const (
+	zmqDialTimeout = 5 * time.Second
+	zmqMaxBackoff  = time.Minute
+)
+
+// zmqEndpoints returns a map of endpoint -> topics for the zmq notifications
+// that the coin's conf file enables.
+func (m *Monitor) zmqEndpoints() map[string][]string {
+	eps := map[string][]string{}
+	for _, topic := range []string{"hashblock", "rawtx"} {
+		if ep := m.Coin.GetConfigValue("zmqpub" + topic); len(ep) > 0 {
+			eps[ep] = append(eps[ep], topic)
+		}
+	}
+	return eps
+}
+
+// startZMQ subscribes to every zmq endpoint configured for the coin.  Each
+// subscription runs in its own go routine and reconnects (with backoff) if
+// the daemon goes away.
+func (m *Monitor) startZMQ() {
+	for ep, topics := range m.zmqEndpoints() {
+		fmt.Printf("Subscribing to %v notifications on %s\n", topics, ep)
+		go m.subscribe(ep, topics)
+	}
+}
+
+func (m *Monitor) subscribe(ep string, topics []string) {
+	backoff := time.Second
+	for {
+		sub, err := zmq.Subscribe(ep, zmqDialTimeout, topics...)
+		if err != nil {
+			fmt.Printf("Warning: Unable to subscribe to %s : %s\n", ep, err.Error())
+			time.Sleep(backoff)
+			if backoff *= 2; backoff > zmqMaxBackoff {
+				backoff = zmqMaxBackoff
+			}
+			continue
+		}
+		backoff = time.Second
+
+		// Daemons do not send anything on a quiet chain, so a subscription
+		// which sees no block for the stale interval is re-dialed in case the
+		// connection silently died.  The `getinfo` poll still catches a node
+		// which is up but not following the chain.
+		sub.ReadTimeout = m.Opts.staleInterval
+		for {
+			msg, err := sub.Recv()
+			if zmq.IsTimeout(err) {
+				fmt.Printf("Warning: No zmq notification from %s in %s, reconnecting\n", ep, sub.ReadTimeout.String())
+				break
+			} else if err != nil {
+				fmt.Printf("Warning: Lost zmq subscription to %s : %s\n", ep, err.Error())
+				break
+			}
+			m.handleNotification(msg)
+		}
+		sub.Close()
+	}
+}
+
+// handleNotification updates the chain state from a single zmq message.
+func (m *Monitor) handleNotification(msg zmq.Message) {
+	switch msg.Topic() {
+	case "hashblock":
+		hash := hex.EncodeToString(msg.Body())
+		height, err := m.blockHeight(hash)
+		if err != nil {
+			fmt.Printf("Warning: Unable to lookup block %s : %s\n", hash, err.Error())
+			return
+		}
+		if m.chain.updateBlock(height, hash) {
+			fmt.Printf("New block %d (%s) at %s\n", height, hash, time.Now().String())
+		}
+	case "rawtx":
+		m.chain.updateTx()
+	}
+}
+
+// blockHeight asks the daemon for the height of the block with `hash`.
+func (m *Monitor) blockHeight(hash string) (int64, error) {
+	rsp, err := m.Coin.DoJSONRPCCommand("getblock", []interface{}{hash})
+	if err != nil {
+		return 0, err
+	}
+	if err := rsp.Err(); err != nil {
+		return 0, err
+	}
+	height, ok := rsp.Result["height"].(float64)
+	if !ok {
+		return 0, fmt.Errorf("no height for block %s", hash)
+	}
+	return int64(height), nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,102 @@
+package monitor
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sabhiram/gomn/coin"
+	"github.com/sabhiram/gomn/coin/cointest"
+	_ "github.com/sabhiram/gomn/coin/pivx"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// newZMQMonitor starts a fake daemon publishing "hashblock" notifications, and
+// a pivx monitor whose conf file points at it.
+func newZMQMonitor(t *testing.T, stale time.Duration) (*cointest.Daemon, *Monitor) {
+	d, err := cointest.NewDaemon("127.0.0.1:0", "user", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { d.Close() })
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	ep, err := d.ListenZMQ("hashblock", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dp := t.TempDir()
+	if err := cointest.WriteConf(filepath.Join(dp, "pivx.conf"), d.User, d.Password, d.Port(), map[string]string{
+		"zmqpubhashblock": ep,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	c, err := coin.GetCoinByName("pivx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.UpdateDynamic(t.TempDir(), "", dp); err != nil {
+		t.Fatal(err)
+	}
+
+	return d, &Monitor{
+		Coin:  c,
+		Opts:  &monitorOpts{zmq: true, staleInterval: stale},
+		chain: &chainState{},
+		state: cStateInit,
+	}
+}
+
+// waitBlock mines blocks until the monitor has seen (via zmq) the daemon's
+// best block.  The subscription is set up asynchronously, so the first blocks
+// may be published before anyone is listening.
+func waitBlock(t *testing.T, d *cointest.Daemon, m *Monitor) {
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		d.MineBlock()
+		time.Sleep(50 * time.Millisecond)
+
+		height := d.State().Blocks
+		m.chain.lock.Lock()
+		seen, hash := m.chain.height, m.chain.hash
+		m.chain.lock.Unlock()
+		if seen == height && hash == cointest.BlockHash(height) {
+			return
+		}
+	}
+	t.Fatal("monitor did not see the mined block via zmq")
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func TestMonitorZMQ(t *testing.T) {
+	// A short stale interval makes the subscription time out and re-dial
+	// between blocks, it must keep delivering them.  NOTE: the subscription
+	// go routines live as long as the process, so this is the only test
+	// starting them on the (shared) pivx coin.
+	d, m := newZMQMonitor(t, 100*time.Millisecond)
+	if eps := m.zmqEndpoints(); len(eps) != 1 {
+		t.Fatalf("zmq endpoints = %v, expected one", eps)
+	}
+	m.startZMQ()
+
+	waitBlock(t, d, m)
+	if _, ok := m.chain.sinceLastBlock(); !ok {
+		t.Error("no last block time after a zmq notification")
+	}
+
+	time.Sleep(300 * time.Millisecond)
+	waitBlock(t, d, m)
+}
+
+////////////////////////////////////////////////////////////////////////////////
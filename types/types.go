@@ -7,32 +7,76 @@ package types
 // receive directly. Sub-command specific arguments are encapsulated in the
 // structures below.
 type CLI struct {
-	Coin     string   // Name of the coin we are operating on
-	Wallet   string   // base path to where wallet binaries will be extracted  (empty => coin default)
-	BinPath  string   // sub-Path to coin's binary directory (empty => coin default)
-	DataPath string   // Path to coin's data directory (empty => coin default)
-	Args     []string // Rest of the command line, args[0] is the command
+	Coin       string   // Name of the coin we are operating on
+	Wallet     string   // base path to where wallet binaries will be extracted  (empty => coin default)
+	BinPath    string   // sub-Path to coin's binary directory (empty => coin default)
+	DataPath   string   // Path to coin's data directory (empty => coin default)
+	Proxy      string   // proxy for downloads and remote RPC (empty => environment)
+	Progress   string   // how progress is reported (empty => auto)
+	ProgressFD int      // file descriptor for json progress events (0 => stderr)
+	Args       []string // Rest of the command line, args[0] is the command
 }
 
 ////////////////////////////////////////////////////////////////////////////////
 
 // Download represents the arguments passed to the "download" command.
 type Download struct {
-	URL    string
-	Type   string
-	ShaSum string
+	URL     string
+	Type    string
+	ShaSum  string
+	SumsURL string // signed checksum manifest (ex: SHA256SUMS.asc)
+	Keyring string // file with armored public keys to verify SumsURL against
+	Version string // release to discover and install ("latest" or "X.Y.Z")
+	Force   bool   // reinstall, moving an existing install aside
+	Mirrors string // comma separated mirrors to fall back to
+	Fastest bool   // try the fastest mirror first
+	Arch    string // platform to install the wallet for (empty => this machine)
+}
+
+// Upgrade represents the arguments passed to the "upgrade" command.
+type Upgrade struct {
+	Download        // version to upgrade to (and how to fetch it)
+	Timeout  string // how long to wait for the upgraded node to become healthy
+	Settle   string // how long the upgraded node must then stay healthy
+}
+
+// RotateCreds represents the arguments passed to the "rotate-rpc-creds"
+// command.
+type RotateCreds struct {
+	Timeout string // how long to wait for the daemon to stop, and to restart
+}
+
+// MasternodeConf represents the arguments passed to the "masternode-conf"
+// command.
+type MasternodeConf struct {
+	Alias   string // name of the masternode in the controller wallet
+	Addr    string // IP:port of the masternode (empty => from the conf file)
+	PrivKey string // masternode private key (empty => from the conf file)
+	TxID    string // collateral transaction id
+	Index   int    // collateral output index (< 0 => unknown)
+	RPC     string // url of the controller wallet's RPC, to find the collateral
+	Out     string // masternode.conf to append to (empty => print the line)
+	Replace bool   // replace an existing entry with the same alias
 }
 
 // Bootstrap represents the arguments passed to the "download" command.
 type Bootstrap struct {
-	URL  string
-	Type string
+	URL     string
+	Type    string
+	ShaSum  string
+	Force   bool   // re-bootstrap, moving existing chain data aside
+	Mode    string // override the bootstrap type ("bootstrap.dat" or "snapshot")
+	Watch   bool   // start the daemon and watch it import a bootstrap.dat
+	Mirrors string // comma separated mirrors to fall back to
+	Fastest bool   // try the fastest mirror first
 }
 
 // Configure represents the arguments passed to the "download" command.
 type Configure struct {
-	IP   string
-	MnPK string
+	IP     string
+	MnPK   string
+	DryRun bool // print the changes as a diff, without writing them
+	Merge  bool // only update the masternode keys of an existing conf
 }
 
 ////////////////////////////////////////////////////////////////////////////////
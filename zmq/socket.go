@@ -0,0 +1,211 @@
+package zmq
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Subscriber is a SUB socket connected to a single PUB endpoint.
+type Subscriber struct {
+	Endpoint string // endpoint we are connected to, ex: "tcp://127.0.0.1:28332"
+
+	// ReadTimeout bounds how long `Recv` waits for a message (0 => forever).
+	// PUB sockets do not send heartbeats, so without it a connection which
+	// silently died (ex: the host went away) blocks `Recv` indefinitely.
+	ReadTimeout time.Duration
+
+	zc *conn
+}
+
+// Subscribe connects to the PUB socket at `endpoint` and subscribes to each
+// of the `topics` (ex: "hashblock", "rawtx").  An empty topic list subscribes
+// to everything.
+func Subscribe(endpoint string, timeout time.Duration, topics ...string) (*Subscriber, error) {
+	addr, err := ParseEndpoint(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	zc := newConn(c)
+	peerType, err := zc.handshake("SUB")
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	if peerType != "PUB" && peerType != "XPUB" {
+		c.Close()
+		return nil, fmt.Errorf("zmq: incompatible peer socket type (%s)", peerType)
+	}
+
+	if len(topics) == 0 {
+		topics = []string{""}
+	}
+	for _, topic := range topics {
+		// ZMTP 3.0 subscriptions are messages prefixed with 0x01.
+		if err := zc.writeFrame(0, append([]byte{0x01}, topic...)); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+
+	return &Subscriber{
+		Endpoint: endpoint,
+		zc:       zc,
+	}, nil
+}
+
+// Recv blocks until the next message is published, the connection fails or
+// `ReadTimeout` elapses.  A timeout may leave a partial message unread, so the
+// subscriber must be closed (and re-dialed) after any error.
+func (s *Subscriber) Recv() (Message, error) {
+	if s.ReadTimeout > 0 {
+		s.zc.c.SetReadDeadline(time.Now().Add(s.ReadTimeout))
+	}
+	return s.zc.readMessage()
+}
+
+// IsTimeout returns true if `err` (from `Recv`) is due to the `ReadTimeout`.
+func IsTimeout(err error) bool {
+	ne, ok := err.(net.Error)
+	return ok && ne.Timeout()
+}
+
+// Close closes the underlying connection, unblocking any pending `Recv`.
+func (s *Subscriber) Close() error {
+	return s.zc.c.Close()
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Publisher is a PUB socket which fans messages out to any connected
+// subscribers.  gomn only uses this to fake a daemon's notifications.
+type Publisher struct {
+	Endpoint string // endpoint subscribers can connect to
+
+	lock     sync.Mutex
+	listener net.Listener
+	subs     map[*conn][][]byte
+}
+
+// Publish starts a PUB socket listening on `addr` (ex: "127.0.0.1:0").
+func Publish(addr string) (*Publisher, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Publisher{
+		Endpoint: "tcp://" + l.Addr().String(),
+		listener: l,
+		subs:     map[*conn][][]byte{},
+	}
+	go p.accept()
+	return p, nil
+}
+
+func (p *Publisher) accept() {
+	for {
+		c, err := p.listener.Accept()
+		if err != nil {
+			return
+		}
+		go p.serve(newConn(c))
+	}
+}
+
+// serve completes the handshake with a subscriber and then tracks the topics
+// it subscribes to until it disconnects.
+func (p *Publisher) serve(zc *conn) {
+	defer zc.c.Close()
+
+	if _, err := zc.handshake("PUB"); err != nil {
+		return
+	}
+
+	p.lock.Lock()
+	p.subs[zc] = nil
+	p.lock.Unlock()
+
+	defer func() {
+		p.lock.Lock()
+		delete(p.subs, zc)
+		p.lock.Unlock()
+	}()
+
+	for {
+		flags, body, err := zc.readFrame()
+		if err != nil {
+			return
+		}
+
+		var topic []byte
+		switch {
+		case flags&flagCommand != 0:
+			name, data, err := parseCommand(body)
+			if err != nil || name != "SUBSCRIBE" {
+				continue
+			}
+			topic = data
+		case len(body) > 0 && body[0] == 0x01:
+			topic = body[1:]
+		default:
+			continue
+		}
+
+		p.lock.Lock()
+		p.subs[zc] = append(p.subs[zc], topic)
+		p.lock.Unlock()
+	}
+}
+
+// Subscribers returns the number of connected subscribers.
+func (p *Publisher) Subscribers() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return len(p.subs)
+}
+
+// Send publishes `msg` to every subscriber whose subscriptions match the
+// message's topic.
+func (p *Publisher) Send(msg Message) {
+	if len(msg) == 0 {
+		return
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for zc, topics := range p.subs {
+		for _, t := range topics {
+			if bytes.HasPrefix(msg[0], t) {
+				zc.writeMessage(msg)
+				break
+			}
+		}
+	}
+}
+
+// Close stops accepting subscribers and disconnects the current ones.
+func (p *Publisher) Close() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	err := p.listener.Close()
+	for zc := range p.subs {
+		zc.c.Close()
+	}
+	return err
+}
+
+////////////////////////////////////////////////////////////////////////////////
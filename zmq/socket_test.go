@@ -0,0 +1,124 @@
+package zmq
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// waitSubscribed waits until the publisher has seen `n` subscriptions, which
+// it handles asynchronously.
+func waitSubscribed(t *testing.T, p *Publisher, n int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		p.lock.Lock()
+		count := 0
+		for _, topics := range p.subs {
+			count += len(topics)
+		}
+		p.lock.Unlock()
+		if count >= n {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("publisher did not see %d subscriptions", n)
+}
+
+func newPublisher(t *testing.T) *Publisher {
+	p, err := Publish("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { p.Close() })
+	return p
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func TestPublishSubscribe(t *testing.T) {
+	p := newPublisher(t)
+
+	sub, err := Subscribe(p.Endpoint, time.Second, "hashblock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+	all, err := Subscribe(p.Endpoint, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer all.Close()
+	waitSubscribed(t, p, 2)
+	if n := p.Subscribers(); n != 2 {
+		t.Errorf("%d subscribers, expected 2", n)
+	}
+
+	// Topics are prefix matched: "hashblock" does not get "rawtx".
+	p.Send(Message{[]byte("rawtx"), []byte{0x01}})
+	p.Send(Message{[]byte("hashblock"), []byte{0x02}})
+
+	sub.ReadTimeout = 5 * time.Second
+	if msg, err := sub.Recv(); err != nil || msg.Topic() != "hashblock" {
+		t.Errorf("subscriber got %q (%v), expected hashblock", msg.Topic(), err)
+	}
+	all.ReadTimeout = 5 * time.Second
+	for _, topic := range []string{"rawtx", "hashblock"} {
+		if msg, err := all.Recv(); err != nil || msg.Topic() != topic {
+			t.Errorf("subscriber to all got %q (%v), expected %s", msg.Topic(), err, topic)
+		}
+	}
+
+	// Closing the publisher ends the subscriptions.
+	p.Close()
+	all.ReadTimeout = 0
+	if _, err := all.Recv(); err == nil || IsTimeout(err) {
+		t.Errorf("Recv after publisher closed: err = %v", err)
+	}
+}
+
+func TestSubscribeReadTimeout(t *testing.T) {
+	p := newPublisher(t)
+
+	sub, err := Subscribe(p.Endpoint, time.Second, "hashblock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+
+	sub.ReadTimeout = 50 * time.Millisecond
+	start := time.Now()
+	if _, err := sub.Recv(); !IsTimeout(err) {
+		t.Fatalf("err = %v, expected a timeout", err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("Recv took %s to time out", d.String())
+	}
+}
+
+func TestSubscribeIncompatiblePeer(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		newConn(c).handshake("SUB")
+	}()
+
+	if sub, err := Subscribe("tcp://"+l.Addr().String(), time.Second); err == nil {
+		sub.Close()
+		t.Error("subscribed to a SUB socket")
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
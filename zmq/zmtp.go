@@ -0,0 +1,279 @@
+// Package zmq is a minimal, pure-Go implementation of the ZeroMQ message
+// transport protocol (ZMTP 3.0) over TCP.  It only implements what gomn needs
+// to consume (and, for testing, produce) the notifications published by coin
+// daemons via `zmqpubhashblock`, `zmqpubrawtx` etc: PUB / SUB sockets using
+// the NULL security mechanism.
+package zmq
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+const (
+	flagMore    = 0x01 // more frames follow in this message
+	flagLong    = 0x02 // frame size is 8 bytes instead of 1
+	flagCommand = 0x04 // frame is a command, not a message
+
+	greetingLen      = 64
+	handshakeTimeout = 10 * time.Second
+	maxFrameSize     = 64 << 20
+)
+
+var (
+	ErrBadGreeting  = errors.New("zmq: invalid greeting from peer")
+	ErrBadMechanism = errors.New("zmq: peer does not use the NULL mechanism")
+	ErrBadCommand   = errors.New("zmq: unexpected command from peer")
+	ErrFrameTooBig  = errors.New("zmq: frame exceeds maximum size")
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Message is a multi-part ZMQ message, for coin notifications this is
+// typically [topic, body, sequence].
+type Message [][]byte
+
+// Topic returns the first frame of the message as a string.
+func (m Message) Topic() string {
+	if len(m) == 0 {
+		return ""
+	}
+	return string(m[0])
+}
+
+// Body returns the second frame of the message (or nil).
+func (m Message) Body() []byte {
+	if len(m) < 2 {
+		return nil
+	}
+	return m[1]
+}
+
+// Sequence returns the little-endian sequence number which bitcoin derived
+// daemons append to each notification, and false if there is none.
+func (m Message) Sequence() (uint32, bool) {
+	if len(m) < 3 || len(m[2]) != 4 {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint32(m[2]), true
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// ParseEndpoint converts a ZMQ endpoint (ex: "tcp://127.0.0.1:28332") into a
+// dialable TCP address.  Wildcard hosts ("*", "0.0.0.0") which are valid for
+// the daemon to bind to are mapped to the loopback address.
+func ParseEndpoint(ep string) (string, error) {
+	if !strings.HasPrefix(ep, "tcp://") {
+		return "", fmt.Errorf("zmq: unsupported endpoint (%s), only tcp:// is supported", ep)
+	}
+	host, port, err := net.SplitHostPort(strings.TrimPrefix(ep, "tcp://"))
+	if err != nil {
+		return "", err
+	}
+	switch host {
+	case "", "*", "0.0.0.0":
+		host = "127.0.0.1"
+	case "::":
+		host = "::1"
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// conn wraps a net.Conn and speaks ZMTP framing over it.
+type conn struct {
+	c net.Conn
+	r *bufio.Reader
+}
+
+func newConn(c net.Conn) *conn {
+	return &conn{c: c, r: bufio.NewReader(c)}
+}
+
+// handshake exchanges greetings and READY commands with the peer.  It returns
+// the peer's advertised socket type.
+func (zc *conn) handshake(socketType string) (string, error) {
+	zc.c.SetDeadline(time.Now().Add(handshakeTimeout))
+	defer zc.c.SetDeadline(time.Time{})
+
+	greeting := make([]byte, greetingLen)
+	greeting[0] = 0xFF
+	greeting[9] = 0x7F
+	greeting[10] = 3 // major version
+	greeting[11] = 0 // minor version
+	copy(greeting[12:32], "NULL")
+	if _, err := zc.c.Write(greeting); err != nil {
+		return "", err
+	}
+
+	peer := make([]byte, greetingLen)
+	if _, err := io.ReadFull(zc.r, peer); err != nil {
+		return "", err
+	}
+	if peer[0] != 0xFF || peer[9]&0x01 != 0x01 || peer[10] < 3 {
+		return "", ErrBadGreeting
+	}
+	if string(bytes.TrimRight(peer[12:32], "\x00")) != "NULL" {
+		return "", ErrBadMechanism
+	}
+
+	if err := zc.writeFrame(flagCommand, readyCommand(socketType)); err != nil {
+		return "", err
+	}
+
+	flags, body, err := zc.readFrame()
+	if err != nil {
+		return "", err
+	}
+	if flags&flagCommand == 0 {
+		return "", ErrBadCommand
+	}
+	name, props, err := parseCommand(body)
+	if err != nil {
+		return "", err
+	}
+	if name != "READY" {
+		if name == "ERROR" {
+			return "", fmt.Errorf("zmq: peer error: %s", string(props))
+		}
+		return "", ErrBadCommand
+	}
+	return readyProperty(props, "Socket-Type"), nil
+}
+
+// readyCommand builds the body of a READY command for `socketType`.
+func readyCommand(socketType string) []byte {
+	var b bytes.Buffer
+	b.WriteByte(byte(len("READY")))
+	b.WriteString("READY")
+	b.WriteByte(byte(len("Socket-Type")))
+	b.WriteString("Socket-Type")
+	binary.Write(&b, binary.BigEndian, uint32(len(socketType)))
+	b.WriteString(socketType)
+	return b.Bytes()
+}
+
+// parseCommand splits a command body into its name and data.
+func parseCommand(body []byte) (string, []byte, error) {
+	if len(body) < 1 || len(body) < 1+int(body[0]) {
+		return "", nil, ErrBadCommand
+	}
+	n := int(body[0])
+	return string(body[1 : 1+n]), body[1+n:], nil
+}
+
+// readyProperty extracts the property `key` from READY command metadata.
+func readyProperty(props []byte, key string) string {
+	for len(props) > 0 {
+		n := int(props[0])
+		if len(props) < 1+n+4 {
+			return ""
+		}
+		name := string(props[1 : 1+n])
+		props = props[1+n:]
+		vlen := int(binary.BigEndian.Uint32(props[:4]))
+		if len(props) < 4+vlen {
+			return ""
+		}
+		if strings.EqualFold(name, key) {
+			return string(props[4 : 4+vlen])
+		}
+		props = props[4+vlen:]
+	}
+	return ""
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func (zc *conn) writeFrame(flags byte, body []byte) error {
+	var hdr []byte
+	if len(body) > 255 {
+		hdr = make([]byte, 9)
+		hdr[0] = flags | flagLong
+		binary.BigEndian.PutUint64(hdr[1:], uint64(len(body)))
+	} else {
+		hdr = []byte{flags, byte(len(body))}
+	}
+	if _, err := zc.c.Write(append(hdr, body...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (zc *conn) readFrame() (byte, []byte, error) {
+	flags, err := zc.r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var size uint64
+	if flags&flagLong != 0 {
+		var bs [8]byte
+		if _, err := io.ReadFull(zc.r, bs[:]); err != nil {
+			return 0, nil, err
+		}
+		size = binary.BigEndian.Uint64(bs[:])
+	} else {
+		b, err := zc.r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		size = uint64(b)
+	}
+	if size > maxFrameSize {
+		return 0, nil, ErrFrameTooBig
+	}
+
+	body := make([]byte, size)
+	if _, err := io.ReadFull(zc.r, body); err != nil {
+		return 0, nil, err
+	}
+	return flags, body, nil
+}
+
+// readMessage reads frames until a complete message has been received, any
+// commands (ex: PING) seen in between are skipped.
+func (zc *conn) readMessage() (Message, error) {
+	msg := Message{}
+	for {
+		flags, body, err := zc.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		if flags&flagCommand != 0 {
+			continue
+		}
+		msg = append(msg, body)
+		if flags&flagMore == 0 {
+			return msg, nil
+		}
+	}
+}
+
+func (zc *conn) writeMessage(msg Message) error {
+	for i, part := range msg {
+		var flags byte
+		if i < len(msg)-1 {
+			flags = flagMore
+		}
+		if err := zc.writeFrame(flags, part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,226 @@
+package zmq
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// connPair returns both ends of a loopback TCP connection.  Unlike net.Pipe
+// writes are buffered, so both ends can send their greeting at once.
+func connPair(t *testing.T) (*conn, *conn) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		c, _ := l.Accept()
+		accepted <- c
+	}()
+	c, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := <-accepted
+	if s == nil {
+		t.Fatal("accept failed")
+	}
+	t.Cleanup(func() { c.Close(); s.Close() })
+	return newConn(c), newConn(s)
+}
+
+// greeting returns a ZMTP 3.0 greeting for `mechanism`.
+func greeting(mechanism string) []byte {
+	g := make([]byte, greetingLen)
+	g[0], g[9], g[10] = 0xFF, 0x7F, 3
+	copy(g[12:32], mechanism)
+	return g
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func TestFrameRoundTrip(t *testing.T) {
+	a, b := connPair(t)
+
+	for _, size := range []int{0, 1, 255, 256, 70000} {
+		body := bytes.Repeat([]byte{byte(size)}, size)
+		go a.writeFrame(flagMore, body)
+
+		flags, got, err := b.readFrame()
+		if err != nil {
+			t.Fatalf("size=%d: %s", size, err.Error())
+		}
+		if flags&flagMore == 0 {
+			t.Errorf("size=%d: lost the MORE flag (%#x)", size, flags)
+		}
+		if long := flags&flagLong != 0; long != (size > 255) {
+			t.Errorf("size=%d: LONG flag = %v", size, long)
+		}
+		if !bytes.Equal(got, body) {
+			t.Errorf("size=%d: body mismatch (got %d bytes)", size, len(got))
+		}
+	}
+}
+
+func TestReadFrameTooBig(t *testing.T) {
+	a, b := connPair(t)
+
+	hdr := make([]byte, 9)
+	hdr[0] = flagLong
+	binary.BigEndian.PutUint64(hdr[1:], maxFrameSize+1)
+	go a.c.Write(hdr)
+
+	if _, _, err := b.readFrame(); err != ErrFrameTooBig {
+		t.Errorf("err = %v, expected %v", err, ErrFrameTooBig)
+	}
+}
+
+func TestMessageRoundTrip(t *testing.T) {
+	a, b := connPair(t)
+
+	seq := make([]byte, 4)
+	binary.LittleEndian.PutUint32(seq, 42)
+	sent := Message{[]byte("hashblock"), bytes.Repeat([]byte{0xab}, 32), seq}
+	go func() {
+		// Commands between messages (ex: PING) are skipped by the reader.
+		a.writeFrame(flagCommand, []byte("\x04PING"))
+		a.writeMessage(sent)
+	}()
+
+	got, err := b.readMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(sent) {
+		t.Fatalf("got %d frames, expected %d", len(got), len(sent))
+	}
+	for i := range sent {
+		if !bytes.Equal(got[i], sent[i]) {
+			t.Errorf("frame %d = %x, expected %x", i, got[i], sent[i])
+		}
+	}
+	if got.Topic() != "hashblock" || !bytes.Equal(got.Body(), sent[1]) {
+		t.Errorf("topic / body = %s / %x", got.Topic(), got.Body())
+	}
+	if n, ok := got.Sequence(); !ok || n != 42 {
+		t.Errorf("sequence = %d (%v), expected 42", n, ok)
+	}
+}
+
+func TestMessageAccessors(t *testing.T) {
+	m := Message{}
+	if m.Topic() != "" || m.Body() != nil {
+		t.Errorf("empty message has topic / body %q / %x", m.Topic(), m.Body())
+	}
+	if _, ok := (Message{[]byte("t"), nil, []byte{1, 2}}).Sequence(); ok {
+		t.Error("short sequence frame accepted")
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func TestHandshake(t *testing.T) {
+	a, b := connPair(t)
+
+	type result struct {
+		peer string
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		peer, err := b.handshake("PUB")
+		done <- result{peer, err}
+	}()
+
+	peer, err := a.handshake("SUB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if peer != "PUB" {
+		t.Errorf("SUB side saw peer %q, expected PUB", peer)
+	}
+	if r := <-done; r.err != nil || r.peer != "SUB" {
+		t.Errorf("PUB side saw peer %q (%v), expected SUB", r.peer, r.err)
+	}
+
+	// Both ends must be usable for messages once the handshake is done.
+	go a.writeMessage(Message{[]byte("hello")})
+	if msg, err := b.readMessage(); err != nil || msg.Topic() != "hello" {
+		t.Errorf("message after handshake = %q (%v)", msg.Topic(), err)
+	}
+}
+
+func TestHandshakeErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		peer  []byte
+		ready []byte
+		err   error
+	}{
+		{"bad signature", make([]byte, greetingLen), nil, ErrBadGreeting},
+		{"old version", func() []byte { g := greeting("NULL"); g[10] = 2; return g }(), nil, ErrBadGreeting},
+		{"mechanism", greeting("PLAIN"), nil, ErrBadMechanism},
+		{"not ready", greeting("NULL"), []byte("\x05HELLO"), ErrBadCommand},
+	} {
+		a, b := connPair(t)
+		go func() {
+			b.c.Write(tc.peer)
+			if tc.ready != nil {
+				b.writeFrame(flagCommand, tc.ready)
+			}
+		}()
+		if _, err := a.handshake("SUB"); err != tc.err {
+			t.Errorf("%s: err = %v, expected %v", tc.name, err, tc.err)
+		}
+	}
+}
+
+func TestReadyProperty(t *testing.T) {
+	name, props, err := parseCommand(readyCommand("XPUB"))
+	if err != nil || name != "READY" {
+		t.Fatalf("parseCommand = %q (%v)", name, err)
+	}
+	if v := readyProperty(props, "socket-type"); v != "XPUB" {
+		t.Errorf("Socket-Type = %q, expected XPUB", v)
+	}
+	if v := readyProperty(props, "Identity"); v != "" {
+		t.Errorf("Identity = %q, expected none", v)
+	}
+	if v := readyProperty(props[:len(props)-1], "Socket-Type"); v != "" {
+		t.Errorf("truncated Socket-Type = %q, expected none", v)
+	}
+	if _, _, err := parseCommand([]byte("\x09READY")); err != ErrBadCommand {
+		t.Errorf("truncated command: err = %v, expected %v", err, ErrBadCommand)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func TestParseEndpoint(t *testing.T) {
+	for ep, expected := range map[string]string{
+		"tcp://127.0.0.1:28332": "127.0.0.1:28332",
+		"tcp://*:28332":         "127.0.0.1:28332",
+		"tcp://0.0.0.0:28332":   "127.0.0.1:28332",
+		"tcp://[::]:28332":      "[::1]:28332",
+		"tcp://node:28332":      "node:28332",
+	} {
+		if addr, err := ParseEndpoint(ep); err != nil || addr != expected {
+			t.Errorf("ParseEndpoint(%s) = %s (%v), expected %s", ep, addr, err, expected)
+		}
+	}
+	for _, ep := range []string{"ipc:///tmp/zmq", "tcp://127.0.0.1", "127.0.0.1:28332"} {
+		if _, err := ParseEndpoint(ep); err == nil {
+			t.Errorf("ParseEndpoint(%s) succeeded", ep)
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////